@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/logging"
+	"github.com/dmars8047/broterm/internal/theme"
+)
+
+// options are the global command line options
+type options struct {
+	configDir string
+	server    string
+	theme     string
+	colorMode string
+	logLevel  string
+	profile   string
+	noLog     bool
+	version   bool
+}
+
+// parseOptions parses the global command line options and returns them along with the remaining arguments
+// The first remaining argument, if any, is the subcommand
+func parseOptions(arguments []string) (*options, []string) {
+	opts := &options{}
+
+	flags := flag.NewFlagSet("broterm", flag.ExitOnError)
+	flags.Usage = func() {
+		printUsage(flags)
+	}
+
+	flags.StringVar(&opts.configDir, "config", "", "path to the config directory (default $XDG_CONFIG_HOME/broterm)")
+	flags.StringVar(&opts.server, "server", "", "server to connect to for this run, as host, host:port or scheme://host[:port]")
+	flags.StringVar(&opts.theme, "theme", "", "theme to use for this run")
+	flags.StringVar(&opts.colorMode, "color-mode", "", "colors to use for this run (auto, truecolor, 256, 16 or monochrome)")
+	flags.StringVar(&opts.logLevel, "log-level", "", "minimum level written to the log file for this run (debug, info, warn or error)")
+	flags.StringVar(&opts.profile, "profile", "", "name of the profile to use instead of the last active one")
+	flags.BoolVar(&opts.noLog, "no-log", false, "do not write a log file for this run")
+	flags.BoolVar(&opts.version, "version", false, "print the version and exit")
+
+	// ExitOnError makes Parse exit on a bad flag
+	_ = flags.Parse(arguments)
+
+	if opts.logLevel != "" {
+		var level slog.Level
+
+		if err := level.UnmarshalText([]byte(opts.logLevel)); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid log level %q - must be debug, info, warn or error\n", opts.logLevel)
+			os.Exit(2)
+		}
+	}
+
+	if opts.colorMode != "" && opts.colorMode != theme.COLOR_MODE_AUTO {
+		if _, err := theme.ParseColorMode(opts.colorMode); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid color mode %q - must be one of %s\n", opts.colorMode, strings.Join(theme.ColorModeSettings(), ", "))
+			os.Exit(2)
+		}
+	}
+
+	return opts, flags.Args()
+}
+
+// printUsage prints the usage of the command line including the subcommands
+func printUsage(flags *flag.FlagSet) {
+	out := flags.Output()
+
+	fmt.Fprintf(out, "Usage: broterm [options] [command]\n\n")
+	fmt.Fprintf(out, "Without a command the terminal user interface is started.\n\n")
+	fmt.Fprintf(out, "Commands:\n")
+
+	for _, command := range commands {
+		fmt.Fprintf(out, "  %-26s %s\n", command.usage, command.description)
+	}
+
+	fmt.Fprintf(out, "\nOptions:\n")
+	flags.PrintDefaults()
+}
+
+// configureLogging directs logging to the log directory inside the state directory using the config settings.
+// The log level given on the command line takes precedence over the configured one.
+// When announce is true the log destination is printed to stderr.
+func configureLogging(settings *config.ConfigSettings, opts *options, announce bool) error {
+	logDir, err := config.GetLogDirectoryPath()
+
+	if err != nil {
+		return err
+	}
+
+	loggingSettings := settings.Logging
+
+	// Invalid settings in the config file should not stop the application from starting
+	if err := loggingSettings.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging settings, using the defaults - %v\n", err)
+		loggingSettings = config.NewLoggingSettings()
+	}
+
+	if opts.logLevel != "" {
+		loggingSettings.Level = opts.logLevel
+	}
+
+	loggingSettings.Enabled = loggingSettings.Enabled && !opts.noLog
+
+	err = logging.Setup(logDir, loggingSettings)
+
+	if err != nil {
+		return err
+	}
+
+	if !announce {
+		return nil
+	}
+
+	if loggingSettings.Enabled {
+		fmt.Fprintf(os.Stderr, "Broterm Version - %s\n\nBroterm logging is enabled. Writing logs to %s\n", applicationVersion, logging.Path())
+	} else {
+		fmt.Fprintf(os.Stderr, "Broterm Version - %s\n\nBroterm logging is disabled.\n", applicationVersion)
+	}
+
+	return nil
+}
+
+// fatal prints the error to stderr and exits. The log package is not used since its output goes to the log file.
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Broterm Version - %s\n\nFatal error: %s\n", applicationVersion, fmt.Sprintf(format, args...))
+	logging.Close()
+	os.Exit(1)
+}
+
+// commandError prints the error for the command to stderr and returns the exit code for a failed command
+func commandError(command string, format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "broterm %s: %s\n", command, strings.TrimSpace(fmt.Sprintf(format, args...)))
+	return 1
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/logging"
+	"github.com/dmars8047/broterm/internal/state"
+	"github.com/dmars8047/broterm/internal/theme"
+	"github.com/dmars8047/idamlib/idam"
+	"github.com/dmars8047/strval"
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// command is a subcommand of the command line
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(opts *options, settings *config.ConfigSettings, args []string) int
+}
+
+// commands holds every subcommand
+var commands = []command{
+	{"login", "login [email]", "log in and remember the session for the next launch", runLogin},
+	{"logout", "logout", "log out and forget the remembered session", runLogout},
+	{"config", "config get [key]", "print one or all settings", runConfig},
+	{"config", "config set <key> <value> [<key> <value>...]", "change one or more settings", runConfig},
+	{"doctor", "doctor", "check the config directory and the connection to the server", runDoctor},
+	{"send", "send --room <name> [text]", "send a message to a room, read from stdin if no text is given", runSend},
+	{"tail", "tail --room <name>", "stream a room's messages to stdout (--format text or json)", runTail},
+}
+
+// runCommand runs the subcommand named by the first argument and returns the exit code
+func runCommand(opts *options, args []string) int {
+	for _, command := range commands {
+		if command.name != args[0] {
+			continue
+		}
+
+		for _, themeErr := range provisionThemes() {
+			fmt.Fprintf(os.Stderr, "Theme file ignored - %v\n", themeErr)
+		}
+
+		settings, err := provisionConfigFile()
+
+		// config set is how a config file holding invalid values is repaired, so it works on the file as it is
+		if err != nil && isConfigSet(args) {
+			settings, err = config.LoadUnvalidatedConfigSettings()
+		}
+
+		// doctor reports what is wrong with the config file itself, the remaining checks use as much of it as can be read
+		if err != nil && command.name == "doctor" {
+			settings, err = config.LoadUnvalidatedConfigSettings()
+
+			if err != nil {
+				settings, err = config.NewConfigSettings(), nil
+			}
+		}
+
+		if err != nil {
+			return commandError(command.name, "config could not be loaded - %v", err)
+		}
+
+		err = configureLogging(settings, opts, false)
+
+		if err != nil {
+			return commandError(command.name, "logging could not be configured - %v", err)
+		}
+
+		defer logging.Close()
+
+		return command.run(opts, settings, args[1:])
+	}
+
+	return commandError(args[0], "unknown command, run broterm -h for the list of commands")
+}
+
+// isConfigSet returns true if the arguments run the config set command
+func isConfigSet(args []string) bool {
+	return len(args) > 1 && args[0] == "config" && args[1] == "set"
+}
+
+// resolveServerSettings returns the server settings for the profile given on the command line or the active profile,
+// with the server given on the command line applied on top
+func resolveServerSettings(opts *options, settings *config.ConfigSettings) (config.ServerSettings, error) {
+	server := settings.Server
+	profileName := settings.ActiveProfile
+
+	if opts.profile != "" {
+		profileName = opts.profile
+	}
+
+	if profileName != "" {
+		profile, ok := settings.GetProfile(profileName)
+
+		if !ok {
+			return server, fmt.Errorf("profile %q does not exist", profileName)
+		}
+
+		server = profile.Server
+	}
+
+	if opts.server != "" {
+		return server.WithAddress(opts.server)
+	}
+
+	return server, server.Validate()
+}
+
+// runLogin logs in with the email given as argument (or prompted for) and a prompted password and remembers the session
+func runLogin(opts *options, settings *config.ConfigSettings, args []string) int {
+	server, err := resolveServerSettings(opts, settings)
+
+	if err != nil {
+		return commandError("login", "%v", err)
+	}
+
+	serverClients, err := state.NewServerClients(server)
+
+	if err != nil {
+		return commandError("login", "%v", err)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+
+	var email string
+
+	if len(args) > 0 {
+		email = args[0]
+	} else {
+		fmt.Print("Email: ")
+		email, err = reader.ReadString('\n')
+
+		if err != nil {
+			return commandError("login", "email could not be read - %v", err)
+		}
+	}
+
+	email = strings.TrimSpace(email)
+
+	valResult := strval.ValidateStringWithName(email, "Email", strval.MustNotBeEmpty(), strval.MustBeValidEmailFormat())
+
+	if !valResult.Valid {
+		return commandError("login", "%s", strings.Join(valResult.Messages, " "))
+	}
+
+	password, err := readPassword(reader)
+
+	if err != nil {
+		return commandError("login", "password could not be read - %v", err)
+	}
+
+	loginResponse, err := serverClients.UserAuthClient().Login("brochat", &idam.UserLoginRequest{
+		Email:    email,
+		Password: password,
+	})
+
+	if err != nil {
+		return commandError("login", "%v", err)
+	}
+
+	tokenExpiration := time.Now().Add(time.Duration(loginResponse.ExpiresIn * int64(time.Second)))
+
+	err = provisionSessionStore().Save(state.StoredSession{
+		AccessToken:     loginResponse.Token,
+		TokenExpiration: tokenExpiration,
+		UserId:          loginResponse.UserId,
+		Server:          server.BaseUrl(),
+	})
+
+	if err != nil {
+		return commandError("login", "session could not be remembered - %v", err)
+	}
+
+	// Pre-fill the login form of the active profile with the account
+	if profile, ok := settings.GetProfile(settings.ActiveProfile); ok && opts.profile == "" && profile.Email != email {
+		profile.Email = email
+
+		if err := config.SaveConfigSettings(settings); err != nil {
+			return commandError("login", "profile email could not be saved - %v", err)
+		}
+	}
+
+	fmt.Printf("Logged in as %s. The session expires at %s.\n", loginResponse.Username, tokenExpiration.Format(time.RFC1123))
+
+	return 0
+}
+
+// readPassword reads the password without echoing it when stdin is a terminal, otherwise it reads a line from stdin
+func readPassword(reader *bufio.Reader) (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	if term.IsTerminal(fd) {
+		fmt.Print("Password: ")
+		passwordBytes, err := term.ReadPassword(fd)
+		fmt.Println()
+
+		return string(passwordBytes), err
+	}
+
+	password, err := reader.ReadString('\n')
+
+	// A password without a trailing newline is fine
+	if err != nil && password == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+// sessionServerSettings returns the settings of the server the remembered session belongs to.
+// The server given on the command line or by a profile is used if it is that server, otherwise the configured servers are searched for it.
+// Sessions remembered before their server was recorded are assumed to belong to the configured server unless another one is given on the command line.
+func sessionServerSettings(opts *options, settings *config.ConfigSettings, storedSession state.StoredSession) (config.ServerSettings, error) {
+	if storedSession.Server == "" {
+		if opts.server != "" || opts.profile != "" {
+			return config.ServerSettings{}, errors.New("the remembered session does not record its server, run logout without --server or --profile")
+		}
+
+		return resolveServerSettings(opts, settings)
+	}
+
+	candidates := make([]config.ServerSettings, 0, len(settings.Profiles)+2)
+
+	if server, err := resolveServerSettings(opts, settings); err == nil {
+		candidates = append(candidates, server)
+	}
+
+	candidates = append(candidates, settings.Server)
+
+	for _, profile := range settings.Profiles {
+		candidates = append(candidates, profile.Server)
+	}
+
+	for _, server := range candidates {
+		if storedSession.BelongsTo(server) && server.Validate() == nil {
+			return server, nil
+		}
+	}
+
+	return config.ServerSettings{}, fmt.Errorf("the server the session belongs to (%s) is no longer configured", storedSession.Server)
+}
+
+// runLogout logs out of the remembered session and forgets it
+func runLogout(opts *options, settings *config.ConfigSettings, args []string) int {
+	sessionStore := provisionSessionStore()
+
+	storedSession, ok, err := sessionStore.Load()
+
+	if err != nil {
+		return commandError("logout", "remembered session could not be loaded - %v", err)
+	}
+
+	if !ok {
+		fmt.Println("Not logged in.")
+		return 0
+	}
+
+	// The token is only ever sent to the server which issued it
+	server, err := sessionServerSettings(opts, settings, storedSession)
+
+	if err == nil {
+		var serverClients *state.ServerClients
+		serverClients, err = state.NewServerClients(server)
+
+		if err == nil {
+			err = serverClients.UserAuthClient().Logout(storedSession.AccessToken)
+		}
+	}
+
+	// The session is forgotten even if the server could not be told about it
+	if clearErr := sessionStore.Clear(); clearErr != nil {
+		return commandError("logout", "remembered session could not be removed - %v", clearErr)
+	}
+
+	if err != nil {
+		return commandError("logout", "the session was forgotten but the server could not be notified - %v", err)
+	}
+
+	fmt.Println("Logged out.")
+
+	return 0
+}
+
+// runConfig prints or changes settings in the config file
+func runConfig(opts *options, settings *config.ConfigSettings, args []string) int {
+	if len(args) == 0 {
+		return commandError("config", "expected get or set")
+	}
+
+	switch args[0] {
+	case "get":
+		if len(args) > 2 {
+			return commandError("config", "usage: broterm config get [key]")
+		}
+
+		if len(args) == 2 {
+			value, err := config.GetSetting(settings, args[1])
+
+			if err != nil {
+				return commandError("config", "%v", err)
+			}
+
+			fmt.Println(value)
+			return 0
+		}
+
+		for _, key := range config.SettingKeys() {
+			value, _ := config.GetSetting(settings, key)
+			fmt.Printf("%s = %s\t# %s\n", key, value, config.DescribeSetting(key))
+		}
+
+		return 0
+	case "set":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return commandError("config", "usage: broterm config set <key> <value> [<key> <value>...]")
+		}
+
+		for i := 1; i < len(args); i += 2 {
+			err := config.SetSetting(settings, args[i], args[i+1])
+
+			if err != nil {
+				return commandError("config", "%v", err)
+			}
+		}
+
+		// The settings may have been loaded without validation, only the result has to be valid.
+		// Several invalid values are repaired by setting them all at once.
+		err := config.SaveConfigSettings(settings)
+
+		if err != nil {
+			return commandError("config", "config could not be saved - %v", err)
+		}
+
+		return 0
+	default:
+		return commandError("config", "unknown config command %q, expected get or set", args[0])
+	}
+}
+
+// runDoctor checks the config directory and the connection to the server and reports each result
+func runDoctor(opts *options, settings *config.ConfigSettings, args []string) int {
+	failures := 0
+
+	report := func(check string, err error, detail string) {
+		if err != nil {
+			failures++
+			fmt.Printf("[FAIL] %s - %v\n", check, err)
+			return
+		}
+
+		fmt.Printf("[ OK ] %s - %s\n", check, detail)
+	}
+
+	configDir, err := config.GetConfigDirectoryPath()
+
+	if err == nil {
+		err = checkDirectoryWritable(configDir)
+	}
+
+	report("Config directory", err, configDir)
+
+	_, err = config.LoadConfigSettings()
+
+	report("Config file", err, filepath.Join(configDir, config.CONFIG_FILE_NAME))
+
+	// Invalid values are reported above and the other checks still run, but a file which cannot be read leaves nothing to check
+	var validationErr *config.ValidationError
+
+	if err != nil && !errors.As(err, &validationErr) {
+		return 1
+	}
+
+	// Theme files were loaded before the config and their problems already printed, report them again as a check
+	var themesErr error
+
+	if themeErrs := provisionThemes(); len(themeErrs) > 0 {
+		themesErr = fmt.Errorf("%d theme file(s) could not be loaded, the first - %v", len(themeErrs), themeErrs[0])
+	}
+
+	report("Theme files", themesErr, "user themes: "+describeUserThemes())
+
+	// A missing theme does not stop the application from starting but the user most likely wants it back
+	var configuredThemesErr error
+
+	if themeWarnings := settings.ThemeWarnings(); len(themeWarnings) > 0 {
+		configuredThemesErr = fmt.Errorf("%d configured theme(s) not available, the first - %v", len(themeWarnings), themeWarnings[0])
+	}
+
+	report("Configured themes", configuredThemesErr, "all available")
+
+	server, err := resolveServerSettings(opts, settings)
+
+	report("Server settings", err, server.BaseUrl())
+
+	if err != nil {
+		return 1
+	}
+
+	serverClients, err := state.NewServerClients(server)
+
+	report("TLS configuration", err, describeTLS(server))
+
+	if err != nil {
+		return 1
+	}
+
+	httpClient := serverClients.HttpClient()
+
+	status, err := checkEndpoint(httpClient, server.BaseUrl()+idam.UserLogoutUrlSuffix)
+	report("Identity endpoint", err, status)
+
+	status, err = checkEndpoint(httpClient, server.BaseUrl()+chat.GET_USERS_URL_SUFFIX)
+	report("Chat endpoint", err, status)
+
+	storedSession, loggedIn, _ := provisionSessionStore().Load()
+
+	status, err = checkFeedUpgrade(serverClients, storedSession.AccessToken, loggedIn)
+	report("Feed websocket upgrade", err, status)
+
+	if failures > 0 {
+		fmt.Printf("\n%d check(s) failed.\n", failures)
+		return 1
+	}
+
+	fmt.Println("\nAll checks passed.")
+
+	return 0
+}
+
+// describeUserThemes lists the codes of the loaded user themes
+func describeUserThemes() string {
+	userThemes := theme.Codes()[len(theme.BUILT_IN_THEME_CODES):]
+
+	if len(userThemes) == 0 {
+		return "none"
+	}
+
+	return strings.Join(userThemes, ", ")
+}
+
+// checkDirectoryWritable returns an error if the directory does not exist or a file cannot be created in it
+func checkDirectoryWritable(dir string) error {
+	info, err := os.Stat(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	file, err := os.CreateTemp(dir, ".doctor-*")
+
+	if err != nil {
+		return err
+	}
+
+	file.Close()
+
+	return os.Remove(filepath.Clean(file.Name()))
+}
+
+// describeTLS describes the TLS settings used for the server
+func describeTLS(server config.ServerSettings) string {
+	switch {
+	case server.Scheme == "http":
+		return "not used"
+	case server.SkipTLSVerify:
+		return "certificate verification disabled"
+	case server.CAPath != "":
+		return "trusting " + server.CAPath
+	default:
+		return "system certificate authorities"
+	}
+}
+
+// checkEndpoint makes an unauthenticated request to the endpoint. Any response other than a server error proves it is reachable.
+func checkEndpoint(httpClient *http.Client, endpoint string) (string, error) {
+	response, err := httpClient.Get(endpoint)
+
+	if err != nil {
+		return "", err
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode >= http.StatusInternalServerError {
+		return "", fmt.Errorf("%s responded with %s", endpoint, response.Status)
+	}
+
+	return fmt.Sprintf("%s responded with %s", endpoint, response.Status), nil
+}
+
+// checkFeedUpgrade dials the feed. Without a session an authentication error from the server still proves the upgrade endpoint is reachable.
+func checkFeedUpgrade(serverClients *state.ServerClients, accessToken string, loggedIn bool) (string, error) {
+	headers := http.Header{}
+
+	if loggedIn {
+		headers.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	conn, response, err := serverClients.Dialer().Dial(serverClients.FeedUrl(), headers)
+
+	if err == nil {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Doctor check complete."), time.Now().Add(time.Second))
+		conn.Close()
+
+		return "connected to " + serverClients.FeedUrl(), nil
+	}
+
+	if errors.Is(err, websocket.ErrBadHandshake) && response != nil &&
+		(response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden) {
+		if loggedIn {
+			return "", fmt.Errorf("the remembered session was rejected with %s, log in again", response.Status)
+		}
+
+		return fmt.Sprintf("reachable, log in to complete the upgrade (%s)", response.Status), nil
+	}
+
+	return "", err
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/state"
+)
+
+// headlessSession is a user session restored from the session store for commands which talk to the server without the terminal user interface
+type headlessSession struct {
+	appContext    *state.ApplicationContext
+	brochatClient *chat.BroChatClient
+	feedClient    *state.FeedClient
+	user          chat.User
+	accessToken   string
+}
+
+// startHeadlessSession restores the remembered session, fetches the user and prepares a feed client. The feed is not connected yet.
+// The session is bound to the context.
+func startHeadlessSession(ctx context.Context, opts *options, settings *config.ConfigSettings) (*headlessSession, error) {
+	server, err := resolveServerSettings(opts, settings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serverClients, err := state.NewServerClients(server)
+
+	if err != nil {
+		return nil, err
+	}
+
+	storedSession, ok, err := provisionSessionStore().Load()
+
+	if err != nil {
+		return nil, fmt.Errorf("remembered session could not be loaded - %w", err)
+	}
+
+	if !ok {
+		return nil, errors.New("not logged in, run broterm login first")
+	}
+
+	if !storedSession.BelongsTo(server) {
+		return nil, fmt.Errorf("the remembered session is for %s, run broterm login to log in to %s", storedSession.Server, server.BaseUrl())
+	}
+
+	appContext := state.NewApplicationContext(ctx, settings.Theme)
+
+	// A remembered session cannot be refreshed so it simply ends when the token expires
+	appContext.SetUserSession(state.UserAuth{
+		AccessToken:     storedSession.AccessToken,
+		TokenExpiration: storedSession.TokenExpiration,
+	}, nil, func() {
+		fmt.Fprintln(os.Stderr, "The session has expired, run broterm login to start a new one.")
+	})
+
+	getUserResult := serverClients.BrochatClient().GetUser(storedSession.AccessToken, storedSession.UserId)
+
+	err = getUserResult.Err()
+
+	if err != nil {
+		appContext.CancelUserSession()
+		return nil, fmt.Errorf("user could not be fetched - %w", err)
+	}
+
+	appContext.SetBrochatUser(getUserResult.Content)
+
+	// Headless commands keep their own in-memory outbox so they never touch the messages queued by the terminal user interface
+	outbox, _ := state.NewOutbox("")
+
+	return &headlessSession{
+		appContext:    appContext,
+		brochatClient: serverClients.BrochatClient(),
+		feedClient:    serverClients.NewFeedClient(appContext, state.FeedClientOption_Outbox(outbox)),
+		user:          getUserResult.Content,
+		accessToken:   storedSession.AccessToken,
+	}, nil
+}
+
+// findRoom returns the user's room with the given name. An exact match is preferred over a case insensitive one.
+func (session *headlessSession) findRoom(name string) (chat.Room, error) {
+	for _, room := range session.user.Rooms {
+		if room.Name == name {
+			return room, nil
+		}
+	}
+
+	for _, room := range session.user.Rooms {
+		if strings.EqualFold(room.Name, name) {
+			return room, nil
+		}
+	}
+
+	return chat.Room{}, fmt.Errorf("%s is not a member of a room named %q", session.user.Username, name)
+}
+
+// joinChannel makes the channel the active one. The feed remembers it and restores it each time it connects.
+func (session *headlessSession) joinChannel(channelId string) {
+	// Sending fails while the feed is down which is fine since the channel is restored on connect
+	_ = session.feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_SET_ACTIVE_CHANNEL_REQUEST, &chat.SetActiveChannelRequest{
+		ChannelId: channelId,
+	})
+}
+
+// close ends the user session and waits for the feed connection to close cleanly
+func (session *headlessSession) close() {
+	session.appContext.CancelUserSession()
+	session.feedClient.Disconnect()
+}
+
+// runSend sends a message to a room and waits for the server to confirm it
+func runSend(opts *options, settings *config.ConfigSettings, args []string) int {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	roomName := flags.String("room", "", "name of the room to send the message to")
+	timeout := flags.Duration("timeout", 30*time.Second, "how long to wait for the server to confirm the message")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *roomName == "" {
+		return commandError("send", "--room is required")
+	}
+
+	content := strings.Join(flags.Args(), " ")
+
+	// Read the message from stdin if none was given as arguments
+	if content == "" {
+		stdinBytes, err := io.ReadAll(os.Stdin)
+
+		if err != nil {
+			return commandError("send", "message could not be read from stdin - %v", err)
+		}
+
+		content = strings.TrimRight(string(stdinBytes), "\r\n")
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return commandError("send", "the message is empty")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	session, err := startHeadlessSession(ctx, opts, settings)
+
+	if err != nil {
+		return commandError("send", "%v", err)
+	}
+
+	defer session.close()
+
+	room, err := session.findRoom(*roomName)
+
+	if err != nil {
+		return commandError("send", "%v", err)
+	}
+
+	outbox := session.feedClient.GetOutbox()
+	subscriptionId, outboxUpdateChannel := outbox.SubscribeToUpdates()
+	defer outbox.UnsubscribeFromUpdates(subscriptionId)
+
+	// The channel is made active and the message sent as soon as the feed connects
+	session.joinChannel(room.ChannelId)
+
+	entry := session.feedClient.QueueChatMessage(chat.ChatMessageRequest{
+		ChannelId: room.ChannelId,
+		Content:   content,
+	})
+
+	err = session.feedClient.Connect()
+
+	if err != nil {
+		return commandError("send", "feed connection failed - %v", err)
+	}
+
+	timer := time.NewTimer(*timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return commandError("send", "interrupted before the message was confirmed")
+		case <-timer.C:
+			return commandError("send", "the message was not confirmed within %s", *timeout)
+		case update, ok := <-outboxUpdateChannel:
+			if !ok {
+				return commandError("send", "the session ended before the message was confirmed")
+			}
+
+			if update.Id != entry.Id {
+				continue
+			}
+
+			switch update.Status {
+			case state.OUTBOX_ENTRY_STATUS_DELIVERED:
+				return 0
+			case state.OUTBOX_ENTRY_STATUS_FAILED:
+				return commandError("send", "the message could not be delivered")
+			}
+		}
+	}
+}
+
+// runTail streams the messages sent to a room to stdout until interrupted
+func runTail(opts *options, settings *config.ConfigSettings, args []string) int {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	roomName := flags.String("room", "", "name of the room to stream")
+	format := flags.String("format", "text", "output format, text or json (one message per line)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *roomName == "" {
+		return commandError("tail", "--room is required")
+	}
+
+	if *format != "text" && *format != "json" {
+		return commandError("tail", "--format must be text or json, got %q", *format)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	session, err := startHeadlessSession(ctx, opts, settings)
+
+	if err != nil {
+		return commandError("tail", "%v", err)
+	}
+
+	defer session.close()
+
+	room, err := session.findRoom(*roomName)
+
+	if err != nil {
+		return commandError("tail", "%v", err)
+	}
+
+	usernames := make(map[string]string)
+
+	// Usernames are looked up from the channel's members and refreshed when someone new speaks
+	loadUsernames := func() {
+		getChannelResult := session.brochatClient.GetChannel(session.accessToken, room.ChannelId)
+
+		if getChannelResult.Err() != nil {
+			return
+		}
+
+		for _, user := range getChannelResult.Content.Users {
+			usernames[user.Id] = user.Username
+		}
+	}
+
+	if *format == "text" {
+		loadUsernames()
+	}
+
+	subscriptionId, chatMessageChannel := session.feedClient.SubscribeToChatMessages()
+	defer session.feedClient.UnsubscribeFromChatMessages(subscriptionId)
+
+	connStateSubscriptionId, connStateChannel := session.feedClient.SubscribeToConnectionState()
+	defer session.feedClient.UnsubscribeFromConnectionState(connStateSubscriptionId)
+
+	session.joinChannel(room.ChannelId)
+
+	err = session.feedClient.Connect()
+
+	if err != nil {
+		return commandError("tail", "feed connection failed - %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	lastStatus := state.CONNECTION_STATUS_CONNECTING
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case connState, ok := <-connStateChannel:
+			if !ok {
+				connStateChannel = nil
+				continue
+			}
+
+			if connState.Status == lastStatus {
+				continue
+			}
+
+			lastStatus = connState.Status
+
+			// Connection changes go to stderr so they never mix with the messages
+			if connState.Reason != "" {
+				fmt.Fprintf(os.Stderr, "%s - %s\n", connState.Status, connState.Reason)
+			} else {
+				fmt.Fprintln(os.Stderr, connState.Status)
+			}
+		case msg, ok := <-chatMessageChannel:
+			if !ok {
+				return commandError("tail", "the session ended")
+			}
+
+			if msg.ChannelId != room.ChannelId {
+				continue
+			}
+
+			if *format == "json" {
+				if err := encoder.Encode(msg); err != nil {
+					return commandError("tail", "message could not be written - %v", err)
+				}
+
+				continue
+			}
+
+			username, ok := usernames[msg.SenderUserId]
+
+			if !ok {
+				loadUsernames()
+				username, ok = usernames[msg.SenderUserId]
+			}
+
+			if !ok {
+				username = msg.SenderUserId
+			}
+
+			fmt.Printf("%s %s: %s\n", msg.RecievedAtUtc.Local().Format(time.DateTime), username, msg.Content)
+		}
+	}
+}
@@ -2,56 +2,104 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/dmars8047/brolib/chat"
 	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/logging"
 	"github.com/dmars8047/broterm/internal/state"
+	"github.com/dmars8047/broterm/internal/theme"
 	"github.com/dmars8047/broterm/internal/ui"
-	"github.com/dmars8047/idamlib/idam"
-	"github.com/gorilla/websocket"
+	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
+const applicationVersion = "v0.1.7"
+
+// How often the themes directory is checked for added, changed or removed theme files
+const themeFilePollInterval = 2 * time.Second
+
 func main() {
+	opts, args := parseOptions(os.Args[1:])
+
+	if opts.version {
+		fmt.Printf("broterm %s\n", applicationVersion)
+		return
+	}
+
+	config.SetConfigDirectoryPath(opts.configDir)
+
+	if len(args) > 0 {
+		os.Exit(runCommand(opts, args))
+	}
 
-	const applicationVersion = "v0.1.7"
+	runTerminalUI(opts)
+}
+
+// runTerminalUI runs the interactive terminal user interface
+func runTerminalUI(opts *options) {
+	// User themes must be loaded before the config file is validated
+	themeErrs := provisionThemes()
+
+	for _, themeErr := range themeErrs {
+		fmt.Fprintf(os.Stderr, "Theme file ignored - %v\n", themeErr)
+	}
 
 	// Configure logging
-	config, file, err := provisionConfigFile()
+	configSettings, err := provisionConfigFile()
+
+	if err != nil {
+		fatal("config file could not be loaded - %v", err)
+	}
+
+	themeWarnings := configSettings.ThemeWarnings()
+
+	for _, themeWarning := range themeWarnings {
+		fmt.Fprintf(os.Stderr, "Theme not available - %v\n", themeWarning)
+	}
+
+	err = configureLogging(configSettings, opts, true)
 
 	if err != nil {
-		log.Fatalf("Broterm Version - %s\n\nFatal error: log files could not be configured - %v", applicationVersion, err)
+		fatal("log files could not be configured - %v", err)
 	}
 
-	defer file.Close()
+	defer logging.Close()
+
+	logger := logging.Component("main")
+
+	for _, themeErr := range themeErrs {
+		logger.Warn("Theme file ignored", "error", themeErr)
+	}
 
-	if config.LoggingEnabled {
-		log.Printf("Broterm Version - %s\n\nBroterm logging is enabled. Writing logs to %s\n", applicationVersion, file.Name())
-		log.SetOutput(file)
-	} else {
-		log.Printf("Broterm Version - %s\n\nBroterm logging is disabled.\n", applicationVersion)
-		// supress logging
-		log.SetOutput(&NullWriter{})
+	for _, themeWarning := range themeWarnings {
+		logger.Warn("Theme not available, using the default theme", "error", themeWarning)
 	}
 
-	// Setup the http client
-	httpClient := &http.Client{
-		Timeout: 10 * time.Second,
+	// Setup the clients for the server of the profile about to be activated so activating it does not switch servers
+	startupProfile := configSettings.ActiveProfile
+
+	if opts.profile != "" {
+		startupProfile = opts.profile
 	}
 
-	const hostAddr = "dev.marshall-labs.com"
+	startupServer := configSettings.Server
 
-	// Setup dependencies
-	userAuthClient := idam.NewUserAuthClient(httpClient, "https://"+hostAddr)
+	if profile, ok := configSettings.GetProfile(startupProfile); ok {
+		startupServer = profile.Server
+	}
 
-	brochatClient := chat.NewBroChatClient(httpClient, "https://"+hostAddr)
+	serverClients, err := state.NewServerClients(startupServer)
+
+	if err != nil {
+		logger.Warn("Configured server settings could not be applied, using the default server", "error", err)
+		serverClients, _ = state.NewServerClients(config.NewServerSettings())
+	}
 
 	// Configure the application
 	app := tview.NewApplication()
@@ -60,192 +108,304 @@ func main() {
 	context, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	appContext := state.NewApplicationContext(context, config.Theme)
+	appContext := state.NewApplicationContext(context, configSettings.Theme)
+
+	// Build the keymap, invalid key binding overrides are left out
+	keymap, keymapErrs := ui.NewKeymap(configSettings.KeyBindings)
+
+	for _, err := range keymapErrs {
+		logger.Warn("Key binding could not be applied", "error", err)
+	}
 
 	// Setup the page navigator
-	nav := ui.NewNavigator(appContext)
+	nav := ui.NewNavigator(appContext, keymap)
+
+	// Undelivered chat messages are kept on disk so they can be sent after a restart
+	outbox, err := provisionOutbox()
+
+	if err != nil {
+		logger.Warn("Outbox could not be loaded, undelivered messages will not be persisted", "error", err)
+		outbox, _ = state.NewOutbox("")
+	}
+
+	// Sessions the user asked to be remembered are kept on disk so they survive a restart
+	sessionStore := provisionSessionStore()
+
+	feedClient := serverClients.NewFeedClient(appContext, state.FeedClientOption_Outbox(outbox))
+
+	// Mentions of the user are counted per room so the room list can point out where they were mentioned
+	mentionTracker := state.NewMentionTracker()
+
+	// Activate the profile given on the command line or the one active when the application last closed
+	profileManager := state.NewProfileManager(appContext, serverClients, feedClient, sessionStore, configSettings)
+
+	if opts.profile != "" {
+		err = profileManager.Switch(opts.profile, false)
+
+		if err != nil {
+			fatal("profile could not be activated - %v", err)
+		}
+	} else if configSettings.ActiveProfile != "" {
+		err = profileManager.Switch(configSettings.ActiveProfile, false)
+
+		if err != nil {
+			logger.Warn("Last active profile could not be activated, using the default settings", "profile", configSettings.ActiveProfile, "error", err)
+			configSettings.ActiveProfile = ""
+
+			// The clients were set up for the profile's server
+			if err := serverClients.Apply(configSettings.Server); err != nil {
+				logger.Warn("Configured server settings could not be applied", "error", err)
+			}
+		}
+	}
+
+	// Settings given on the command line apply on top of the profile for this run only
+	if opts.server != "" {
+		serverSettings, err := serverClients.GetSettings().WithAddress(opts.server)
+
+		if err == nil {
+			err = serverClients.Apply(serverSettings)
+		}
 
-	dialer := &websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
+		if err != nil {
+			fatal("invalid server %q - %v", opts.server, err)
+		}
 	}
 
-	feedClient := state.NewFeedClient(dialer, hostAddr, brochatClient, appContext)
+	if opts.theme != "" {
+		if !theme.IsKnown(opts.theme) {
+			fatal("unknown theme %q - must be one of %s", opts.theme, strings.Join(theme.Codes(), ", "))
+		}
+
+		appContext.SetTheme(opts.theme)
+	}
 
 	// Setup the welcome page
-	welcomePage := ui.NewWelcomePage(applicationVersion)
+	welcomePage := ui.NewWelcomePage(applicationVersion, profileManager)
 	welcomePage.Setup(app, appContext, nav)
 
 	// Setup the app settings page
-	appSettingsPage := ui.NewAppSettingsPage(config.LoggingEnabled)
+	appSettingsPage := ui.NewAppSettingsPage(configSettings, serverClients, profileManager)
 	appSettingsPage.Setup(app, appContext, nav)
 
 	// Setup the registration page
-	registrationPage := ui.NewRegistrationPage(userAuthClient)
+	registrationPage := ui.NewRegistrationPage(serverClients)
 	registrationPage.Setup(app, appContext, nav)
 
 	// Setup the login page
-	loginPage := ui.NewLoginPage(userAuthClient, brochatClient, feedClient)
+	loginPage := ui.NewLoginPage(feedClient, serverClients, sessionStore, profileManager)
 	loginPage.Setup(app, appContext, nav)
 
 	// Setup the forgot password page
-	forgotPasswordPage := ui.NewForgotPasswordPage(userAuthClient)
+	forgotPasswordPage := ui.NewForgotPasswordPage(serverClients)
 	forgotPasswordPage.Setup(app, appContext, nav)
 
 	// Setup the chat page
-	chatPage := ui.NewChatPage(brochatClient, feedClient)
+	chatPage := ui.NewChatPage(serverClients, feedClient, mentionTracker, configSettings)
 	chatPage.Setup(app, appContext, nav)
 
 	// Setup the home page
-	homePage := ui.NewHomePage(userAuthClient)
+	homePage := ui.NewHomePage(serverClients, sessionStore)
 	homePage.Setup(app, appContext, nav)
 
 	// Setup the friends list page
-	friendsListPage := ui.NewFriendsListPage(brochatClient, feedClient)
+	friendsListPage := ui.NewFriendsListPage(serverClients, feedClient)
 	friendsListPage.Setup(app, appContext, nav)
 
 	// Setup the find a friend page
-	findAFriendPage := ui.NewFindAFriendPage(brochatClient)
+	findAFriendPage := ui.NewFindAFriendPage(serverClients)
 	findAFriendPage.Setup(app, appContext, nav)
 
 	// Setup the accept friend request page
-	acceptFriendRequestPage := ui.NewAcceptFriendRequestPage(brochatClient, feedClient)
+	acceptFriendRequestPage := ui.NewAcceptFriendRequestPage(serverClients, feedClient)
 	acceptFriendRequestPage.Setup(app, appContext, nav)
 
 	// Setup the room list page
-	roomListPage := ui.NewRoomListPage(brochatClient, feedClient)
+	roomListPage := ui.NewRoomListPage(serverClients, feedClient, mentionTracker)
 	roomListPage.Setup(app, appContext, nav)
 
 	// Setup the room editor page
-	roomEditorPage := ui.NewRoomEditorPage(brochatClient)
+	roomEditorPage := ui.NewRoomEditorPage(serverClients)
 	roomEditorPage.Setup(app, appContext, nav)
 
 	// Setup the room finder page
-	roomFinderPage := ui.NewRoomFinderPage(brochatClient)
+	roomFinderPage := ui.NewRoomFinderPage(serverClients)
 	roomFinderPage.Setup(app, appContext, nav)
 
+	// Setup the command palette which jumps to rooms, friends and actions from any page
+	commandPalette := ui.NewCommandPalette(serverClients, sessionStore, configSettings)
+	commandPalette.Setup(app, appContext, nav)
+
+	// Handle the keys which work on every page, such as the command palette and help
+	nav.HandleGlobalKeys(app)
+
+	// Show the health of the feed connection beneath every page
+	nav.MonitorConnection(app, feedClient)
+
+	// Restyle the whole UI whenever the theme changes, including when a theme file is edited
+	nav.MonitorTheme(app)
+	watchThemeFiles(context, appContext.GetThemeRegistry(), logger)
+
+	// Adapt the themes to the colors the terminal can show
+	screen, err := tcell.NewScreen()
+
+	if err != nil {
+		fatal("terminal could not be opened - %v", err)
+	}
+
+	app.SetScreen(screen)
+
+	displaySettings := configSettings.Display
+
+	if opts.colorMode != "" {
+		displaySettings.ColorMode = opts.colorMode
+	}
+
+	displayOptions := displaySettings.DisplayOptions(screen.Colors())
+	appContext.GetThemeRegistry().SetDisplayOptions(displayOptions)
+	appSettingsPage.SetTerminalColors(screen.Colors())
+
+	logger.Info("Display configured", "terminal_colors", screen.Colors(), "color_mode", displayOptions.ColorMode.String(),
+		"colorblind_safe_labels", displayOptions.ColorblindSafeLabels)
+
 	// Set the background color of the navs pages
 	theme := appContext.GetTheme()
 	nav.Pages.SetBackgroundColor(theme.BackgroundColor)
 	theme.ApplyGlobals()
 
+	// Skip the login page if a remembered session is still valid
+	loginPage.RestoreSession(app, appContext, nav)
+
 	// Start the application.
-	err = app.SetRoot(nav.Pages, true).Run()
+	err = app.SetRoot(nav.Layout, true).Run()
 
 	if err != nil {
-		log.Fatalf("Fatal error: %v", err)
+		fatal("%v", err)
 	}
 }
 
-// IO.Writer that does nothing
-type NullWriter struct{}
+// provisionOutbox loads the outbox file from the state directory
+func provisionOutbox() (*state.Outbox, error) {
+	stateDir, err := provisionStateDirectory()
 
-// Write does nothing
-func (NullWriter) Write(p []byte) (int, error) {
-	return len(p), nil
+	if err != nil {
+		return nil, err
+	}
 
+	return state.NewOutbox(filepath.Join(stateDir, config.OUTBOX_FILE_NAME))
 }
 
-// provisionConfigFile creates a config directory in the user's home directory if it does not already exist
-// It will read the config.json file in the config directory and return a ConfigSettings struct with the values from the file
-// It also creates a log file in the user's home directory and returns a file handle to it
-// If the log file already exists, it will be opened and the file handle will be returned
-// If the log file does not exist, it will be created and the file handle will be returned
-// If the log file cannot be created or opened, an error will be returned
-// This function also administers the log directory by deleting the oldest log file if the number of log files exceeds MAX_NUM_LOG_FILES.
-func provisionConfigFile() (*config.ConfigSettings, *os.File, error) {
-	const maxNumLogFiles = 10
-
-	// Get the user's home directory
-	homeDir, err := os.UserHomeDir()
+// provisionSessionStore creates the session store in the state directory
+// If the state directory cannot be created sessions will not be remembered
+func provisionSessionStore() *state.SessionStore {
+	stateDir, err := provisionStateDirectory()
+
 	if err != nil {
-		return nil, nil, err
+		logging.Component("main").Warn("Session store could not be created, sessions will not be remembered", "error", err)
+		return state.NewSessionStore("")
 	}
 
-	// Create the path to the config directory
-	configDir := filepath.Join(homeDir, config.DEFAULT_CONFIG_DIRECTORY_NAME)
+	return state.NewSessionStore(stateDir)
+}
 
-	// Create the config directory if it does not exist
-	if _, err := os.Stat(configDir); os.IsNotExist(err) {
-		err = os.Mkdir(configDir, os.ModePerm)
+// provisionStateDirectory creates the state directory if it does not already exist and returns its path
+// The outbox and remembered session used to be kept in the config directory, they are moved over unless the state directory already has them
+func provisionStateDirectory() (string, error) {
+	stateDir, err := config.GetStateDirectoryPath()
 
-		if err != nil {
-			return nil, nil, err
-		}
+	if err != nil {
+		return "", err
 	}
 
-	// Check if there are too many log dirEntries and delete the oldest one
-	dirEntries, err := os.ReadDir(configDir)
+	err = os.MkdirAll(stateDir, 0700)
 
 	if err != nil {
-		return nil, nil, err
+		return "", err
 	}
 
-	// Get the config.json file and read it into a new ConfigSettings struct
-	configFilePath := filepath.Join(configDir, config.CONFIG_FILE_NAME)
+	configDir, err := config.GetConfigDirectoryPath()
 
-	configSettings := config.NewConfigSettings()
+	if err != nil || configDir == stateDir {
+		return stateDir, nil
+	}
 
-	// If the file does not exist then create it, otherwise read it into the ConfigSettings struct
-	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
-		bytesToSave, err := json.Marshal(configSettings)
+	// The session and its key are moved together since one cannot be read without the other
+	legacyFiles := [][]string{{config.OUTBOX_FILE_NAME}, {config.SESSION_FILE_NAME, config.SESSION_KEY_FILE_NAME}}
 
-		if err != nil {
-			return nil, nil, err
+	for _, names := range legacyFiles {
+		if _, err := os.Stat(filepath.Join(stateDir, names[0])); err == nil {
+			continue
 		}
 
-		err = os.WriteFile(configFilePath, bytesToSave, 0644)
+		for _, name := range names {
+			err := os.Rename(filepath.Join(configDir, name), filepath.Join(stateDir, name))
 
-		if err != nil {
-			return nil, nil, err
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				logging.Component("main").Warn("File could not be moved to the state directory", "file", name, "error", err)
+			}
 		}
-	} else {
-		configBytes, err := os.ReadFile(configFilePath)
+	}
 
-		if err != nil {
-			return nil, nil, err
-		}
+	return stateDir, nil
+}
 
-		err = json.Unmarshal(configBytes, configSettings)
+// provisionThemes loads the user themes from the themes directory inside the config directory
+// Returns an error for each theme file which could not be loaded
+func provisionThemes() []error {
+	configDir, err := config.GetConfigDirectoryPath()
 
-		if err != nil {
-			return nil, nil, err
-		}
+	if err != nil {
+		return []error{err}
 	}
 
-	if !configSettings.LoggingEnabled {
-		return configSettings, nil, nil
-	}
+	return theme.LoadThemeFiles(filepath.Join(configDir, config.THEMES_DIRECTORY_NAME))
+}
 
-	if len(dirEntries) >= maxNumLogFiles {
-		oldestFile, err := dirEntries[0].Info()
+// watchThemeFiles reloads the user themes whenever a file in the themes directory is added, changed or removed
+func watchThemeFiles(ctx context.Context, registry *theme.Registry, logger *slog.Logger) {
+	configDir, err := config.GetConfigDirectoryPath()
 
-		if err != nil {
-			return nil, nil, err
-		}
+	if err != nil {
+		logger.Warn("Theme files will not be reloaded on change", "error", err)
+		return
+	}
 
-		for _, dirEntry := range dirEntries {
-			file, err := dirEntry.Info()
+	themesDir := filepath.Join(configDir, config.THEMES_DIRECTORY_NAME)
 
-			if err != nil {
-				return nil, nil, err
-			}
+	registry.Watch(ctx, themesDir, themeFilePollInterval, func(errs []error) {
+		logger.Info("Theme files reloaded", "path", themesDir, "errors", len(errs))
 
-			if file.ModTime().Before(oldestFile.ModTime()) {
-				oldestFile = file
-			}
+		for _, err := range errs {
+			logger.Warn("Theme file could not be loaded", "error", err)
 		}
-		err = os.Remove(fmt.Sprintf("%s/%s", config.DEFAULT_CONFIG_DIRECTORY_NAME, oldestFile.Name()))
+	})
+}
 
-		if err != nil {
-			return nil, nil, err
-		}
+// provisionConfigFile creates a config directory in the user's home directory if it does not already exist
+// It will read the config.json file in the config directory and return a ConfigSettings struct with the values from the file
+// If the config file does not exist it is created with the default settings
+func provisionConfigFile() (*config.ConfigSettings, error) {
+	// Get the path to the config directory
+	configDir, err := config.GetConfigDirectoryPath()
+
+	if err != nil {
+		return nil, err
 	}
 
-	logfileName := fmt.Sprintf("broterm_%s.log", time.Now().Format("2006_01_02"))
+	configSettings, err := config.LoadConfigSettings()
 
-	logFilePath := filepath.Join(configDir, logfileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the file does not exist then create it with the defaults
+	if _, err := os.Stat(filepath.Join(configDir, config.CONFIG_FILE_NAME)); os.IsNotExist(err) {
+		err = config.SaveConfigSettings(configSettings)
 
-	file, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return configSettings, file, err
+	return configSettings, nil
 }
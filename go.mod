@@ -10,6 +10,7 @@ retract (
 )
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/dmars8047/brolib v0.1.4
 	github.com/dmars8047/idamlib v0.1.0
 	github.com/dmars8047/strval v1.0.1
@@ -17,6 +18,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.1
 	github.com/rivo/tview v0.0.0-20240307173318-e804876934a1
+	golang.org/x/term v0.18.0
 )
 
 require (
@@ -26,6 +28,5 @@ require (
 	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/net v0.22.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
-	golang.org/x/term v0.18.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
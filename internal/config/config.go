@@ -1,16 +1,368 @@
 package config
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
 const DEFAULT_CONFIG_DIRECTORY_NAME = ".broterm"
+const APPLICATION_DIRECTORY_NAME = "broterm"
 const CONFIG_FILE_NAME = "config.json"
+const OUTBOX_FILE_NAME = "outbox.json"
+const SESSION_FILE_NAME = "session.dat"
+const SESSION_KEY_FILE_NAME = "session.key"
+const LOG_DIRECTORY_NAME = "logs"
+const THEMES_DIRECTORY_NAME = "themes"
 
 type ConfigSettings struct {
-	Theme          string `json:"theme"`
-	LoggingEnabled bool   `json:"logging_enabled"`
+	Version       int                `json:"version"`
+	Theme         string             `json:"theme"`
+	Display       DisplaySettings    `json:"display"`
+	KeyBindings   KeyBindingSettings `json:"keybindings"`
+	Logging       LoggingSettings    `json:"logging"`
+	Server        ServerSettings     `json:"server"`
+	Profiles      []Profile          `json:"profiles,omitempty"`
+	ActiveProfile string             `json:"active_profile,omitempty"`
 }
 
 func NewConfigSettings() *ConfigSettings {
 	return &ConfigSettings{
-		Theme:          "default",
-		LoggingEnabled: true,
+		Version:     CONFIG_SCHEMA_VERSION,
+		Theme:       "default",
+		Display:     NewDisplaySettings(),
+		KeyBindings: NewKeyBindingSettings(),
+		Logging:     NewLoggingSettings(),
+		Server:      NewServerSettings(),
+	}
+}
+
+// configDirectoryOverride replaces the default config directory when set
+var configDirectoryOverride string
+
+// SetConfigDirectoryPath makes the given directory the config directory instead of the default one
+// Logs, the outbox and the remembered session are kept inside it as well so everything stays in the one directory
+// An empty path restores the default
+func SetConfigDirectoryPath(path string) {
+	configDirectoryOverride = path
+}
+
+// GetConfigDirectoryPath returns the path to the config directory, or the directory set with SetConfigDirectoryPath
+// The directory is broterm inside $XDG_CONFIG_HOME, or the platform's user config directory if it is not set
+// An existing ~/.broterm directory keeps being used until the XDG directory exists
+func GetConfigDirectoryPath() (string, error) {
+	if configDirectoryOverride != "" {
+		return configDirectoryOverride, nil
+	}
+
+	configDir, err := xdgDirectoryPath("XDG_CONFIG_HOME", os.UserConfigDir)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(configDir); err == nil {
+		return configDir, nil
+	}
+
+	legacyConfigDir, err := legacyConfigDirectoryPath()
+
+	if err != nil {
+		return "", err
+	}
+
+	if info, err := os.Stat(legacyConfigDir); err == nil && info.IsDir() {
+		return legacyConfigDir, nil
+	}
+
+	return configDir, nil
+}
+
+// GetLogDirectoryPath returns the path to the directory log files are written to, the logs directory inside the state directory
+func GetLogDirectoryPath() (string, error) {
+	stateDir, err := GetStateDirectoryPath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(stateDir, LOG_DIRECTORY_NAME), nil
+}
+
+// GetStateDirectoryPath returns the path to the directory for files the application writes as it runs, such as the outbox and the remembered session
+// The directory is broterm inside $XDG_STATE_HOME, or ~/.local/state on platforms which follow the XDG layout
+// Elsewhere, and when the config directory is overridden or the legacy ~/.broterm directory, the config directory is used
+func GetStateDirectoryPath() (string, error) {
+	configDir, err := GetConfigDirectoryPath()
+
+	if err != nil {
+		return "", err
+	}
+
+	legacyConfigDir, err := legacyConfigDirectoryPath()
+
+	if err != nil {
+		return "", err
+	}
+
+	if configDirectoryOverride != "" || configDir == legacyConfigDir {
+		return configDir, nil
+	}
+
+	stateDir, err := xdgDirectoryPath("XDG_STATE_HOME", func() (string, error) {
+		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" || runtime.GOOS == "plan9" {
+			return "", errors.New("no user state directory")
+		}
+
+		homeDir, err := os.UserHomeDir()
+
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(homeDir, ".local", "state"), nil
+	})
+
+	if err != nil {
+		return configDir, nil
+	}
+
+	return stateDir, nil
+}
+
+// xdgDirectoryPath returns the broterm directory inside the base directory named by the environment variable
+// The fallback provides the base directory if the variable is not set to an absolute path, as the XDG specification requires
+func xdgDirectoryPath(variable string, fallback func() (string, error)) (string, error) {
+	baseDir := os.Getenv(variable)
+
+	if !filepath.IsAbs(baseDir) {
+		var err error
+		baseDir, err = fallback()
+
+		if err != nil {
+			return "", err
+		}
 	}
+
+	return filepath.Join(baseDir, APPLICATION_DIRECTORY_NAME), nil
+}
+
+// legacyConfigDirectoryPath returns the path to the config directory used before XDG base directories were supported
+func legacyConfigDirectoryPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, DEFAULT_CONFIG_DIRECTORY_NAME), nil
+}
+
+// SaveConfigSettings validates the settings and writes them to the config file, creating the config directory if it does not exist
+// The file is replaced atomically so it is never left half written
+func SaveConfigSettings(settings *ConfigSettings) error {
+	settings.Version = CONFIG_SCHEMA_VERSION
+
+	err := settings.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	configDir, err := GetConfigDirectoryPath()
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(configDir, 0700)
+
+	if err != nil {
+		return err
+	}
+
+	bytesToSave, err := json.MarshalIndent(settings, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(filepath.Join(configDir, CONFIG_FILE_NAME), bytesToSave, 0644)
+}
+
+// LoadConfigSettings reads and validates the settings from the config file
+// If the config file does not exist the default settings are returned
+// A config file written with an older schema is migrated and saved, the original is kept as a backup next to it
+// Errors name the file along with the offending line or setting
+func LoadConfigSettings() (*ConfigSettings, error) {
+	settings, migrated, err := readConfigSettings()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = settings.Validate()
+
+	if err != nil {
+		configDir, _ := GetConfigDirectoryPath()
+		return nil, fmt.Errorf("%s: %w", filepath.Join(configDir, CONFIG_FILE_NAME), err)
+	}
+
+	if migrated == 0 {
+		return settings, nil
+	}
+
+	err = SaveConfigSettings(settings)
+
+	if err != nil {
+		return nil, fmt.Errorf("migrated config file could not be saved - %w", err)
+	}
+
+	return settings, nil
+}
+
+// LoadUnvalidatedConfigSettings reads the settings from the config file without validating them
+// It is meant for repairing a config file holding invalid values, the settings must be validated before they are used
+// If the config file does not exist the default settings are returned
+// A config file written with an older schema is migrated in memory, the original is kept as a backup next to it
+func LoadUnvalidatedConfigSettings() (*ConfigSettings, error) {
+	settings, _, err := readConfigSettings()
+
+	return settings, err
+}
+
+// readConfigSettings reads and decodes the settings from the config file without validating them
+// If the config file does not exist the default settings are returned
+// A config file written with an older schema is migrated and a backup of the original is written next to it
+// Returns the version migrated from or 0 if no migration was needed
+func readConfigSettings() (*ConfigSettings, int, error) {
+	configDir, err := GetConfigDirectoryPath()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	configFilePath := filepath.Join(configDir, CONFIG_FILE_NAME)
+
+	configBytes, err := os.ReadFile(configFilePath)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return NewConfigSettings(), 0, nil
+		}
+
+		return nil, 0, err
+	}
+
+	settings, migrated, err := parseConfigSettings(configBytes)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", configFilePath, err)
+	}
+
+	if migrated == 0 {
+		return settings, 0, nil
+	}
+
+	// Keep the file as it was before the migration
+	backupPath := fmt.Sprintf("%s.v%d.bak", configFilePath, migrated)
+
+	err = WriteFileAtomic(backupPath, configBytes, 0644)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("config file backup could not be written before migration - %w", err)
+	}
+
+	return settings, migrated, nil
+}
+
+// parseConfigSettings decodes the content of a config file, migrating it first if it uses an older schema
+// The settings are not validated
+// Returns the version migrated from or 0 if no migration was needed
+func parseConfigSettings(configBytes []byte) (*ConfigSettings, int, error) {
+	var raw map[string]json.RawMessage
+
+	err := json.Unmarshal(configBytes, &raw)
+
+	if err != nil {
+		return nil, 0, describeDecodeError(configBytes, err)
+	}
+
+	if raw == nil {
+		return nil, 0, errors.New("the file must contain a JSON object")
+	}
+
+	version, err := configSchemaVersion(raw)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version > CONFIG_SCHEMA_VERSION {
+		return nil, 0, fmt.Errorf("the file uses config version %d but this version of broterm only understands up to version %d, please upgrade broterm", version, CONFIG_SCHEMA_VERSION)
+	}
+
+	migrated := 0
+
+	if version < CONFIG_SCHEMA_VERSION {
+		err = migrateConfig(raw, version)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		configBytes, err = json.Marshal(raw)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		migrated = version
+	}
+
+	settings, err := decodeConfigSettings(configBytes)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return settings, migrated, nil
+}
+
+// WriteFileAtomic writes the data to a temporary file in the same directory and renames it over the file,
+// so a crash part way through leaves the previous contents intact
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	// Removing fails harmlessly once the file has been renamed
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(data)
+
+	if err == nil {
+		err = tempFile.Sync()
+	}
+
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tempFile.Name(), perm)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), path)
 }
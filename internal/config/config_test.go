@@ -0,0 +1,204 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// useConfigDirectory makes a temporary directory the config directory for the test and writes the config file into it
+func useConfigDirectory(t *testing.T, configJson string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	SetConfigDirectoryPath(dir)
+	t.Cleanup(func() { SetConfigDirectoryPath("") })
+
+	if err := os.WriteFile(filepath.Join(dir, CONFIG_FILE_NAME), []byte(configJson), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestLoadUnvalidatedConfigSettingsRepairsInvalidValues(t *testing.T) {
+	useConfigDirectory(t, `{"version": 2, "display": {"timestamp_format": "bogus"}, "server": {"host": "example.com", "scheme": "https", "port": 99999}}`)
+
+	if _, err := LoadConfigSettings(); err == nil {
+		t.Fatal("LoadConfigSettings() accepted a config holding invalid values")
+	}
+
+	settings, err := LoadUnvalidatedConfigSettings()
+
+	if err != nil {
+		t.Fatalf("LoadUnvalidatedConfigSettings() error = %v", err)
+	}
+
+	if settings.Server.Port != 99999 || settings.Display.TimestampFormat != "bogus" {
+		t.Fatalf("settings = %+v, want the values as they are in the file", settings)
+	}
+
+	if err := SetSetting(settings, "server.port", "8443"); err != nil {
+		t.Fatalf("SetSetting() error = %v", err)
+	}
+
+	// The other invalid value is still there so the result cannot be saved
+	if err := SaveConfigSettings(settings); err == nil || !strings.Contains(err.Error(), "display.timestamp_format") {
+		t.Fatalf("SaveConfigSettings() error = %v, want the remaining invalid value reported", err)
+	}
+
+	if err := SetSetting(settings, "display.timestamp_format", TIMESTAMP_FORMAT_24H); err != nil {
+		t.Fatalf("SetSetting() error = %v", err)
+	}
+
+	if err := SaveConfigSettings(settings); err != nil {
+		t.Fatalf("SaveConfigSettings() error = %v", err)
+	}
+
+	repaired, err := LoadConfigSettings()
+
+	if err != nil {
+		t.Fatalf("LoadConfigSettings() after the repair error = %v", err)
+	}
+
+	if repaired.Server.Port != 8443 || repaired.Display.TimestampFormat != TIMESTAMP_FORMAT_24H {
+		t.Errorf("repaired settings = %+v", repaired)
+	}
+}
+
+func TestLoadUnvalidatedConfigSettingsRejectsMalformedFiles(t *testing.T) {
+	useConfigDirectory(t, `{"version": 2, "theme": `)
+
+	if _, err := LoadUnvalidatedConfigSettings(); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("LoadUnvalidatedConfigSettings() error = %v, want the syntax error", err)
+	}
+}
+
+func TestLoadConfigSettingsMigratesInlineFormatting(t *testing.T) {
+	tests := []struct {
+		name         string
+		display      string
+		wantMarkdown bool
+	}{
+		{"enabled", `{"inline_formatting": true}`, true},
+		{"disabled", `{"inline_formatting": false}`, false},
+		// Written with Markdown support before the version was raised, the newer setting wins
+		{"markdown already set", `{"inline_formatting": true, "markdown": false}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := useConfigDirectory(t, `{"version": 2, "display": `+tt.display+`}`)
+
+			settings, err := LoadConfigSettings()
+
+			if err != nil {
+				t.Fatalf("LoadConfigSettings() error = %v", err)
+			}
+
+			if settings.Display.Markdown != tt.wantMarkdown {
+				t.Errorf("display.markdown = %v, want %v", settings.Display.Markdown, tt.wantMarkdown)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, CONFIG_FILE_NAME+".v2.bak")); err != nil {
+				t.Errorf("backup of the version 2 file was not written - %v", err)
+			}
+
+			saved, err := os.ReadFile(filepath.Join(dir, CONFIG_FILE_NAME))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(saved), "inline_formatting") || !strings.Contains(string(saved), `"version": 3`) {
+				t.Errorf("migrated file was not saved as version 3:\n%s", saved)
+			}
+		})
+	}
+}
+
+func TestDirectoryPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the home directory is not read from $HOME")
+	}
+
+	tests := []struct {
+		name       string
+		existing   []string
+		override   string
+		wantConfig string
+		wantState  string
+	}{
+		{"new install", nil, "", "xdg-config/broterm", "xdg-state/broterm"},
+		{"legacy directory", []string{"home/.broterm"}, "", "home/.broterm", "home/.broterm"},
+		{"both directories", []string{"home/.broterm", "xdg-config/broterm"}, "", "xdg-config/broterm", "xdg-state/broterm"},
+		{"overridden", []string{"home/.broterm"}, "custom", "custom", "custom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+
+			t.Setenv("HOME", filepath.Join(root, "home"))
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "xdg-config"))
+			t.Setenv("XDG_STATE_HOME", filepath.Join(root, "xdg-state"))
+
+			for _, dir := range tt.existing {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tt.override != "" {
+				SetConfigDirectoryPath(filepath.Join(root, tt.override))
+				t.Cleanup(func() { SetConfigDirectoryPath("") })
+			}
+
+			configDir, err := GetConfigDirectoryPath()
+
+			if err != nil || configDir != filepath.Join(root, tt.wantConfig) {
+				t.Errorf("GetConfigDirectoryPath() = %q, %v, want %q", configDir, err, tt.wantConfig)
+			}
+
+			stateDir, err := GetStateDirectoryPath()
+
+			if err != nil || stateDir != filepath.Join(root, tt.wantState) {
+				t.Errorf("GetStateDirectoryPath() = %q, %v, want %q", stateDir, err, tt.wantState)
+			}
+
+			logDir, err := GetLogDirectoryPath()
+
+			if err != nil || logDir != filepath.Join(root, tt.wantState, LOG_DIRECTORY_NAME) {
+				t.Errorf("GetLogDirectoryPath() = %q, %v, want the logs directory inside %q", logDir, err, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestSaveConfigSettingsCreatesPrivateDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not enforced")
+	}
+
+	dir := filepath.Join(t.TempDir(), "broterm")
+
+	SetConfigDirectoryPath(dir)
+	t.Cleanup(func() { SetConfigDirectoryPath("") })
+
+	if err := SaveConfigSettings(NewConfigSettings()); err != nil {
+		t.Fatalf("SaveConfigSettings() error = %v", err)
+	}
+
+	info, err := os.Stat(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("config directory permissions = %o, want only the user to have access", perm)
+	}
+}
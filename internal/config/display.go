@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/dmars8047/broterm/internal/theme"
+)
+
+// The formats chat message timestamps can be shown in
+const (
+	TIMESTAMP_FORMAT_12H      = "12h"
+	TIMESTAMP_FORMAT_24H      = "24h"
+	TIMESTAMP_FORMAT_RELATIVE = "relative"
+)
+
+// DisplaySettings adapt the themes to the terminal and to the needs of the user.
+type DisplaySettings struct {
+	// How many colors are used (auto, truecolor, 256, 16 or monochrome). Auto detects what the terminal supports.
+	ColorMode string `json:"color_mode"`
+	// Whether chat usernames and the connection indicator are shown in colors which stay distinguishable with color blindness.
+	ColorblindSafeLabels bool `json:"colorblind_safe_labels"`
+	// How chat message timestamps are shown (12h, 24h or relative).
+	TimestampFormat string `json:"timestamp_format"`
+	// Whether chat messages are rendered as Markdown rather than shown as written.
+	// **bold**, *italic*, `code`, fenced code blocks, lists and quotes are supported.
+	Markdown bool `json:"markdown"`
+	// Whether fenced code blocks naming a known language are syntax highlighted when Markdown is rendered.
+	SyntaxHighlighting bool `json:"syntax_highlighting"`
+}
+
+// NewDisplaySettings returns the default display settings.
+func NewDisplaySettings() DisplaySettings {
+	return DisplaySettings{
+		ColorMode:          theme.COLOR_MODE_AUTO,
+		TimestampFormat:    TIMESTAMP_FORMAT_12H,
+		SyntaxHighlighting: true,
+	}
+}
+
+// Validate returns a ValidationError naming the first invalid setting.
+func (settings DisplaySettings) Validate() error {
+	if settings.ColorMode != theme.COLOR_MODE_AUTO {
+		if _, err := theme.ParseColorMode(settings.ColorMode); err != nil {
+			return invalidField("color_mode", "must be one of %s, got %q", strings.Join(theme.ColorModeSettings(), ", "), settings.ColorMode)
+		}
+	}
+
+	if !isTimestampFormat(settings.TimestampFormat) {
+		return invalidField("timestamp_format", "must be one of %s, got %q", strings.Join(TimestampFormats(), ", "), settings.TimestampFormat)
+	}
+
+	return nil
+}
+
+// TimestampFormats returns every timestamp format setting
+func TimestampFormats() []string {
+	return []string{TIMESTAMP_FORMAT_12H, TIMESTAMP_FORMAT_24H, TIMESTAMP_FORMAT_RELATIVE}
+}
+
+// isTimestampFormat returns true if the value is one of the timestamp formats
+func isTimestampFormat(value string) bool {
+	for _, format := range TimestampFormats() {
+		if format == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DisplayOptions returns the theme display options for a terminal which can show the given number of colors.
+// The settings must be valid.
+func (settings DisplaySettings) DisplayOptions(terminalColors int) theme.DisplayOptions {
+	colorMode, _ := theme.ResolveColorMode(settings.ColorMode, terminalColors)
+
+	return theme.DisplayOptions{
+		ColorMode:            colorMode,
+		ColorblindSafeLabels: settings.ColorblindSafeLabels,
+	}
+}
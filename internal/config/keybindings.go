@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+)
+
+const (
+	KEYBINDINGS_PRESET_DEFAULT = "default"
+	KEYBINDINGS_PRESET_VIM     = "vim"
+	KEYBINDINGS_PRESET_EMACS   = "emacs"
+)
+
+// KeyBindingSettings choose the keys used to navigate the application.
+type KeyBindingSettings struct {
+	// The set of keys the overrides are applied to (default, vim or emacs).
+	Preset string `json:"preset"`
+	// The keys of actions by action name, for example "back": ["Esc", "Ctrl+Q"]. They replace the preset's keys for the action.
+	Overrides map[string][]string `json:"overrides,omitempty"`
+}
+
+// NewKeyBindingSettings returns the default key binding settings.
+func NewKeyBindingSettings() KeyBindingSettings {
+	return KeyBindingSettings{
+		Preset: KEYBINDINGS_PRESET_DEFAULT,
+	}
+}
+
+// KeyBindingPresets returns the names of every key binding preset
+func KeyBindingPresets() []string {
+	return []string{KEYBINDINGS_PRESET_DEFAULT, KEYBINDINGS_PRESET_VIM, KEYBINDINGS_PRESET_EMACS}
+}
+
+// Validate returns a ValidationError naming the first invalid setting.
+// The action names and keys of the overrides are checked when the keymap is built from them.
+func (settings KeyBindingSettings) Validate() error {
+	for _, preset := range KeyBindingPresets() {
+		if settings.Preset == preset {
+			return nil
+		}
+	}
+
+	return invalidField("preset", "must be one of %s, got %q", strings.Join(KeyBindingPresets(), ", "), settings.Preset)
+}
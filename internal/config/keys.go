@@ -0,0 +1,399 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmars8047/broterm/internal/theme"
+)
+
+// settingKey is a setting which can be read and written by name, for example from the command line
+type settingKey struct {
+	description string
+	get         func(settings *ConfigSettings) string
+	set         func(settings *ConfigSettings, value string) error
+}
+
+// settingKeys holds every setting which can be read and written by name
+// While a profile is active the server and theme settings belong to the profile, matching the application settings page
+var settingKeys = map[string]settingKey{
+	"theme": {
+		description: "The theme code",
+		get: func(settings *ConfigSettings) string {
+			if profile, ok := settings.GetProfile(settings.ActiveProfile); ok && profile.Theme != "" {
+				return profile.Theme
+			}
+
+			return settings.Theme
+		},
+		set: func(settings *ConfigSettings, value string) error {
+			if !theme.IsKnown(value) {
+				return invalidField("theme", "must be one of %s, got %q", strings.Join(theme.Codes(), ", "), value)
+			}
+
+			if profile, ok := settings.GetProfile(settings.ActiveProfile); ok {
+				profile.Theme = value
+			} else {
+				settings.Theme = value
+			}
+
+			return nil
+		},
+	},
+	"display.color_mode": displaySettingKey("How many colors are used (auto, truecolor, 256, 16 or monochrome)",
+		func(display *DisplaySettings) string {
+			return display.ColorMode
+		},
+		func(display *DisplaySettings, value string) error {
+			display.ColorMode = value
+			return nil
+		}),
+	"display.colorblind_safe_labels": displaySettingKey("Whether chat usernames and the connection indicator use colors which stay distinguishable with color blindness (true or false)",
+		func(display *DisplaySettings) string {
+			return strconv.FormatBool(display.ColorblindSafeLabels)
+		},
+		func(display *DisplaySettings, value string) error {
+			enabled, err := strconv.ParseBool(value)
+
+			if err != nil {
+				return fmt.Errorf("display.colorblind_safe_labels must be true or false, got %q", value)
+			}
+
+			display.ColorblindSafeLabels = enabled
+
+			return nil
+		}),
+	"display.timestamp_format": displaySettingKey("How chat message timestamps are shown (12h, 24h or relative)",
+		func(display *DisplaySettings) string {
+			return display.TimestampFormat
+		},
+		func(display *DisplaySettings, value string) error {
+			display.TimestampFormat = value
+			return nil
+		}),
+	"display.markdown": displaySettingKey("Whether chat messages are rendered as Markdown, including code blocks, lists and quotes (true or false)",
+		func(display *DisplaySettings) string {
+			return strconv.FormatBool(display.Markdown)
+		},
+		func(display *DisplaySettings, value string) error {
+			enabled, err := strconv.ParseBool(value)
+
+			if err != nil {
+				return fmt.Errorf("display.markdown must be true or false, got %q", value)
+			}
+
+			display.Markdown = enabled
+
+			return nil
+		}),
+	"display.syntax_highlighting": displaySettingKey("Whether code blocks are syntax highlighted when Markdown is rendered (true or false)",
+		func(display *DisplaySettings) string {
+			return strconv.FormatBool(display.SyntaxHighlighting)
+		},
+		func(display *DisplaySettings, value string) error {
+			enabled, err := strconv.ParseBool(value)
+
+			if err != nil {
+				return fmt.Errorf("display.syntax_highlighting must be true or false, got %q", value)
+			}
+
+			display.SyntaxHighlighting = enabled
+
+			return nil
+		}),
+	"keybindings.preset": {
+		description: "The set of keys used to navigate (default, vim or emacs)",
+		get: func(settings *ConfigSettings) string {
+			return settings.KeyBindings.Preset
+		},
+		set: func(settings *ConfigSettings, value string) error {
+			keyBindings := settings.KeyBindings
+			keyBindings.Preset = value
+
+			err := keyBindings.Validate()
+
+			if err != nil {
+				return withFieldPrefix("keybindings", err)
+			}
+
+			settings.KeyBindings = keyBindings
+
+			return nil
+		},
+	},
+	"logging.enabled": loggingSettingKey("Whether log files are written (true or false)",
+		func(logging *LoggingSettings) string {
+			return strconv.FormatBool(logging.Enabled)
+		},
+		func(logging *LoggingSettings, value string) error {
+			enabled, err := strconv.ParseBool(value)
+
+			if err != nil {
+				return fmt.Errorf("logging.enabled must be true or false, got %q", value)
+			}
+
+			logging.Enabled = enabled
+
+			return nil
+		}),
+	"logging.level": loggingSettingKey("The minimum level written to the log (debug, info, warn or error)",
+		func(logging *LoggingSettings) string {
+			return logging.Level
+		},
+		func(logging *LoggingSettings, value string) error {
+			logging.Level = value
+			return nil
+		}),
+	"logging.format": loggingSettingKey("The format of the log records (text or json)",
+		func(logging *LoggingSettings) string {
+			return logging.Format
+		},
+		func(logging *LoggingSettings, value string) error {
+			logging.Format = value
+			return nil
+		}),
+	"logging.max_file_size_mb": loggingSettingKey("The size in megabytes at which the log file is rotated",
+		func(logging *LoggingSettings) string {
+			return strconv.Itoa(logging.MaxFileSizeMB)
+		},
+		func(logging *LoggingSettings, value string) error {
+			return parseIntSetting("logging.max_file_size_mb", value, &logging.MaxFileSizeMB)
+		}),
+	"logging.max_age_days": loggingSettingKey("Rotated log files older than this many days are deleted, 0 to keep them regardless of age",
+		func(logging *LoggingSettings) string {
+			return strconv.Itoa(logging.MaxAgeDays)
+		},
+		func(logging *LoggingSettings, value string) error {
+			return parseIntSetting("logging.max_age_days", value, &logging.MaxAgeDays)
+		}),
+	"logging.max_files": loggingSettingKey("The number of rotated log files kept",
+		func(logging *LoggingSettings) string {
+			return strconv.Itoa(logging.MaxFiles)
+		},
+		func(logging *LoggingSettings, value string) error {
+			return parseIntSetting("logging.max_files", value, &logging.MaxFiles)
+		}),
+	"active_profile": {
+		description: "The name of the profile used on launch, empty for none",
+		get: func(settings *ConfigSettings) string {
+			return settings.ActiveProfile
+		},
+		set: func(settings *ConfigSettings, value string) error {
+			if _, ok := settings.GetProfile(value); value != "" && !ok {
+				return fmt.Errorf("profile %q does not exist", value)
+			}
+
+			settings.ActiveProfile = value
+
+			return nil
+		},
+	},
+	"server.host": serverSettingKey("The host name or IP address of the server",
+		func(server *ServerSettings) string {
+			return server.Host
+		},
+		func(server *ServerSettings, value string) error {
+			server.Host = value
+			return nil
+		}),
+	"server.scheme": serverSettingKey("The server scheme (https or http)",
+		func(server *ServerSettings) string {
+			return server.Scheme
+		},
+		func(server *ServerSettings, value string) error {
+			server.Scheme = value
+			return nil
+		}),
+	"server.port": serverSettingKey("The server port, 0 for the scheme's default",
+		func(server *ServerSettings) string {
+			return strconv.Itoa(server.Port)
+		},
+		func(server *ServerSettings, value string) error {
+			port, err := strconv.Atoi(value)
+
+			if err != nil {
+				return fmt.Errorf("server.port must be a number, got %q", value)
+			}
+
+			server.Port = port
+
+			return nil
+		}),
+	"server.skip_tls_verify": serverSettingKey("Whether the server certificate is not verified (true or false)",
+		func(server *ServerSettings) string {
+			return strconv.FormatBool(server.SkipTLSVerify)
+		},
+		func(server *ServerSettings, value string) error {
+			skip, err := strconv.ParseBool(value)
+
+			if err != nil {
+				return fmt.Errorf("server.skip_tls_verify must be true or false, got %q", value)
+			}
+
+			server.SkipTLSVerify = skip
+
+			return nil
+		}),
+	"server.ca_path": serverSettingKey("Path to a PEM certificate authority bundle to trust",
+		func(server *ServerSettings) string {
+			return server.CAPath
+		},
+		func(server *ServerSettings, value string) error {
+			server.CAPath = value
+			return nil
+		}),
+}
+
+// serverSettingKey creates a setting key for a field of the active server settings
+// The change is validated before it is applied
+func serverSettingKey(description string, get func(server *ServerSettings) string, set func(server *ServerSettings, value string) error) settingKey {
+	return settingKey{
+		description: description,
+		get: func(settings *ConfigSettings) string {
+			return get(settings.activeServer())
+		},
+		set: func(settings *ConfigSettings, value string) error {
+			server := *settings.activeServer()
+
+			err := set(&server, value)
+
+			if err != nil {
+				return err
+			}
+
+			err = server.Validate()
+
+			if err != nil {
+				return withFieldPrefix("server", err)
+			}
+
+			*settings.activeServer() = server
+
+			return nil
+		},
+	}
+}
+
+// loggingSettingKey creates a setting key for a field of the logging settings
+// The change is validated before it is applied
+func loggingSettingKey(description string, get func(logging *LoggingSettings) string, set func(logging *LoggingSettings, value string) error) settingKey {
+	return settingKey{
+		description: description,
+		get: func(settings *ConfigSettings) string {
+			return get(&settings.Logging)
+		},
+		set: func(settings *ConfigSettings, value string) error {
+			logging := settings.Logging
+
+			err := set(&logging, value)
+
+			if err != nil {
+				return err
+			}
+
+			err = logging.Validate()
+
+			if err != nil {
+				return withFieldPrefix("logging", err)
+			}
+
+			settings.Logging = logging
+
+			return nil
+		},
+	}
+}
+
+// displaySettingKey creates a setting key for a field of the display settings
+// The change is validated before it is applied
+func displaySettingKey(description string, get func(display *DisplaySettings) string, set func(display *DisplaySettings, value string) error) settingKey {
+	return settingKey{
+		description: description,
+		get: func(settings *ConfigSettings) string {
+			return get(&settings.Display)
+		},
+		set: func(settings *ConfigSettings, value string) error {
+			display := settings.Display
+
+			err := set(&display, value)
+
+			if err != nil {
+				return err
+			}
+
+			err = display.Validate()
+
+			if err != nil {
+				return withFieldPrefix("display", err)
+			}
+
+			settings.Display = display
+
+			return nil
+		},
+	}
+}
+
+// parseIntSetting parses the value of the named setting into target
+func parseIntSetting(key, value string, target *int) error {
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		return fmt.Errorf("%s must be a number, got %q", key, value)
+	}
+
+	*target = number
+
+	return nil
+}
+
+// activeServer returns the server settings of the active profile or the top level server settings if no profile is active
+func (settings *ConfigSettings) activeServer() *ServerSettings {
+	if profile, ok := settings.GetProfile(settings.ActiveProfile); ok {
+		return &profile.Server
+	}
+
+	return &settings.Server
+}
+
+// GetSetting returns the value of the named setting
+func GetSetting(settings *ConfigSettings, key string) (string, error) {
+	settingKey, ok := settingKeys[key]
+
+	if !ok {
+		return "", fmt.Errorf("unknown setting %q", key)
+	}
+
+	return settingKey.get(settings), nil
+}
+
+// SetSetting validates and sets the value of the named setting
+func SetSetting(settings *ConfigSettings, key, value string) error {
+	settingKey, ok := settingKeys[key]
+
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+
+	return settingKey.set(settings, value)
+}
+
+// SettingKeys returns the names of every setting in alphabetical order
+func SettingKeys() []string {
+	keys := make([]string, 0, len(settingKeys))
+
+	for key := range settingKeys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// DescribeSetting returns a short description of the named setting
+func DescribeSetting(key string) string {
+	return settingKeys[key].description
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"log/slog"
+)
+
+// LoggingSettings configures the log files written while logging is enabled.
+type LoggingSettings struct {
+	// Whether log files are written at all.
+	Enabled bool `json:"enabled"`
+	// The minimum level written to the log (debug, info, warn or error).
+	Level string `json:"level"`
+	// The format of each log record (text or json).
+	Format string `json:"format"`
+	// The size in megabytes at which the log file is rotated.
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// Rotated log files older than this many days are deleted. Zero keeps them regardless of age.
+	MaxAgeDays int `json:"max_age_days"`
+	// The number of rotated log files kept.
+	MaxFiles int `json:"max_files"`
+}
+
+// NewLoggingSettings returns the default logging settings.
+func NewLoggingSettings() LoggingSettings {
+	return LoggingSettings{
+		Enabled:       true,
+		Level:         "info",
+		Format:        "text",
+		MaxFileSizeMB: 5,
+		MaxAgeDays:    14,
+		MaxFiles:      10,
+	}
+}
+
+// ParseLevel returns the slog level for the configured level.
+func (settings LoggingSettings) ParseLevel() (slog.Level, error) {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(settings.Level))
+
+	if err != nil {
+		return level, invalidField("level", "must be debug, info, warn or error, got %q", settings.Level)
+	}
+
+	return level, nil
+}
+
+// Validate returns a ValidationError naming the first invalid setting.
+func (settings LoggingSettings) Validate() error {
+	if _, err := settings.ParseLevel(); err != nil {
+		return err
+	}
+
+	if settings.Format != "text" && settings.Format != "json" {
+		return invalidField("format", "must be text or json, got %q", settings.Format)
+	}
+
+	if settings.MaxFileSizeMB < 1 {
+		return invalidField("max_file_size_mb", "must be at least 1, got %d", settings.MaxFileSizeMB)
+	}
+
+	if settings.MaxAgeDays < 0 {
+		return invalidField("max_age_days", "must not be negative, got %d", settings.MaxAgeDays)
+	}
+
+	if settings.MaxFiles < 1 {
+		return invalidField("max_files", "must be at least 1, got %d", settings.MaxFiles)
+	}
+
+	return nil
+}
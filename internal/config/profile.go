@@ -0,0 +1,36 @@
+package config
+
+// Profile is a named server, account and theme which can be switched between.
+type Profile struct {
+	// The name the profile is picked by.
+	Name string `json:"name"`
+	// The server the profile connects to.
+	Server ServerSettings `json:"server"`
+	// The email address of the account last used with the profile. Used to pre-fill the login form.
+	Email string `json:"email"`
+	// The theme used while the profile is active. Empty uses the theme from the top level settings.
+	Theme string `json:"theme"`
+}
+
+// GetProfile returns the profile with the given name.
+func (settings *ConfigSettings) GetProfile(name string) (*Profile, bool) {
+	for i := range settings.Profiles {
+		if settings.Profiles[i].Name == name {
+			return &settings.Profiles[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// SetProfile adds the profile or replaces the existing profile with the same name.
+func (settings *ConfigSettings) SetProfile(profile Profile) {
+	existing, ok := settings.GetProfile(profile.Name)
+
+	if ok {
+		*existing = profile
+		return
+	}
+
+	settings.Profiles = append(settings.Profiles, profile)
+}
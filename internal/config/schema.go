@@ -0,0 +1,399 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dmars8047/broterm/internal/theme"
+)
+
+// CONFIG_SCHEMA_VERSION is the version of the config file layout written by this version of the application.
+// Files without a version were written before the schema was versioned and are treated as version 1.
+const CONFIG_SCHEMA_VERSION = 3
+
+// configMigrations upgrade a config file from the version at their index plus one to the next version.
+// They work on the raw JSON object so fields which no longer exist in ConfigSettings can still be read.
+var configMigrations = []func(raw map[string]json.RawMessage) error{
+	migrateConfigV1ToV2,
+	migrateConfigV2ToV3,
+}
+
+// ValidationError describes a setting with an invalid value.
+type ValidationError struct {
+	// The path of the setting, using the JSON field names, for example server.port or profiles[1].name.
+	Field string
+	// What is wrong with the value.
+	Message string
+}
+
+func (err *ValidationError) Error() string {
+	return err.Field + " " + err.Message
+}
+
+// invalidField returns a validation error for the field.
+func invalidField(field string, format string, args ...interface{}) error {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// withFieldPrefix prefixes the field of a validation error with the path of the settings it belongs to.
+// Other errors are returned as they are.
+func withFieldPrefix(prefix string, err error) error {
+	var validationErr *ValidationError
+
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	return &ValidationError{Field: prefix + "." + validationErr.Field, Message: validationErr.Message}
+}
+
+// Validate returns an error naming the first invalid setting.
+// Themes which are not available are not treated as invalid, see ThemeWarnings.
+func (settings *ConfigSettings) Validate() error {
+	if settings.Theme == "" {
+		return invalidField("theme", "must not be empty")
+	}
+
+	if err := settings.Display.Validate(); err != nil {
+		return withFieldPrefix("display", err)
+	}
+
+	if err := settings.KeyBindings.Validate(); err != nil {
+		return withFieldPrefix("keybindings", err)
+	}
+
+	if err := settings.Logging.Validate(); err != nil {
+		return withFieldPrefix("logging", err)
+	}
+
+	if err := settings.Server.Validate(); err != nil {
+		return withFieldPrefix("server", err)
+	}
+
+	names := make(map[string]bool, len(settings.Profiles))
+
+	for i, profile := range settings.Profiles {
+		field := fmt.Sprintf("profiles[%d]", i)
+
+		if profile.Name == "" {
+			return invalidField(field+".name", "must not be empty")
+		}
+
+		if names[profile.Name] {
+			return invalidField(field+".name", "must be unique, %q is used by another profile", profile.Name)
+		}
+
+		names[profile.Name] = true
+
+		if err := profile.Server.Validate(); err != nil {
+			return withFieldPrefix(field+".server", err)
+		}
+	}
+
+	if settings.ActiveProfile != "" && !names[settings.ActiveProfile] {
+		return invalidField("active_profile", "must name one of the profiles, got %q", settings.ActiveProfile)
+	}
+
+	return nil
+}
+
+// ThemeWarnings returns an error for each configured theme which is not available.
+// The default theme is shown in place of a missing theme, so a theme file which was deleted or cannot be loaded does not stop the application from starting.
+// The configured theme is kept and used again once its theme file is back.
+func (settings *ConfigSettings) ThemeWarnings() []error {
+	warnings := make([]error, 0)
+
+	if !theme.IsKnown(settings.Theme) {
+		warnings = append(warnings, invalidField("theme", "is not one of %s, the default theme is used instead, got %q", strings.Join(theme.Codes(), ", "), settings.Theme))
+	}
+
+	for i, profile := range settings.Profiles {
+		if profile.Theme != "" && !theme.IsKnown(profile.Theme) {
+			warnings = append(warnings, invalidField(fmt.Sprintf("profiles[%d].theme", i), "is not one of %s, the default theme is used instead, got %q", strings.Join(theme.Codes(), ", "), profile.Theme))
+		}
+	}
+
+	return warnings
+}
+
+// decodeConfigSettings decodes a config file of the current schema version over the default settings.
+// Unknown fields are rejected so a misspelt setting is reported rather than ignored.
+func decodeConfigSettings(configBytes []byte) (*ConfigSettings, error) {
+	settings := NewConfigSettings()
+
+	decoder := json.NewDecoder(bytes.NewReader(configBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(settings)
+
+	if err != nil {
+		return nil, describeDecodeError(configBytes, err)
+	}
+
+	return settings, nil
+}
+
+// describeDecodeError turns a JSON decoding error into one which points at the offending line or field.
+func describeDecodeError(configBytes []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, column := lineAndColumn(configBytes, syntaxErr.Offset)
+		return fmt.Errorf("syntax error at line %d, column %d: %s", line, column, syntaxErr.Error())
+	case errors.As(err, &typeErr):
+		return invalidField(typeErrorFieldPath(typeErr.Field), "must be a JSON %s, got %s", describeJSONType(typeErr.Type.Kind().String()), typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return invalidField(unknownFieldPath(configBytes, field), "is not a known setting")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("the file ends unexpectedly, check for a missing closing brace or bracket")
+	}
+
+	return err
+}
+
+// typeErrorFieldPath writes the array indexes of the field path of a JSON type error in brackets, as validation errors do.
+// Newer versions of Go write them as path segments, for example profiles.0.name, and older ones leave them out.
+func typeErrorFieldPath(field string) string {
+	segments := strings.Split(field, ".")
+	path := segments[0]
+
+	for _, segment := range segments[1:] {
+		if _, err := strconv.Atoi(segment); err == nil {
+			path += "[" + segment + "]"
+		} else {
+			path += "." + segment
+		}
+	}
+
+	return path
+}
+
+// unknownFieldPath returns the path of the unknown field with the name, for example display.inline_formatting.
+// The JSON decoder only reports the name of an unknown field, so the config file is searched for where it is.
+// If it cannot be found the name is returned as it is.
+func unknownFieldPath(configBytes []byte, name string) string {
+	path, ok := findUnknownField(configBytes, reflect.TypeOf(ConfigSettings{}), name, "")
+
+	if !ok {
+		return name
+	}
+
+	return path
+}
+
+// findUnknownField searches the JSON object decoded into the struct type for a field with the name which the struct does not have.
+// Objects and arrays of objects decoded into nested structs are searched as well.
+func findUnknownField(objectJSON []byte, structType reflect.Type, name string, prefix string) (string, bool) {
+	var object map[string]json.RawMessage
+
+	if json.Unmarshal(objectJSON, &object) != nil {
+		return "", false
+	}
+
+	for key, valueJSON := range object {
+		path := key
+
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		field, ok := structFieldForKey(structType, key)
+
+		if !ok {
+			if key == name {
+				return path, true
+			}
+
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			if path, ok := findUnknownField(valueJSON, field.Type, name, path); ok {
+				return path, true
+			}
+		case reflect.Slice:
+			if field.Type.Elem().Kind() != reflect.Struct {
+				continue
+			}
+
+			var elements []json.RawMessage
+
+			if json.Unmarshal(valueJSON, &elements) != nil {
+				continue
+			}
+
+			for i, elementJSON := range elements {
+				if path, ok := findUnknownField(elementJSON, field.Type.Elem(), name, fmt.Sprintf("%s[%d]", path, i)); ok {
+					return path, true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// structFieldForKey returns the field of the struct type a JSON key is decoded into, matching the key regardless of case as the JSON decoder does.
+func structFieldForKey(structType reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		fieldName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+
+		if strings.EqualFold(fieldName, key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// describeJSONType names the JSON type a Go kind is decoded from.
+func describeJSONType(kind string) string {
+	switch kind {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+		return "number"
+	case "bool":
+		return "boolean (true or false)"
+	case "slice", "array":
+		return "array"
+	case "struct", "map":
+		return "object"
+	}
+
+	return kind
+}
+
+// lineAndColumn returns the one based line and column of the byte offset.
+func lineAndColumn(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+
+	return line, column
+}
+
+// configSchemaVersion returns the schema version of the raw config file.
+func configSchemaVersion(raw map[string]json.RawMessage) (int, error) {
+	versionJSON, ok := raw["version"]
+
+	if !ok {
+		return 1, nil
+	}
+
+	var version int
+
+	err := json.Unmarshal(versionJSON, &version)
+
+	if err != nil || version < 1 {
+		return 0, invalidField("version", "must be a whole number of at least 1, got %s", string(versionJSON))
+	}
+
+	return version, nil
+}
+
+// migrateConfig upgrades the raw config file from the given version to the current one.
+func migrateConfig(raw map[string]json.RawMessage, version int) error {
+	for ; version < CONFIG_SCHEMA_VERSION; version++ {
+		err := configMigrations[version-1](raw)
+
+		if err != nil {
+			return fmt.Errorf("migration from version %d failed - %w", version, err)
+		}
+	}
+
+	versionJSON, _ := json.Marshal(CONFIG_SCHEMA_VERSION)
+	raw["version"] = versionJSON
+
+	return nil
+}
+
+// migrateConfigV1ToV2 moves the top level logging_enabled flag into the logging settings as logging.enabled.
+func migrateConfigV1ToV2(raw map[string]json.RawMessage) error {
+	enabledJSON, ok := raw["logging_enabled"]
+
+	if !ok {
+		return nil
+	}
+
+	delete(raw, "logging_enabled")
+
+	logging := make(map[string]json.RawMessage)
+
+	if loggingJSON, ok := raw["logging"]; ok {
+		err := json.Unmarshal(loggingJSON, &logging)
+
+		if err != nil {
+			return invalidField("logging", "must be a JSON object")
+		}
+	}
+
+	logging["enabled"] = enabledJSON
+
+	loggingJSON, err := json.Marshal(logging)
+
+	if err != nil {
+		return err
+	}
+
+	raw["logging"] = loggingJSON
+
+	return nil
+}
+
+// migrateConfigV2ToV3 replaces display.inline_formatting with display.markdown, which renders the same markers and more.
+// Files written with Markdown support but before the version was raised may already have display.markdown, which is kept.
+func migrateConfigV2ToV3(raw map[string]json.RawMessage) error {
+	displayJSON, ok := raw["display"]
+
+	if !ok {
+		return nil
+	}
+
+	display := make(map[string]json.RawMessage)
+
+	err := json.Unmarshal(displayJSON, &display)
+
+	if err != nil {
+		return invalidField("display", "must be a JSON object")
+	}
+
+	inlineFormattingJSON, ok := display["inline_formatting"]
+
+	if !ok {
+		return nil
+	}
+
+	delete(display, "inline_formatting")
+
+	if _, ok := display["markdown"]; !ok {
+		display["markdown"] = inlineFormattingJSON
+	}
+
+	displayJSON, err = json.Marshal(display)
+
+	if err != nil {
+		return err
+	}
+
+	raw["display"] = displayJSON
+
+	return nil
+}
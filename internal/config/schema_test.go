@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateNamesInvalidField(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(settings *ConfigSettings)
+		wantField string
+	}{
+		{"display", func(s *ConfigSettings) { s.Display.TimestampFormat = "bogus" }, "display.timestamp_format"},
+		{"keybindings", func(s *ConfigSettings) { s.KeyBindings.Preset = "bogus" }, "keybindings.preset"},
+		{"logging", func(s *ConfigSettings) { s.Logging.MaxFiles = 0 }, "logging.max_files"},
+		{"server", func(s *ConfigSettings) { s.Server.Port = 70000 }, "server.port"},
+		{"profile name", func(s *ConfigSettings) { s.Profiles = []Profile{{Server: NewServerSettings()}} }, "profiles[0].name"},
+		{"duplicate profile name", func(s *ConfigSettings) {
+			s.Profiles = []Profile{{Name: "work", Server: NewServerSettings()}, {Name: "work", Server: NewServerSettings()}}
+		}, "profiles[1].name"},
+		{"profile server", func(s *ConfigSettings) {
+			s.Profiles = []Profile{{Name: "work", Server: ServerSettings{Host: "example.com", Scheme: "ftp"}}}
+		}, "profiles[0].server.scheme"},
+		{"active profile", func(s *ConfigSettings) { s.ActiveProfile = "missing" }, "active_profile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := NewConfigSettings()
+			tt.change(settings)
+
+			var validationErr *ValidationError
+
+			if err := settings.Validate(); !errors.As(err, &validationErr) || validationErr.Field != tt.wantField {
+				t.Errorf("Validate() error = %v, want an error for %s", err, tt.wantField)
+			}
+		})
+	}
+
+	if err := NewConfigSettings().Validate(); err != nil {
+		t.Errorf("Validate() of the default settings error = %v", err)
+	}
+}
+
+func TestParseConfigSettingsNamesDecodeErrorField(t *testing.T) {
+	tests := []struct {
+		name       string
+		configJson string
+		wantField  string
+	}{
+		{"unknown top level field", `{"version": 3, "colour": "red"}`, "colour"},
+		{"unknown nested field", `{"version": 3, "display": {"markdown": true, "inline_formatting": true}}`, "display.inline_formatting"},
+		{"unknown profile field", `{"version": 3, "profiles": [{"name": "a"}, {"name": "b", "server": {"hostname": "x"}}]}`, "profiles[1].server.hostname"},
+		{"wrong type", `{"version": 3, "server": {"port": "443"}}`, "server.port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validationErr *ValidationError
+
+			if _, _, err := parseConfigSettings([]byte(tt.configJson)); !errors.As(err, &validationErr) || validationErr.Field != tt.wantField {
+				t.Errorf("parseConfigSettings() error = %v, want an error for %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSettingsMigratesVersion1(t *testing.T) {
+	original := `{"theme": "default", "logging_enabled": true, "logging": {"level": "debug"}}`
+	dir := useConfigDirectory(t, original)
+
+	settings, err := LoadConfigSettings()
+
+	if err != nil {
+		t.Fatalf("LoadConfigSettings() error = %v", err)
+	}
+
+	if !settings.Logging.Enabled || settings.Logging.Level != "debug" {
+		t.Errorf("logging = %+v, want logging_enabled moved in next to the level", settings.Logging)
+	}
+
+	backup, err := os.ReadFile(filepath.Join(dir, CONFIG_FILE_NAME+".v1.bak"))
+
+	if err != nil {
+		t.Fatalf("backup of the version 1 file was not written - %v", err)
+	}
+
+	if string(backup) != original {
+		t.Errorf("backup = %s, want the original file", backup)
+	}
+
+	// The saved file is read without migrating again
+	if _, migrated, err := readConfigSettings(); err != nil || migrated != 0 {
+		t.Errorf("readConfigSettings() after the migration = %d, %v, want the current version", migrated, err)
+	}
+}
+
+func TestLoadConfigSettingsRejectsNewerVersions(t *testing.T) {
+	useConfigDirectory(t, `{"version": 99}`)
+
+	if _, err := LoadConfigSettings(); err == nil {
+		t.Error("LoadConfigSettings() accepted a config file from a newer version")
+	}
+}
+
+func TestTypeErrorFieldPath(t *testing.T) {
+	tests := map[string]string{
+		"server.port":            "server.port",
+		"profiles.name":          "profiles.name",
+		"profiles.1.server.port": "profiles[1].server.port",
+	}
+
+	for field, want := range tests {
+		if got := typeErrorFieldPath(field); got != want {
+			t.Errorf("typeErrorFieldPath(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestMissingThemesAreWarnings(t *testing.T) {
+	settings := NewConfigSettings()
+	settings.Theme = "deleted"
+	settings.Profiles = []Profile{{Name: "work", Server: NewServerSettings(), Theme: "default"}, {Name: "home", Server: NewServerSettings(), Theme: "broken"}}
+
+	if err := settings.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want missing themes allowed", err)
+	}
+
+	warnings := settings.ThemeWarnings()
+	wantFields := []string{"theme", "profiles[1].theme"}
+
+	if len(warnings) != len(wantFields) {
+		t.Fatalf("ThemeWarnings() = %v, want one for each of %v", warnings, wantFields)
+	}
+
+	for i, warning := range warnings {
+		var validationErr *ValidationError
+
+		if !errors.As(warning, &validationErr) || validationErr.Field != wantFields[i] {
+			t.Errorf("ThemeWarnings()[%d] = %v, want a warning for %s", i, warning, wantFields[i])
+		}
+	}
+
+	if warnings := NewConfigSettings().ThemeWarnings(); len(warnings) != 0 {
+		t.Errorf("ThemeWarnings() of the default settings = %v", warnings)
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_SERVER_HOST = "dev.marshall-labs.com"
+const DEFAULT_SERVER_SCHEME = "https"
+
+// ServerSettings describes how to reach the BroChat server.
+type ServerSettings struct {
+	// The host name or IP address of the server.
+	Host string `json:"host"`
+	// Either https or http. The feed uses wss or ws to match.
+	Scheme string `json:"scheme"`
+	// The port of the server. Zero uses the default port for the scheme.
+	Port int `json:"port"`
+	// Skips verification of the server's certificate. Only meant for development servers.
+	SkipTLSVerify bool `json:"skip_tls_verify"`
+	// Path to a PEM encoded certificate authority bundle trusted in addition to the system roots.
+	CAPath string `json:"ca_path"`
+}
+
+// NewServerSettings returns the settings for the public BroChat server.
+func NewServerSettings() ServerSettings {
+	return ServerSettings{
+		Host:   DEFAULT_SERVER_HOST,
+		Scheme: DEFAULT_SERVER_SCHEME,
+	}
+}
+
+// Validate returns a ValidationError naming the first invalid setting.
+func (settings ServerSettings) Validate() error {
+	if settings.Host == "" {
+		return invalidField("host", "must not be empty")
+	}
+
+	if settings.Scheme != "https" && settings.Scheme != "http" {
+		return invalidField("scheme", "must be https or http, got %q", settings.Scheme)
+	}
+
+	if settings.Port < 0 || settings.Port > 65535 {
+		return invalidField("port", "must be between 1 and 65535 or 0 for the default port, got %d", settings.Port)
+	}
+
+	return nil
+}
+
+// Address returns the host and, if set, the port of the server.
+func (settings ServerSettings) Address() string {
+	if settings.Port == 0 {
+		return settings.Host
+	}
+
+	return net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port))
+}
+
+// BaseUrl returns the base url for http requests to the server.
+func (settings ServerSettings) BaseUrl() string {
+	return settings.Scheme + "://" + settings.Address()
+}
+
+// FeedScheme returns the websocket scheme matching the server's scheme.
+func (settings ServerSettings) FeedScheme() string {
+	if settings.Scheme == "http" {
+		return "ws"
+	}
+
+	return "wss"
+}
+
+// TLSConfig builds the TLS configuration used to connect to the server.
+// Returns nil if the default configuration should be used.
+func (settings ServerSettings) TLSConfig() (*tls.Config, error) {
+	if !settings.SkipTLSVerify && settings.CAPath == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: settings.SkipTLSVerify,
+	}
+
+	if settings.CAPath != "" {
+		caBytes, err := os.ReadFile(settings.CAPath)
+
+		if err != nil {
+			return nil, fmt.Errorf("certificate authority file could not be read - %w", err)
+		}
+
+		rootCAs, err := x509.SystemCertPool()
+
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+
+		if !rootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in certificate authority file %s", settings.CAPath)
+		}
+
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	return tlsConfig, nil
+}
+
+// WithAddress returns a copy of the settings pointing at the address.
+// The address is a host, host:port or scheme://host[:port] url. Parts which are not given keep their current values,
+// except for the port which is reset when only a host is given.
+func (settings ServerSettings) WithAddress(address string) (ServerSettings, error) {
+	if strings.Contains(address, "://") {
+		serverUrl, err := url.Parse(address)
+
+		if err != nil {
+			return settings, err
+		}
+
+		settings.Scheme = serverUrl.Scheme
+		address = serverUrl.Host
+	}
+
+	host, portText, err := net.SplitHostPort(address)
+
+	if err != nil {
+		// No port was given
+		settings.Host = address
+		settings.Port = 0
+	} else {
+		port, err := strconv.Atoi(portText)
+
+		if err != nil {
+			return settings, fmt.Errorf("server port must be a number, got %q", portText)
+		}
+
+		settings.Host = host
+		settings.Port = port
+	}
+
+	return settings, settings.Validate()
+}
@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dmars8047/broterm/internal/config"
+)
+
+// root is the handler every component logger writes through. It is swapped when logging is configured.
+var root atomic.Pointer[slog.Handler]
+
+// current is the writer behind the root handler, closed when logging is reconfigured.
+var current struct {
+	dir    string
+	writer io.Closer
+	mu     sync.Mutex
+}
+
+func init() {
+	setRoot(slog.NewTextHandler(io.Discard, nil))
+
+	// Anything still using the log package or the default slog logger is routed through the root handler.
+	// Records from the log package are recorded at the info level.
+	slog.SetDefault(slog.New(&componentHandler{}))
+}
+
+// Setup directs logging to a rotating log file in the given directory using the settings.
+// If logging is not enabled all logging is discarded. The directory is remembered for Reconfigure.
+func Setup(dir string, settings config.LoggingSettings) error {
+	current.mu.Lock()
+	current.dir = dir
+	current.mu.Unlock()
+
+	return Reconfigure(settings)
+}
+
+// Reconfigure applies new settings to the log directory given to Setup. Records logged while switching may be lost.
+func Reconfigure(settings config.LoggingSettings) error {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	if !settings.Enabled {
+		setRoot(slog.NewTextHandler(io.Discard, nil))
+		closeWriter()
+		return nil
+	}
+
+	err := settings.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	level, _ := settings.ParseLevel()
+
+	writer, err := newRotatingWriter(current.dir, settings)
+
+	if err != nil {
+		return err
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+
+	if settings.Format == "json" {
+		handler = slog.NewJSONHandler(writer, options)
+	} else {
+		handler = slog.NewTextHandler(writer, options)
+	}
+
+	setRoot(handler)
+	closeWriter()
+	current.writer = writer
+
+	return nil
+}
+
+// Close closes the log file. Anything logged afterwards is discarded.
+func Close() {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	setRoot(slog.NewTextHandler(io.Discard, nil))
+	closeWriter()
+}
+
+// Path returns the path of the active log file or an empty string if logging is disabled.
+func Path() string {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	if writer, ok := current.writer.(*rotatingWriter); ok {
+		return writer.path()
+	}
+
+	return ""
+}
+
+// Component returns a logger whose records carry the component name.
+// Component loggers may be created before logging is configured, they always write through the current configuration.
+func Component(name string) *slog.Logger {
+	return slog.New(&componentHandler{}).With("component", name)
+}
+
+// closeWriter closes the current writer. Must be called with the lock held.
+func closeWriter() {
+	if current.writer != nil {
+		current.writer.Close()
+		current.writer = nil
+	}
+}
+
+// setRoot makes the handler the root handler.
+func setRoot(handler slog.Handler) {
+	root.Store(&handler)
+}
+
+// componentHandler forwards records to whichever root handler is current when they are logged.
+type componentHandler struct {
+	// Applied in order to the root handler before each record is handled
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *componentHandler) resolve() slog.Handler {
+	handler := *root.Load()
+
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+
+	return handler
+}
+
+// Enabled reports whether the root handler handles records at the level.
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return (*root.Load()).Enabled(ctx, level)
+}
+
+// Handle passes the record to the root handler with the component's attributes and groups.
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.resolve().Handle(ctx, record)
+}
+
+// WithAttrs returns a handler which adds the attributes to every record.
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler {
+		return handler.WithAttrs(attrs)
+	})
+}
+
+// WithGroup returns a handler which nests subsequent attributes in the group.
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler {
+		return handler.WithGroup(name)
+	})
+}
+
+func (h *componentHandler) with(op func(slog.Handler) slog.Handler) *componentHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+
+	return &componentHandler{ops: append(ops, op)}
+}
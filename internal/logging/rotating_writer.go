@@ -0,0 +1,189 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmars8047/broterm/internal/config"
+)
+
+const (
+	logFileName = "broterm.log"
+	// Rotated log files are named broterm-<timestamp>.log so they sort oldest first
+	rotatedLogFilePrefix = "broterm-"
+	rotatedLogFileSuffix = ".log"
+	rotatedLogFileLayout = "20060102T150405.000"
+)
+
+// rotatingWriter writes to a log file which is rotated once it reaches the maximum size.
+// Rotated files beyond the maximum count or older than the maximum age are deleted.
+type rotatingWriter struct {
+	dir      string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	file     *os.File
+	size     int64
+	mu       sync.Mutex
+}
+
+// newRotatingWriter opens the log file in the directory, creating the directory if needed, and prunes old rotated files.
+func newRotatingWriter(dir string, settings config.LoggingSettings) (*rotatingWriter, error) {
+	err := os.MkdirAll(dir, 0700)
+
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &rotatingWriter{
+		dir:      dir,
+		maxSize:  int64(settings.MaxFileSizeMB) * 1024 * 1024,
+		maxAge:   time.Duration(settings.MaxAgeDays) * 24 * time.Hour,
+		maxFiles: settings.MaxFiles,
+	}
+
+	err = writer.open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	writer.prune()
+
+	return writer, nil
+}
+
+// path returns the path of the active log file.
+func (writer *rotatingWriter) path() string {
+	return filepath.Join(writer.dir, logFileName)
+}
+
+// Write writes to the log file, rotating it first if the write would take it past the maximum size.
+func (writer *rotatingWriter) Write(p []byte) (int, error) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if writer.size > 0 && writer.size+int64(len(p)) > writer.maxSize {
+		if err := writer.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := writer.file.Write(p)
+	writer.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the log file.
+func (writer *rotatingWriter) Close() error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.file == nil {
+		return nil
+	}
+
+	err := writer.file.Close()
+	writer.file = nil
+
+	return err
+}
+
+// open opens the log file for appending. Must be called with the lock held or before the writer is shared.
+func (writer *rotatingWriter) open() error {
+	file, err := os.OpenFile(writer.path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	writer.file = file
+	writer.size = info.Size()
+
+	return nil
+}
+
+// rotate renames the log file with the current time, opens a new one and prunes old rotated files. Must be called with the lock held.
+func (writer *rotatingWriter) rotate() error {
+	err := writer.file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	writer.file = nil
+
+	rotatedName := rotatedLogFilePrefix + time.Now().Format(rotatedLogFileLayout) + rotatedLogFileSuffix
+
+	err = os.Rename(writer.path(), filepath.Join(writer.dir, rotatedName))
+
+	if err != nil {
+		return fmt.Errorf("log file could not be rotated - %w", err)
+	}
+
+	err = writer.open()
+
+	if err != nil {
+		return err
+	}
+
+	writer.prune()
+
+	return nil
+}
+
+// prune deletes the rotated log files beyond the maximum count or older than the maximum age.
+// Only rotated log files are considered, nothing else in the directory is touched.
+func (writer *rotatingWriter) prune() {
+	entries, err := os.ReadDir(writer.dir)
+
+	if err != nil {
+		return
+	}
+
+	rotated := make([]os.DirEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.Type().IsRegular() && strings.HasPrefix(name, rotatedLogFilePrefix) && strings.HasSuffix(name, rotatedLogFileSuffix) {
+			rotated = append(rotated, entry)
+		}
+	}
+
+	// Newest first
+	sort.Slice(rotated, func(i, j int) bool {
+		return rotated[i].Name() > rotated[j].Name()
+	})
+
+	for i, entry := range rotated {
+		expired := false
+
+		if writer.maxAge > 0 {
+			if info, err := entry.Info(); err == nil {
+				expired = time.Since(info.ModTime()) > writer.maxAge
+			}
+		}
+
+		if i >= writer.maxFiles || expired {
+			os.Remove(filepath.Join(writer.dir, entry.Name()))
+		}
+	}
+}
@@ -7,9 +7,31 @@ import (
 	"time"
 
 	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/logging"
 	"github.com/dmars8047/broterm/internal/theme"
 )
 
+const (
+	// How long before the access token expires a refresh is attempted
+	tokenRefreshLeadTime = 2 * time.Minute
+	// How long before the access token expires a session which cannot be refreshed is ended,
+	// so the user is sent to log in again rather than having requests fail once the token has expired
+	sessionEndLeadTime = 30 * time.Second
+	// Bounds for the delay between failed token refresh attempts
+	minTokenRefreshRetryWait = 5 * time.Second
+	maxTokenRefreshRetryWait = 30 * time.Second
+)
+
+// sessionLogger logs the lifecycle of the user session
+var sessionLogger = logging.Component("session")
+
+// TokenRefresher obtains new authentication for the logged in user before the current access token expires.
+type TokenRefresher func() (UserAuth, error)
+
+// ErrRefreshUnavailable is returned by a TokenRefresher which can no longer refresh the session.
+// No more refreshes are attempted and the session ends shortly before the current token expires.
+var ErrRefreshUnavailable = errors.New("the session can no longer be refreshed")
+
 // ApplicationContext is the context for the application
 // It manages the context (lifetime) for the user and chat sessions
 // It also contains references to the logged in user and their authentication information.
@@ -21,29 +43,39 @@ type ApplicationContext struct {
 	mut               sync.RWMutex
 	monitoringContext context.Context
 	cancelMonitoring  context.CancelFunc
-	theme             *theme.Theme
+	themeRegistry     *theme.Registry
+	authRefreshBus    *eventBus[UserAuth]
 }
 
 func NewApplicationContext(context context.Context, themeCode string) *ApplicationContext {
 	return &ApplicationContext{
-		Context: context,
-		theme:   theme.NewTheme(themeCode),
+		Context:        context,
+		themeRegistry:  theme.NewRegistry(themeCode),
+		authRefreshBus: newEventBus[UserAuth]("auth refresh", 1, OVERFLOW_POLICY_DROP_OLDEST),
 	}
 }
 
 func (appContext *ApplicationContext) GetTheme() theme.Theme {
-	appContext.mut.RLock()
-	defer appContext.mut.RUnlock()
-	return *appContext.theme
+	return appContext.themeRegistry.Current()
 }
 
 func (appContext *ApplicationContext) SetTheme(themeName string) {
-	appContext.mut.Lock()
-	defer appContext.mut.Unlock()
-	appContext.theme = theme.NewTheme(themeName)
+	appContext.themeRegistry.SetCurrent(themeName)
+}
+
+// GetThemeRegistry returns the registry holding the active theme. Subscribe to it to restyle the UI when the theme changes.
+func (appContext *ApplicationContext) GetThemeRegistry() *theme.Registry {
+	return appContext.themeRegistry
 }
 
 func (appContext *ApplicationContext) GetBrochatUser() chat.User {
+	appContext.mut.RLock()
+	defer appContext.mut.RUnlock()
+
+	if appContext.brochatUser == nil {
+		return chat.User{}
+	}
+
 	return *appContext.brochatUser
 }
 
@@ -84,9 +116,10 @@ func (appContext *ApplicationContext) GetAccessToken() (string, bool) {
 // SetUserSession sets the user session.
 // This will cancel the previous user session if it exists.
 // It will also create a new context for the user session.
-// The user session will be cancelled after the token expires.
-// The redirect function will be called when the token expires in a separate goroutine.
-func (appContext *ApplicationContext) SetUserSession(auth UserAuth, redirect func()) {
+// Shortly before the token expires the refresh function is used to obtain new authentication which is swapped into the session
+// without cancelling its context. If refresh is nil or keeps failing the user session will be cancelled shortly before the token expires.
+// The redirect function will be called when the user session is cancelled for this reason, in a separate goroutine.
+func (appContext *ApplicationContext) SetUserSession(auth UserAuth, refresh TokenRefresher, redirect func()) {
 	appContext.mut.Lock()
 	defer appContext.mut.Unlock()
 
@@ -104,16 +137,88 @@ func (appContext *ApplicationContext) SetUserSession(auth UserAuth, redirect fun
 
 	appContext.monitoringContext, appContext.cancelMonitoring = context.WithCancel(userSessionContext)
 
-	go func() {
+	go appContext.monitorUserSession(appContext.monitoringContext, auth.TokenExpiration, refresh, redirect)
+}
+
+// monitorUserSession keeps the user session's access token fresh until the monitoring context is done.
+// If the token is about to expire and could not be refreshed the redirect function is called and the user session is cancelled.
+func (appContext *ApplicationContext) monitorUserSession(monitoringContext context.Context, tokenExpiration time.Time, refresh TokenRefresher, redirect func()) {
+	retryBackoff := newBackoff(minTokenRefreshRetryWait, maxTokenRefreshRetryWait)
+	refreshAt := tokenExpiration.Add(-tokenRefreshLeadTime)
+
+	for {
+		endAt := tokenExpiration.Add(-sessionEndLeadTime)
+		wait := time.Until(endAt)
+
+		if refresh != nil && refreshAt.Before(endAt) {
+			wait = time.Until(refreshAt)
+		}
+
 		select {
-		case <-appContext.monitoringContext.Done():
+		case <-monitoringContext.Done():
 			return
-		case <-time.After(time.Until(appContext.userSession.Auth.TokenExpiration)):
+		case <-time.After(wait):
+		}
+
+		if refresh == nil || !time.Now().Before(endAt) {
 			redirect()
 			appContext.CancelUserSession()
 			return
 		}
-	}()
+
+		auth, err := refresh()
+
+		if errors.Is(err, ErrRefreshUnavailable) {
+			sessionLogger.Info("Access token can no longer be refreshed, the session ends before it expires", "expires_at", tokenExpiration.Format(time.RFC3339))
+			refresh = nil
+			continue
+		}
+
+		if err != nil {
+			sessionLogger.Warn("Access token refresh failed", "error", err)
+			refreshAt = time.Now().Add(retryBackoff.next())
+			continue
+		}
+
+		if !appContext.swapUserAuth(monitoringContext, auth) {
+			return
+		}
+
+		sessionLogger.Info("Access token refreshed", "expires_at", auth.TokenExpiration.Format(time.RFC3339))
+
+		retryBackoff.reset()
+		tokenExpiration = auth.TokenExpiration
+		refreshAt = tokenExpiration.Add(-tokenRefreshLeadTime)
+	}
+}
+
+// swapUserAuth replaces the authentication of the user session being monitored and notifies auth refresh subscribers.
+// Returns false if the monitored user session has since ended or been replaced.
+func (appContext *ApplicationContext) swapUserAuth(monitoringContext context.Context, auth UserAuth) bool {
+	appContext.mut.Lock()
+
+	if appContext.userSession == nil || appContext.monitoringContext != monitoringContext || monitoringContext.Err() != nil {
+		appContext.mut.Unlock()
+		return false
+	}
+
+	appContext.userSession.Auth = auth
+	appContext.mut.Unlock()
+
+	appContext.authRefreshBus.publish(auth)
+
+	return true
+}
+
+// SubscribeToAuthRefresh subscribes to access token refreshes and returns a channel to receive the new authentication on.
+// Slow readers only ever see the latest authentication.
+func (appContext *ApplicationContext) SubscribeToAuthRefresh() (string, <-chan UserAuth) {
+	return appContext.authRefreshBus.subscribe()
+}
+
+// UnsubscribeFromAuthRefresh unsubscribes from access token refreshes.
+func (appContext *ApplicationContext) UnsubscribeFromAuthRefresh(id string) {
+	appContext.authRefreshBus.unsubscribe(id)
 }
 
 // GenerateUserSessionBoundContextWithCancel generates a new context with cancel function that is bound to the lifetime of the user session.
@@ -131,6 +236,20 @@ func (appContext *ApplicationContext) GenerateUserSessionBoundContextWithCancel(
 	return ctx, cancel
 }
 
+// UserSessionDone returns a channel which is closed when the user session ends. It is already closed if there is no user session.
+func (appContext *ApplicationContext) UserSessionDone() <-chan struct{} {
+	appContext.mut.RLock()
+	defer appContext.mut.RUnlock()
+
+	if appContext.userSession == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	return appContext.userSession.context.Done()
+}
+
 // CancelUserSession cancels the user session
 // This will cancel the context and set the user session to nil
 // Calling this method before the user session is set will do nothing
@@ -0,0 +1,71 @@
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUserSessionEndsBeforeTokenExpires(t *testing.T) {
+	tests := []struct {
+		name    string
+		refresh TokenRefresher
+	}{
+		{"without refresh", nil},
+		{"refresh unavailable", func() (UserAuth, error) { return UserAuth{}, ErrRefreshUnavailable }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appContext := NewApplicationContext(context.Background(), "default")
+			redirected := make(chan struct{})
+
+			expiration := time.Now().Add(sessionEndLeadTime + 200*time.Millisecond)
+			appContext.SetUserSession(UserAuth{AccessToken: "token", TokenExpiration: expiration}, tt.refresh, func() { close(redirected) })
+
+			select {
+			case <-redirected:
+			case <-time.After(5 * time.Second):
+				t.Fatal("user was not redirected")
+			}
+
+			if time.Until(expiration) < sessionEndLeadTime-time.Second {
+				t.Errorf("session ended %v before the token expired, want about %v", time.Until(expiration), sessionEndLeadTime)
+			}
+
+			select {
+			case <-appContext.UserSessionDone():
+			case <-time.After(5 * time.Second):
+				t.Fatal("user session was not cancelled")
+			}
+		})
+	}
+}
+
+func TestUserSessionRefreshesToken(t *testing.T) {
+	appContext := NewApplicationContext(context.Background(), "default")
+	refreshed := UserAuth{AccessToken: "refreshed", TokenExpiration: time.Now().Add(time.Hour)}
+
+	id, auths := appContext.SubscribeToAuthRefresh()
+	defer appContext.UnsubscribeFromAuthRefresh(id)
+
+	// The token is within the refresh lead time so it is refreshed straight away
+	appContext.SetUserSession(UserAuth{AccessToken: "token", TokenExpiration: time.Now().Add(time.Minute)}, func() (UserAuth, error) {
+		return refreshed, nil
+	}, func() { t.Error("user was redirected") })
+
+	defer appContext.CancelUserSession()
+
+	select {
+	case auth := <-auths:
+		if auth != refreshed {
+			t.Errorf("refreshed auth = %+v, want %+v", auth, refreshed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("token was not refreshed")
+	}
+
+	if token, ok := appContext.GetAccessToken(); !ok || token != "refreshed" {
+		t.Errorf("GetAccessToken() = %q, %v, want the refreshed token", token, ok)
+	}
+}
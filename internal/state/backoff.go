@@ -0,0 +1,49 @@
+package state
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// backoff produces jittered, exponentially increasing delays for reconnection attempts.
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	factor  float64
+	attempt int
+}
+
+// newBackoff creates a new backoff starting at min and capped at max.
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{
+		min:    min,
+		max:    max,
+		factor: 2,
+	}
+}
+
+// next returns the delay to wait before the next attempt and advances the attempt counter.
+// The returned delay is somewhere between half and all of the current exponential step so that
+// many clients dropped at the same moment do not all reconnect in lockstep.
+func (b *backoff) next() time.Duration {
+	step := float64(b.min)
+
+	for i := 0; i < b.attempt && step < float64(b.max); i++ {
+		step *= b.factor
+	}
+
+	if step > float64(b.max) {
+		step = float64(b.max)
+	}
+
+	b.attempt++
+
+	half := step / 2
+
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// reset sets the backoff back to its initial delay. Call after a successful attempt.
+func (b *backoff) reset() {
+	b.attempt = 0
+}
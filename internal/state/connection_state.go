@@ -0,0 +1,93 @@
+package state
+
+import (
+	"time"
+)
+
+// ConnectionStatus describes the health of the feed connection.
+type ConnectionStatus uint8
+
+const (
+	// The feed is not connected and no attempt to connect is being made.
+	CONNECTION_STATUS_DISCONNECTED ConnectionStatus = iota
+	// The initial connection to the feed is being established.
+	CONNECTION_STATUS_CONNECTING
+	// The feed is connected.
+	CONNECTION_STATUS_CONNECTED
+	// The feed connection dropped and is being re-established.
+	CONNECTION_STATUS_RECONNECTING
+)
+
+// String returns a human readable name for the connection status.
+func (status ConnectionStatus) String() string {
+	switch status {
+	case CONNECTION_STATUS_CONNECTING:
+		return "Connecting"
+	case CONNECTION_STATUS_CONNECTED:
+		return "Connected"
+	case CONNECTION_STATUS_RECONNECTING:
+		return "Reconnecting"
+	default:
+		return "Disconnected"
+	}
+}
+
+// ConnectionState is a snapshot of the feed connection's health.
+type ConnectionState struct {
+	// The current status of the connection.
+	Status ConnectionStatus
+	// Why the connection was lost or could not be established. Empty when connected.
+	Reason string
+	// The number of reconnection attempts made since the connection was lost.
+	Attempt int
+	// The round trip time of the most recent ping.
+	Latency time.Duration
+	// When the last message was recieved from the server.
+	LastMessageAt time.Time
+}
+
+// SubscribeToConnectionState subscribes to connection state changes and returns a channel to receive them on.
+// The current state is delivered immediately. Slow readers only ever see the latest state.
+// Unlike the feed subscriptions, connection state subscriptions outlive the user session and are only closed when unsubscribed.
+func (c *FeedClient) SubscribeToConnectionState() (string, <-chan ConnectionState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.connectionStateBus.subscribeWith(c.connectionState)
+}
+
+// UnsubscribeFromConnectionState unsubscribes from connection state changes.
+func (c *FeedClient) UnsubscribeFromConnectionState(id string) {
+	c.connectionStateBus.unsubscribe(id)
+}
+
+// GetConnectionState returns the current connection state.
+func (c *FeedClient) GetConnectionState() ConnectionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.connectionState
+}
+
+// updateConnectionState applies the update to the current connection state and publishes the result to subscribers.
+func (c *FeedClient) updateConnectionState(update func(*ConnectionState)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	update(&c.connectionState)
+
+	c.connectionStateBus.publish(c.connectionState)
+}
+
+// setConnectionStatus moves the connection into the given status with the given reason.
+func (c *FeedClient) setConnectionStatus(status ConnectionStatus, reason string, attempt int) {
+	c.updateConnectionState(func(state *ConnectionState) {
+		state.Status = status
+		state.Reason = reason
+		state.Attempt = attempt
+
+		if status != CONNECTION_STATUS_CONNECTED {
+			state.Latency = 0
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package state
+
+import (
+	"sync"
+
+	"github.com/dmars8047/broterm/internal/logging"
+	"github.com/google/uuid"
+)
+
+// OverflowPolicy decides what happens when an event is published to a subscriber whose queue is full.
+type OverflowPolicy uint8
+
+const (
+	// Discard the oldest queued event to make room for the new one.
+	OVERFLOW_POLICY_DROP_OLDEST OverflowPolicy = iota
+	// Discard the new event and keep the queue as it is.
+	OVERFLOW_POLICY_DROP_NEWEST
+	// Close the subscriber's channel and remove the subscription.
+	OVERFLOW_POLICY_DISCONNECT_SUBSCRIBER
+)
+
+// eventBusLogger logs events dropped by the event buses
+var eventBusLogger = logging.Component("event_bus")
+
+// String returns the name of the overflow policy.
+func (policy OverflowPolicy) String() string {
+	switch policy {
+	case OVERFLOW_POLICY_DROP_NEWEST:
+		return "drop-newest"
+	case OVERFLOW_POLICY_DISCONNECT_SUBSCRIBER:
+		return "disconnect-subscriber"
+	default:
+		return "drop-oldest"
+	}
+}
+
+// eventBus fans events out to subscribers without ever blocking the publisher.
+// Each subscriber has its own bounded queue so a slow or stuck subscriber only ever loses its own events.
+type eventBus[T any] struct {
+	name        string
+	queueSize   int
+	policy      OverflowPolicy
+	subscribers map[string]*eventSubscriber[T]
+	mu          sync.Mutex
+}
+
+// eventSubscriber is a single subscription to an event bus.
+type eventSubscriber[T any] struct {
+	ch      chan T
+	dropped uint64
+}
+
+// newEventBus creates a new event bus. The name is only used for logging.
+func newEventBus[T any](name string, queueSize int, policy OverflowPolicy) *eventBus[T] {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	return &eventBus[T]{
+		name:        name,
+		queueSize:   queueSize,
+		policy:      policy,
+		subscribers: make(map[string]*eventSubscriber[T]),
+	}
+}
+
+// subscribe adds a new subscriber and returns its id and channel.
+func (bus *eventBus[T]) subscribe() (string, <-chan T) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	id := uuid.NewString()
+	sub := &eventSubscriber[T]{ch: make(chan T, bus.queueSize)}
+	bus.subscribers[id] = sub
+
+	return id, sub.ch
+}
+
+// subscribeWith adds a new subscriber whose queue already holds the initial event.
+func (bus *eventBus[T]) subscribeWith(initial T) (string, <-chan T) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	id := uuid.NewString()
+	sub := &eventSubscriber[T]{ch: make(chan T, bus.queueSize)}
+	sub.ch <- initial
+	bus.subscribers[id] = sub
+
+	return id, sub.ch
+}
+
+// unsubscribe removes the subscriber and closes its channel. Unknown ids are ignored.
+func (bus *eventBus[T]) unsubscribe(id string) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	sub, ok := bus.subscribers[id]
+
+	if !ok {
+		return
+	}
+
+	close(sub.ch)
+	delete(bus.subscribers, id)
+}
+
+// publish delivers the event to every subscriber, applying the overflow policy to any whose queue is full.
+func (bus *eventBus[T]) publish(event T) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	for id, sub := range bus.subscribers {
+		select {
+		case sub.ch <- event:
+			continue
+		default:
+		}
+
+		switch bus.policy {
+		case OVERFLOW_POLICY_DROP_NEWEST:
+			bus.recordDrop(id, sub)
+		case OVERFLOW_POLICY_DISCONNECT_SUBSCRIBER:
+			bus.recordDrop(id, sub)
+			eventBusLogger.Warn("Disconnecting subscriber, its event queue is full", "bus", bus.name, "subscriber", id, "queue_size", bus.queueSize)
+			close(sub.ch)
+			delete(bus.subscribers, id)
+		default:
+			// Make room by discarding the oldest event. The subscriber may have read it in the meantime which is fine.
+			select {
+			case <-sub.ch:
+				bus.recordDrop(id, sub)
+			default:
+			}
+
+			select {
+			case sub.ch <- event:
+			default:
+				bus.recordDrop(id, sub)
+			}
+		}
+	}
+}
+
+// recordDrop counts a dropped event for the subscriber. Must be called with the bus lock held.
+func (bus *eventBus[T]) recordDrop(id string, sub *eventSubscriber[T]) {
+	sub.dropped++
+
+	// Log the first drop and then every hundredth so a stuck subscriber doesn't flood the log
+	if sub.dropped == 1 || sub.dropped%100 == 0 {
+		eventBusLogger.Warn("Dropped events for subscriber", "bus", bus.name, "subscriber", id, "dropped", sub.dropped, "policy", bus.policy)
+	}
+}
+
+// dropped returns the number of events dropped for the subscriber and whether the subscriber exists.
+func (bus *eventBus[T]) dropped(id string) (uint64, bool) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	sub, ok := bus.subscribers[id]
+
+	if !ok {
+		return 0, false
+	}
+
+	return sub.dropped, true
+}
+
+// closeAll closes and removes every subscriber.
+func (bus *eventBus[T]) closeAll() {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	for id, sub := range bus.subscribers {
+		close(sub.ch)
+		delete(bus.subscribers, id)
+	}
+}
@@ -0,0 +1,148 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+// drain returns the events queued on the channel and whether it was closed
+func drain(ch <-chan int) ([]int, bool) {
+	events := make([]int, 0)
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events, true
+			}
+
+			events = append(events, event)
+		default:
+			return events, false
+		}
+	}
+}
+
+func TestEventBusStuckSubscriberDoesNotStallOthers(t *testing.T) {
+	const queueSize = 4
+	const published = 20
+
+	tests := []struct {
+		policy OverflowPolicy
+		// The events left in the stuck subscriber's queue
+		wantQueued []int
+		// Whether the stuck subscriber is disconnected
+		wantClosed bool
+		// The events dropped for the stuck subscriber, while it is still subscribed
+		wantDropped uint64
+	}{
+		{OVERFLOW_POLICY_DROP_OLDEST, []int{16, 17, 18, 19}, false, published - queueSize},
+		{OVERFLOW_POLICY_DROP_NEWEST, []int{0, 1, 2, 3}, false, published - queueSize},
+		{OVERFLOW_POLICY_DISCONNECT_SUBSCRIBER, []int{0, 1, 2, 3}, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			bus := newEventBus[int]("test", queueSize, tt.policy)
+
+			stuckId, stuck := bus.subscribe()
+			liveId, live := bus.subscribe()
+
+			for i := 0; i < published; i++ {
+				done := make(chan struct{})
+
+				go func() {
+					bus.publish(i)
+					close(done)
+				}()
+
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatalf("publish(%d) blocked on the stuck subscriber", i)
+				}
+
+				select {
+				case event := <-live:
+					if event != i {
+						t.Fatalf("live subscriber received %d, want %d", event, i)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("live subscriber did not receive event %d", i)
+				}
+			}
+
+			if dropped, ok := bus.dropped(liveId); !ok || dropped != 0 {
+				t.Errorf("live subscriber dropped = %d, %v, want 0, true", dropped, ok)
+			}
+
+			dropped, subscribed := bus.dropped(stuckId)
+
+			if subscribed == tt.wantClosed {
+				t.Errorf("stuck subscriber still subscribed = %v, want %v", subscribed, !tt.wantClosed)
+			}
+
+			if subscribed && dropped != tt.wantDropped {
+				t.Errorf("stuck subscriber dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+
+			queued, closed := drain(stuck)
+
+			if closed != tt.wantClosed {
+				t.Errorf("stuck subscriber channel closed = %v, want %v", closed, tt.wantClosed)
+			}
+
+			if len(queued) != len(tt.wantQueued) {
+				t.Fatalf("stuck subscriber queue = %v, want %v", queued, tt.wantQueued)
+			}
+
+			for i := range queued {
+				if queued[i] != tt.wantQueued[i] {
+					t.Fatalf("stuck subscriber queue = %v, want %v", queued, tt.wantQueued)
+				}
+			}
+		})
+	}
+}
+
+func TestEventBusDisconnectSubscriberRemovesSubscription(t *testing.T) {
+	bus := newEventBus[int]("test", 1, OVERFLOW_POLICY_DISCONNECT_SUBSCRIBER)
+
+	id, ch := bus.subscribe()
+
+	bus.publish(1)
+
+	// The counter is kept until the queue overflows, at which point the subscription is gone
+	if dropped, ok := bus.dropped(id); !ok || dropped != 0 {
+		t.Fatalf("dropped = %d, %v before overflowing, want 0, true", dropped, ok)
+	}
+
+	bus.publish(2)
+
+	if _, ok := bus.dropped(id); ok {
+		t.Error("subscriber is still subscribed after overflowing")
+	}
+
+	queued, closed := drain(ch)
+
+	if !closed || len(queued) != 1 || queued[0] != 1 {
+		t.Errorf("queue = %v, closed = %v, want [1] and closed", queued, closed)
+	}
+
+	// Unsubscribing a disconnected subscriber must not close its channel a second time
+	bus.unsubscribe(id)
+}
+
+func TestEventBusUnsubscribeClosesChannel(t *testing.T) {
+	bus := newEventBus[int]("test", 1, OVERFLOW_POLICY_DROP_OLDEST)
+
+	id, ch := bus.subscribe()
+	bus.unsubscribe(id)
+
+	if _, ok := <-ch; ok {
+		t.Error("channel is still open after unsubscribing")
+	}
+
+	// Publishing without subscribers must not block or panic
+	bus.publish(1)
+}
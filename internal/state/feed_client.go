@@ -4,50 +4,148 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dmars8047/brolib/chat"
-	"github.com/google/uuid"
+	"github.com/dmars8047/broterm/internal/logging"
 	"github.com/gorilla/websocket"
 )
 
 const (
 	feedSuffix = "/api/brochat/connect"
 	feedScheme = "wss"
+
+	// Time allowed to write a control message to the server
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong (or any other) message from the server
+	defaultPongWait = 60 * time.Second
+	// How often pings are sent to the server. Must be less than the pong wait.
+	defaultPingPeriod = 30 * time.Second
+	// How long to wait for the server to answer a close message
+	closeGracePeriod = 5 * time.Second
+	// Bounds for the delay between reconnection attempts
+	minReconnectWait = 1 * time.Second
+	maxReconnectWait = 60 * time.Second
+	// How many events are buffered for each subscriber by default
+	defaultSubscriberQueueSize = 64
+	// How often sent outbox messages are checked for a missing acknowledgement
+	outboxCheckPeriod = 5 * time.Second
 )
 
+// ErrFeedNotConnected is returned when a message is sent while the feed is not connected.
+var ErrFeedNotConnected = errors.New("feed connection failure")
+
+// feedLogger logs the feed connection and the events received over it
+var feedLogger = logging.Component("feed")
+
+// FeedClient maintains the websocket connection to the BroChat feed and distributes the events it recieves.
 type FeedClient struct {
-	appContext                *ApplicationContext
-	broChatClient             *chat.BroChatClient
-	dialer                    *websocket.Dialer
-	url                       url.URL
-	conn                      *websocket.Conn
-	chatMessageChannels       map[string]chan chat.ChatMessage
-	userProfileUpdateChannels map[string]chan chat.UserProfileUpdateCode
-	channelUpdateChannels     map[string]chan string
-	Closed                    bool
-	mu                        sync.RWMutex
+	appContext           *ApplicationContext
+	broChatClient        *chat.BroChatClient
+	dialer               *websocket.Dialer
+	url                  url.URL
+	current              atomic.Pointer[feedConnection]
+	chatMessageBus       *eventBus[chat.ChatMessage]
+	userProfileUpdateBus *eventBus[chat.UserProfileUpdateCode]
+	channelUpdateBus     *eventBus[string]
+	connectionStateBus   *eventBus[ConnectionState]
+	connectionState      ConnectionState
+	outbox               *Outbox
+	outboxFlushMu        sync.Mutex
+	activeChannelId      string
+	pingPeriod           time.Duration
+	pongWait             time.Duration
+	cancelSupervisor     context.CancelFunc
+	supervisorDone       chan struct{}
+	supervisorMu         sync.Mutex
+	mu                   sync.RWMutex
+}
+
+// FeedClientOption configures optional feed client behaviour.
+type FeedClientOption func(*feedClientOptions)
+
+type feedClientOptions struct {
+	subscriberQueueSize int
+	overflowPolicy      OverflowPolicy
+	outbox              *Outbox
+	pingPeriod          time.Duration
+	pongWait            time.Duration
+}
+
+// FeedClientOption_SubscriberQueueSize sets how many events are buffered for each subscriber before the overflow policy applies.
+func FeedClientOption_SubscriberQueueSize(size int) FeedClientOption {
+	return func(opts *feedClientOptions) {
+		opts.subscriberQueueSize = size
+	}
+}
+
+// FeedClientOption_OverflowPolicy sets what happens when an event is published to a subscriber whose queue is full.
+func FeedClientOption_OverflowPolicy(policy OverflowPolicy) FeedClientOption {
+	return func(opts *feedClientOptions) {
+		opts.overflowPolicy = policy
+	}
+}
+
+// FeedClientOption_Outbox sets the outbox used to track outgoing chat messages. By default an in-memory outbox is used.
+func FeedClientOption_Outbox(outbox *Outbox) FeedClientOption {
+	return func(opts *feedClientOptions) {
+		opts.outbox = outbox
+	}
+}
+
+// FeedClientOption_Heartbeat sets how often the server is pinged and how long the feed waits to hear from it before the connection is considered lost.
+// The ping period must be less than the pong wait.
+func FeedClientOption_Heartbeat(pingPeriod time.Duration, pongWait time.Duration) FeedClientOption {
+	return func(opts *feedClientOptions) {
+		opts.pingPeriod = pingPeriod
+		opts.pongWait = pongWait
+	}
 }
 
 // NewFeedClient creates a new instance of the feed client.
-func NewFeedClient(dialer *websocket.Dialer, baseUrl string, broChatClient *chat.BroChatClient, appContext *ApplicationContext) *FeedClient {
+func NewFeedClient(dialer *websocket.Dialer, baseUrl string, broChatClient *chat.BroChatClient, appContext *ApplicationContext, options ...FeedClientOption) *FeedClient {
+	opts := &feedClientOptions{
+		subscriberQueueSize: defaultSubscriberQueueSize,
+		overflowPolicy:      OVERFLOW_POLICY_DROP_OLDEST,
+		pingPeriod:          defaultPingPeriod,
+		pongWait:            defaultPongWait,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	if opts.outbox == nil {
+		// An in-memory outbox has nothing to load so this cannot fail
+		opts.outbox, _ = NewOutbox("")
+	}
+
 	return &FeedClient{
-		broChatClient:             broChatClient,
-		dialer:                    dialer,
-		url:                       url.URL{Scheme: feedScheme, Host: baseUrl, Path: feedSuffix},
-		chatMessageChannels:       make(map[string]chan chat.ChatMessage, 0),
-		userProfileUpdateChannels: make(map[string]chan chat.UserProfileUpdateCode, 0),
-		channelUpdateChannels:     make(map[string]chan string, 0),
-		Closed:                    true,
-		mu:                        sync.RWMutex{},
-		appContext:                appContext,
+		broChatClient:        broChatClient,
+		dialer:               dialer,
+		url:                  url.URL{Scheme: feedScheme, Host: baseUrl, Path: feedSuffix},
+		chatMessageBus:       newEventBus[chat.ChatMessage]("chat message", opts.subscriberQueueSize, opts.overflowPolicy),
+		userProfileUpdateBus: newEventBus[chat.UserProfileUpdateCode]("user profile update", opts.subscriberQueueSize, opts.overflowPolicy),
+		channelUpdateBus:     newEventBus[string]("channel update", opts.subscriberQueueSize, opts.overflowPolicy),
+		// Connection state subscribers only care about the latest state
+		connectionStateBus: newEventBus[ConnectionState]("connection state", 1, OVERFLOW_POLICY_DROP_OLDEST),
+		outbox:             opts.outbox,
+		pingPeriod:         opts.pingPeriod,
+		pongWait:           opts.pongWait,
+		mu:                 sync.RWMutex{},
+		appContext:         appContext,
 	}
 }
 
+// SetBaseAddress sets the host (and optional port) of the feed. The change applies to the next connection.
 func (c *FeedClient) SetBaseAddress(address string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -55,301 +153,516 @@ func (c *FeedClient) SetBaseAddress(address string) {
 	c.url.Host = address
 }
 
+// SetServer sets the websocket scheme (wss or ws) and the host (and optional port) of the feed. The change applies to the next connection.
+func (c *FeedClient) SetServer(scheme, address string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.url.Scheme = scheme
+	c.url.Host = address
+}
+
 // SubscribeToChatMessages subscribes to chat messages and returns a channel to receive messages on.
 // The returned string is the subscription ID and is used to unsubscribe from chat messages.
 // The returned channel will be closed when the subscription is removed. Suggested usage is to defer the call to UnsubscribeFromChatMessages.
+// The channel is buffered. If the subscriber falls too far behind the feed client's overflow policy applies.
 func (c *FeedClient) SubscribeToChatMessages() (string, <-chan chat.ChatMessage) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	id := uuid.NewString()
-	ch := make(chan chat.ChatMessage)
-	c.chatMessageChannels[id] = ch
-	return id, ch
+	return c.chatMessageBus.subscribe()
 }
 
 // UnsubscribeFromChatMessages unsubscribes from chat messages.
 func (c *FeedClient) UnsubscribeFromChatMessages(id string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	ch, ok := c.chatMessageChannels[id]
-
-	if !ok {
-		return
-	}
-
-	close(ch)
-	delete(c.chatMessageChannels, id)
+	c.chatMessageBus.unsubscribe(id)
 }
 
 // SubscribeToUserProfileUpdates subscribes to user profile updates and returns a channel to receive updates on.
 // The returned string is the subscription ID and is used to unsubscribe from user profile updates.
 // The returned channel will be closed when the subscription is removed. Suggested usage is to defer the call to UnsubscribeFromUserProfileUpdates.
+// The channel is buffered. If the subscriber falls too far behind the feed client's overflow policy applies.
 func (c *FeedClient) SubscribeToUserProfileUpdates() (string, <-chan chat.UserProfileUpdateCode) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	id := uuid.NewString()
-	ch := make(chan chat.UserProfileUpdateCode)
-	c.userProfileUpdateChannels[id] = ch
-	return id, ch
+	return c.userProfileUpdateBus.subscribe()
 }
 
 // UnsubscribeFromUserProfileUpdates unsubscribes from user profile updates.
 func (c *FeedClient) UnsubscribeFromUserProfileUpdates(id string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	ch, ok := c.userProfileUpdateChannels[id]
-
-	if !ok {
-		return
-	}
-
-	close(ch)
-	delete(c.userProfileUpdateChannels, id)
+	c.userProfileUpdateBus.unsubscribe(id)
 }
 
 // SubscribeToChannelUpdates subscribes to channel updates and returns a channel to receive updates on.
 // The returned string is the subscription ID and is used to unsubscribe from channel updates.
 // The returned channel will be closed when the subscription is removed. Suggested usage is to defer the call to UnsubscribeFromChannelUpdates.
+// The channel is buffered. If the subscriber falls too far behind the feed client's overflow policy applies.
 func (c *FeedClient) SubscribeToChannelUpdates() (string, <-chan string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	return c.channelUpdateBus.subscribe()
+}
+
+// UnsubscribeFromChannelUpdates unsubscribes from channel updates.
+func (c *FeedClient) UnsubscribeFromChannelUpdates(id string) {
+	c.channelUpdateBus.unsubscribe(id)
+}
+
+// DroppedEvents returns the number of events that have been dropped for the subscription because its queue was full.
+func (c *FeedClient) DroppedEvents(subscriptionId string) uint64 {
+	if dropped, ok := c.chatMessageBus.dropped(subscriptionId); ok {
+		return dropped
+	}
+
+	if dropped, ok := c.userProfileUpdateBus.dropped(subscriptionId); ok {
+		return dropped
+	}
 
-	id := uuid.NewString()
-	ch := make(chan string)
+	if dropped, ok := c.channelUpdateBus.dropped(subscriptionId); ok {
+		return dropped
+	}
 
-	c.channelUpdateChannels[id] = ch
+	dropped, _ := c.connectionStateBus.dropped(subscriptionId)
 
-	return id, ch
+	return dropped
 }
 
-// UnsubscribeFromChannelUpdates unsubscribes from channel updates.
-func (c *FeedClient) UnsubscribeFromChannelUpdates(id string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Connect dials the feed and starts a supervisor which keeps the connection alive for the lifetime of the user session.
+// If the connection drops (read error, missed pong or close frame from the server) the supervisor re-dials with a jittered exponential backoff.
+// Subscription channels are left intact across reconnects and are only closed once the user session ends.
+// Any supervisor left over from a previous connection is stopped first.
+func (c *FeedClient) Connect() error {
+	c.supervisorMu.Lock()
+	defer c.supervisorMu.Unlock()
 
-	ch, ok := c.channelUpdateChannels[id]
+	c.stopSupervisor()
 
-	if !ok {
+	c.setConnectionStatus(CONNECTION_STATUS_CONNECTING, "", 0)
+
+	conn, err := c.dial()
+
+	if err != nil {
+		c.setConnectionStatus(CONNECTION_STATUS_DISCONNECTED, err.Error(), 0)
+		return err
+	}
+
+	sessionContext, cancel := c.appContext.GenerateUserSessionBoundContextWithCancel()
+	done := make(chan struct{})
+
+	c.cancelSupervisor = cancel
+	c.supervisorDone = done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		c.supervise(sessionContext, conn)
+	}()
+
+	return nil
+}
+
+// Disconnect closes the connection and waits for the supervisor to finish, which closes all feed subscriptions.
+// It does nothing if the feed is not connected.
+func (c *FeedClient) Disconnect() {
+	c.supervisorMu.Lock()
+	defer c.supervisorMu.Unlock()
+
+	c.stopSupervisor()
+}
+
+// stopSupervisor cancels the supervisor and waits for it to finish. Must be called with the supervisor lock held.
+func (c *FeedClient) stopSupervisor() {
+	if c.cancelSupervisor == nil {
 		return
 	}
 
-	close(ch)
-	delete(c.channelUpdateChannels, id)
+	c.cancelSupervisor()
+	<-c.supervisorDone
+
+	c.cancelSupervisor = nil
+	c.supervisorDone = nil
 }
 
-func (c *FeedClient) Connect() error {
+// IsConnected returns true if the feed currently has a live connection.
+func (c *FeedClient) IsConnected() bool {
+	return c.current.Load() != nil
+}
+
+// feedUrl returns the url of the feed.
+func (c *FeedClient) feedUrl() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
+	return c.url.String()
+}
+
+// setClients replaces the dialer and BroChat client used from now on. Connections already open are not affected.
+func (c *FeedClient) setClients(dialer *websocket.Dialer, broChatClient *chat.BroChatClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dialer = dialer
+	c.broChatClient = broChatClient
+}
+
+// clients returns the dialer and BroChat client currently in use.
+func (c *FeedClient) clients() (*websocket.Dialer, *chat.BroChatClient) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.dialer, c.broChatClient
+}
+
+// dial opens a new websocket connection to the feed using the current user session's access token.
+func (c *FeedClient) dial() (*websocket.Conn, error) {
 	accessToken, ok := c.appContext.GetAccessToken()
 
 	if !ok {
-		return errors.New("no valid authentication information available for feed connection")
+		return nil, errors.New("no valid authentication information available for feed connection")
 	}
 
 	headers := http.Header{}
 	headers.Set("Authorization", "Bearer "+accessToken)
 
-	conn, _, err := c.dialer.Dial(c.url.String(), headers)
+	dialer, _ := c.clients()
+
+	conn, _, err := dialer.Dial(c.feedUrl(), headers)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// supervise serves the connection until it drops and then reconnects until the session context is done.
+func (c *FeedClient) supervise(sessionContext context.Context, conn *websocket.Conn) {
+	defer c.closeSubscriptions()
+	defer c.setConnectionStatus(CONNECTION_STATUS_DISCONNECTED, "User session ended", 0)
+
+	authRefreshSubscriptionId, authRefreshChannel := c.appContext.SubscribeToAuthRefresh()
+	defer c.appContext.UnsubscribeFromAuthRefresh(authRefreshSubscriptionId)
+
+	reconnectBackoff := newBackoff(minReconnectWait, maxReconnectWait)
+
+	for {
+		next, err := c.serve(sessionContext, newFeedConnection(conn), authRefreshChannel)
+
+		if sessionContext.Err() != nil {
+			return
+		}
+
+		if next != nil {
+			feedLogger.Info("Re-established websocket connection with refreshed access token", "url", c.feedUrl())
+			conn = next
+			continue
+		}
+
+		feedLogger.Warn("Websocket connection lost", "url", c.feedUrl(), "error", err)
+
+		reason := describeConnectionError(err)
+		attempt := 0
+
+		c.setConnectionStatus(CONNECTION_STATUS_RECONNECTING, reason, attempt)
+
+		conn = nil
+
+		for conn == nil {
+			wait := reconnectBackoff.next()
+			attempt++
+
+			feedLogger.Info("Attempting to reconnect", "url", c.feedUrl(), "wait", wait.Round(time.Millisecond))
+
+			select {
+			case <-sessionContext.Done():
+				return
+			case <-time.After(wait):
+			}
+
+			conn, err = c.dial()
+
+			if err != nil {
+				feedLogger.Warn("Reconnection attempt failed", "url", c.feedUrl(), "error", err)
+				c.setConnectionStatus(CONNECTION_STATUS_RECONNECTING, describeConnectionError(err), attempt)
+				conn = nil
+			}
+		}
+
+		reconnectBackoff.reset()
+
+		feedLogger.Info("Reconnected", "url", c.feedUrl())
+	}
+}
+
+// feedConnection is a single websocket connection to the feed.
+// The goroutine serving the connection is its only writer. Everything else hands it writes through the writes channel.
+type feedConnection struct {
+	conn   *websocket.Conn
+	writes chan writeCommand
+	done   chan struct{}
+}
+
+// writeCommand is a request for the serving goroutine to write a feed message to the socket.
+type writeCommand struct {
+	feedMessage *chat.FeedMessage
+	result      chan error
+}
+
+// newFeedConnection wraps the websocket connection.
+func newFeedConnection(conn *websocket.Conn) *feedConnection {
+	return &feedConnection{
+		conn:   conn,
+		writes: make(chan writeCommand),
+		done:   make(chan struct{}),
 	}
+}
+
+// serve reads from, writes to and keeps alive a single connection. It returns when the connection drops or the context is done.
+// When the context is done the close handshake is performed before returning.
+// When the access token is refreshed a connection using the new token is dialed and returned once this one has been closed.
+func (c *FeedClient) serve(ctx context.Context, fc *feedConnection, authRefreshed <-chan UserAuth) (*websocket.Conn, error) {
+	conn := fc.conn
+
+	defer close(fc.done)
+	defer c.current.CompareAndSwap(fc, nil)
+
+	conn.SetReadDeadline(time.Now().Add(c.pongWait))
 
-	c.Closed = false
-	c.conn = conn
+	conn.SetPongHandler(func(appData string) error {
+		// The ping payload is the time the ping was sent which gives the round trip latency
+		if sentAt, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			latency := time.Since(time.Unix(0, sentAt))
 
-	// The default close handler will automatically respond to close messages from the server
-	defaultCloseHandler := c.conn.CloseHandler()
+			c.updateConnectionState(func(state *ConnectionState) {
+				state.Latency = latency
+			})
+		}
 
-	c.conn.SetCloseHandler(func(code int, text string) error {
-		c.Closed = true
-		return defaultCloseHandler(code, text)
+		return conn.SetReadDeadline(time.Now().Add(c.pongWait))
 	})
 
+	readErr := make(chan error, 1)
+
 	go func() {
 		for {
-			messageType, message, err := c.conn.ReadMessage()
+			messageType, message, err := conn.ReadMessage()
 
 			if err != nil {
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) || err == websocket.ErrCloseSent {
-					log.Printf("Websocket connection to %s closed", c.url.String())
-				} else {
-					log.Printf("Error reading message from websocket: %s", err.Error())
-				}
+				readErr <- err
 				return
 			}
 
-			switch messageType {
-			case websocket.TextMessage:
-				var feedMessage chat.FeedMessage
-				msgErr := json.Unmarshal(message, &feedMessage)
+			// Any message from the server proves the connection is alive
+			conn.SetReadDeadline(time.Now().Add(c.pongWait))
 
-				if msgErr != nil {
-					log.Printf("Error unmarshaling feed message: %s", msgErr.Error())
-					continue
-				}
+			receivedAt := time.Now()
 
-				switch feedMessage.Type {
-				case chat.FEED_MESSAGE_TYPE_CHANNEL_UPDATED:
-					var channelUpdatedEvent chat.ChannelUpdatedEvent
+			c.updateConnectionState(func(state *ConnectionState) {
+				state.LastMessageAt = receivedAt
+			})
 
-					chtMsgErr := json.Unmarshal(feedMessage.Content, &channelUpdatedEvent)
+			if messageType == websocket.TextMessage {
+				c.handleFeedMessage(message)
+			}
+		}
+	}()
 
-					if chtMsgErr != nil {
-						log.Printf("Error unmarshaling channel updated event during channel updated event processing: %s", chtMsgErr.Error())
-						continue
-					}
+	c.current.Store(fc)
+	c.setConnectionStatus(CONNECTION_STATUS_CONNECTED, "", 0)
 
-					c.mu.RLock()
+	// Restore the server side state for this connection and send anything still waiting in the outbox.
+	// This has to happen off the serving goroutine since the writes are handed back to it.
+	go func() {
+		c.restoreActiveChannel()
+		c.flushOutbox(true)
+	}()
 
-					for ch := range c.channelUpdateChannels {
-						c.channelUpdateChannels[ch] <- channelUpdatedEvent.ChannelId
-					}
+	pingTicker := time.NewTicker(c.pingPeriod)
+	defer pingTicker.Stop()
 
-					c.mu.RUnlock()
-				case chat.FEED_MESSAGE_TYPE_CHAT_MESSAGE:
-					var chatMessage chat.ChatMessage
+	outboxTicker := time.NewTicker(outboxCheckPeriod)
+	defer outboxTicker.Stop()
 
-					chtMsgErr := json.Unmarshal(feedMessage.Content, &chatMessage)
+	for {
+		select {
+		case err := <-readErr:
+			conn.Close()
+			return nil, err
+		case cmd := <-fc.writes:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
 
-					if chtMsgErr != nil {
-						log.Printf("Error unmarshaling chat message during chat message event processing: %s", chtMsgErr.Error())
-						continue
-					}
+			err := conn.WriteJSON(cmd.feedMessage)
 
-					c.mu.RLock()
+			cmd.result <- err
 
-					for ch := range c.chatMessageChannels {
-						c.chatMessageChannels[ch] <- chatMessage
-					}
+			if err != nil {
+				conn.Close()
+				return nil, <-readErr
+			}
+		case <-outboxTicker.C:
+			c.outbox.expire()
 
-					c.mu.RUnlock()
-				case chat.FEED_MESSAGE_TYPE_USER_PROFILE_UPDATED:
-					brochatUser := c.appContext.GetBrochatUser()
+			// Resend what was cut off by a previous connection once it has gone unacknowledged for long enough
+			go c.flushOutbox(true)
+		case <-pingTicker.C:
+			payload := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
 
-					accessToken, ok := c.appContext.GetAccessToken()
+			err := conn.WriteControl(websocket.PingMessage, payload, time.Now().Add(writeWait))
 
-					if !ok {
-						log.Println("No valid authentication information available for user profile updated event processing")
-						c.appContext.CancelUserSession()
-						return
-					}
+			if err != nil {
+				conn.Close()
+				return nil, <-readErr
+			}
+		case <-authRefreshed:
+			// Dial the replacement before closing this connection so a failed handshake leaves the feed connected
+			next, err := c.dial()
 
-					result := c.broChatClient.GetUser(accessToken, brochatUser.Id)
+			if err != nil {
+				feedLogger.Warn("Re-handshake using refreshed access token failed", "url", c.feedUrl(), "error", err)
+				continue
+			}
 
-					err = result.Err()
+			feedLogger.Debug("Closing websocket connection for re-handshake", "url", c.feedUrl())
 
-					if err != nil {
-						log.Printf("An error occurred during the processing of a user profile updated event. "+
-							"The call to retrieve user data resulted in the following error: %s", err.Error())
+			c.current.CompareAndSwap(fc, nil)
+			closeConnection(conn, readErr, "Client re-authenticated.")
 
-						continue
-					}
+			return next, nil
+		case <-ctx.Done():
+			feedLogger.Debug("Closing websocket connection", "url", c.feedUrl())
 
-					c.appContext.SetBrochatUser(result.Content)
+			// Stop accepting writes before starting the close handshake
+			c.current.CompareAndSwap(fc, nil)
+			closeConnection(conn, readErr, "Client closed connection.")
 
-					var userProfileUpdatedEvent chat.UserProfileUpdatedEvent
+			return nil, ctx.Err()
+		}
+	}
+}
 
-					chtMsgErr := json.Unmarshal(feedMessage.Content, &userProfileUpdatedEvent)
+// closeConnection performs the close handshake and closes the connection.
+// readErr recieves the read error of the connection's reader which signals the server answered the close message.
+func closeConnection(conn *websocket.Conn, readErr <-chan error, reason string) {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
 
-					if chtMsgErr != nil {
-						log.Printf("Error unmarshaling user profile updated event during user profile updated event processing: %s", chtMsgErr.Error())
-						continue
-					}
+	err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
 
-					c.mu.RLock()
+	if err == nil {
+		// Wait for the server to answer the close message or give up after the grace period
+		select {
+		case <-readErr:
+		case <-time.After(closeGracePeriod):
+		}
+	}
+
+	if err := conn.Close(); err != nil {
+		feedLogger.Warn("Websocket close error", "error", err)
+	}
+}
 
-					for ch := range c.userProfileUpdateChannels {
-						c.userProfileUpdateChannels[ch] <- userProfileUpdatedEvent.UpdateCode
-					}
+// handleFeedMessage decodes a feed message and dispatches it to the relevant subscribers.
+func (c *FeedClient) handleFeedMessage(message []byte) {
+	var feedMessage chat.FeedMessage
+	msgErr := json.Unmarshal(message, &feedMessage)
 
-					c.mu.RUnlock()
-				}
-			}
+	if msgErr != nil {
+		feedLogger.Error("Error unmarshaling feed message", "error", msgErr)
+		return
+	}
+
+	switch feedMessage.Type {
+	case chat.FEED_MESSAGE_TYPE_CHANNEL_UPDATED:
+		var channelUpdatedEvent chat.ChannelUpdatedEvent
+
+		chtMsgErr := json.Unmarshal(feedMessage.Content, &channelUpdatedEvent)
+
+		if chtMsgErr != nil {
+			feedLogger.Error("Error unmarshaling channel updated event", "error", chtMsgErr)
+			return
 		}
-	}()
 
-	go func() {
-		for {
-			select {
-			case <-c.appContext.userSession.context.Done():
-				c.mu.Lock()
-				defer c.mu.Unlock()
-
-				// Close all chat message channels
-				for ch := range c.chatMessageChannels {
-					close(c.chatMessageChannels[ch])
-				}
-
-				clear(c.chatMessageChannels)
-
-				// Close all user profile update channels
-				for ch := range c.userProfileUpdateChannels {
-					close(c.userProfileUpdateChannels[ch])
-				}
-
-				clear(c.userProfileUpdateChannels)
-
-				// Close the connection
-				defer func() {
-					log.Printf("Closing websocket connection to %s", c.url.String())
-					if err := c.conn.Close(); err != nil {
-						log.Println("websocket close error:", err)
-					}
-				}()
-
-				// Create a close message
-				msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Client closed connection.")
-				// Write the close message to the server
-				if err := c.conn.WriteMessage(websocket.CloseMessage, msg); err != nil {
-					return
-				}
-
-				// Wait for a close message from the server or timeout after 30 seconds
-				ctx, cancel := context.WithTimeout(c.appContext.Context, 30*time.Second)
-				defer cancel()
-
-				done := make(chan struct{})
-
-				go func(ctx context.Context) {
-					defer close(done)
-					for {
-						select {
-						case <-ctx.Done():
-							// Context was cancelled or timeout occurred, stop the goroutine
-							return
-						default:
-							if c.Closed {
-								return
-							}
-						}
-					}
-				}(ctx)
-
-				select {
-				case <-done:
-				case <-ctx.Done():
-					// Timeout occurred or context was cancelled
-				}
+		c.channelUpdateBus.publish(channelUpdatedEvent.ChannelId)
+	case chat.FEED_MESSAGE_TYPE_CHAT_MESSAGE:
+		var chatMessage chat.ChatMessage
 
-				return
-			case <-time.After(30 * time.Second):
-				if c.conn != nil && !c.Closed && c.appContext.userSession != nil {
-					c.conn.WriteMessage(websocket.PingMessage, nil)
-				}
-			}
+		chtMsgErr := json.Unmarshal(feedMessage.Content, &chatMessage)
+
+		if chtMsgErr != nil {
+			feedLogger.Error("Error unmarshaling chat message", "error", chtMsgErr)
+			return
 		}
-	}()
 
-	return nil
+		c.outbox.acknowledge(chatMessage)
+		c.chatMessageBus.publish(chatMessage)
+	case chat.FEED_MESSAGE_TYPE_USER_PROFILE_UPDATED:
+		brochatUser := c.appContext.GetBrochatUser()
+
+		accessToken, ok := c.appContext.GetAccessToken()
+
+		if !ok {
+			feedLogger.Warn("No valid authentication information available for user profile updated event processing")
+			c.appContext.CancelUserSession()
+			return
+		}
+
+		_, broChatClient := c.clients()
+
+		result := broChatClient.GetUser(accessToken, brochatUser.Id)
+
+		err := result.Err()
+
+		if err != nil {
+			feedLogger.Error("User data could not be retrieved during user profile updated event processing", "error", err)
+
+			return
+		}
+
+		c.appContext.SetBrochatUser(result.Content)
+
+		var userProfileUpdatedEvent chat.UserProfileUpdatedEvent
+
+		chtMsgErr := json.Unmarshal(feedMessage.Content, &userProfileUpdatedEvent)
+
+		if chtMsgErr != nil {
+			feedLogger.Error("Error unmarshaling user profile updated event", "error", chtMsgErr)
+			return
+		}
+
+		c.userProfileUpdateBus.publish(userProfileUpdatedEvent.UpdateCode)
+	}
+}
+
+// closeSubscriptions closes and removes every feed subscription. Called once the user session has ended.
+// Connection state subscriptions are left alone as they outlive the user session.
+func (c *FeedClient) closeSubscriptions() {
+	c.chatMessageBus.closeAll()
+	c.userProfileUpdateBus.closeAll()
+	c.channelUpdateBus.closeAll()
+}
+
+// restoreActiveChannel re-sends the last active channel request after a reconnect so the server keeps routing messages for it.
+func (c *FeedClient) restoreActiveChannel() {
+	c.mu.RLock()
+	activeChannelId := c.activeChannelId
+	c.mu.RUnlock()
+
+	if activeChannelId == "" {
+		return
+	}
+
+	err := c.SendFeedMessage(chat.FEED_MESSAGE_TYPE_SET_ACTIVE_CHANNEL_REQUEST, &chat.SetActiveChannelRequest{
+		ChannelId: activeChannelId,
+	})
+
+	if err != nil {
+		feedLogger.Warn("Error restoring active channel after reconnect", "channel_id", activeChannelId, "error", err)
+	}
 }
 
+// SendFeedMessage writes a feed message to the server. It is safe to call from any goroutine.
+// An error is returned if the feed is not connected or the write fails.
 func (c *FeedClient) SendFeedMessage(messageType chat.FeedMessageType, content interface{}) error {
-	if c.Closed || c.conn == nil || c.appContext.userSession == nil {
-		return errors.New("feed connection failure")
+	if messageType == chat.FEED_MESSAGE_TYPE_SET_ACTIVE_CHANNEL_REQUEST {
+		c.rememberActiveChannel(content)
+	}
+
+	fc := c.current.Load()
+
+	if fc == nil {
+		return ErrFeedNotConnected
 	}
 
 	feedMessage, err := chat.NewFeedMessageJSON(messageType, content)
@@ -358,5 +671,114 @@ func (c *FeedClient) SendFeedMessage(messageType chat.FeedMessageType, content i
 		return err
 	}
 
-	return c.conn.WriteJSON(feedMessage)
+	cmd := writeCommand{
+		feedMessage: feedMessage,
+		result:      make(chan error, 1),
+	}
+
+	select {
+	case fc.writes <- cmd:
+	case <-fc.done:
+		return ErrFeedNotConnected
+	}
+
+	return <-cmd.result
+}
+
+// rememberActiveChannel records the channel from a set active channel request so it can be restored after a reconnect.
+func (c *FeedClient) rememberActiveChannel(content interface{}) {
+	var channelId string
+
+	switch req := content.(type) {
+	case *chat.SetActiveChannelRequest:
+		channelId = req.ChannelId
+	case chat.SetActiveChannelRequest:
+		channelId = req.ChannelId
+	default:
+		return
+	}
+
+	if channelId == "NONE" {
+		channelId = ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.activeChannelId = channelId
+}
+
+// describeConnectionError turns a connection error into a short reason suitable for display.
+func describeConnectionError(err error) string {
+	var closeErr *websocket.CloseError
+
+	switch {
+	case err == nil:
+		return "Connection lost"
+	case errors.As(err, &closeErr):
+		if closeErr.Text != "" {
+			return fmt.Sprintf("Closed by server (%s)", closeErr.Text)
+		}
+
+		return "Closed by server"
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "Server stopped responding"
+	default:
+		var netErr net.Error
+
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "Server stopped responding"
+		}
+
+		return err.Error()
+	}
+}
+
+// GetOutbox returns the outbox tracking outgoing chat messages.
+func (c *FeedClient) GetOutbox() *Outbox {
+	return c.outbox
+}
+
+// QueueChatMessage adds the chat message to the outbox and sends it if the feed is connected.
+// The message stays in the outbox until the feed echoes it back. If the feed is down it is sent once the connection is re-established.
+func (c *FeedClient) QueueChatMessage(request chat.ChatMessageRequest) OutboxEntry {
+	entry := c.outbox.add(c.appContext.GetBrochatUser().Id, request)
+
+	c.flushOutbox(false)
+
+	return entry
+}
+
+// ResendChatMessage moves a failed outbox entry back to pending and sends it.
+func (c *FeedClient) ResendChatMessage(entryId string) {
+	if _, ok := c.outbox.retry(entryId); !ok {
+		return
+	}
+
+	c.flushOutbox(false)
+}
+
+// flushOutbox sends the current user's pending outbox entries.
+// Entries which were already sent are only sent again when resendUnacknowledged is true, e.g. after a reconnect,
+// and they have gone unacknowledged for longer than outboxResendAfter.
+func (c *FeedClient) flushOutbox(resendUnacknowledged bool) {
+	c.outboxFlushMu.Lock()
+	defer c.outboxFlushMu.Unlock()
+
+	for _, entry := range c.outbox.sendable(c.appContext.GetBrochatUser().Id) {
+		// A recently sent message may still be echoed back, only those which have gone unacknowledged for a while are resent
+		if !entry.SentAtUtc.IsZero() && (!resendUnacknowledged || time.Since(entry.SentAtUtc) < outboxResendAfter) {
+			continue
+		}
+
+		err := c.SendFeedMessage(chat.FEED_MESSAGE_TYPE_CHAT_MESSAGE_REQUEST, entry.Request)
+
+		if err != nil {
+			// The connection is down. Whatever is left will be sent after reconnecting.
+			feedLogger.Warn("Outbox flush stopped", "error", err)
+			return
+		}
+
+		c.outbox.markSent(entry.Id)
+	}
 }
@@ -0,0 +1,385 @@
+package state
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/gorilla/websocket"
+)
+
+const testAccessToken = "test-token"
+
+// testFeedServer is an in-process TLS feed which hands every accepted connection to its handler
+type testFeedServer struct {
+	address     string
+	tlsConfig   *tls.Config
+	connections atomic.Int32
+}
+
+// newTestFeedServer starts a feed which only accepts connections carrying the test access token
+func newTestFeedServer(t *testing.T, handler func(conn *websocket.Conn)) *testFeedServer {
+	t.Helper()
+
+	feed := &testFeedServer{}
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != feedSuffix || r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		feed.connections.Add(1)
+		handler(conn)
+	}))
+
+	t.Cleanup(server.Close)
+
+	feed.address = strings.TrimPrefix(server.URL, "https://")
+	feed.tlsConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	return feed
+}
+
+// newTestFeedClient creates a feed client for the feed whose user session uses the access token.
+// The feed is disconnected when the test ends.
+func newTestFeedClient(t *testing.T, feed *testFeedServer, accessToken string, options ...FeedClientOption) (*FeedClient, *ApplicationContext) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	appContext := NewApplicationContext(ctx, "default")
+	appContext.SetUserSession(UserAuth{AccessToken: accessToken, TokenExpiration: time.Now().Add(time.Hour)}, nil, func() {})
+
+	dialer := &websocket.Dialer{HandshakeTimeout: time.Second, TLSClientConfig: feed.tlsConfig}
+
+	feedClient := NewFeedClient(dialer, feed.address, nil, appContext, options...)
+	t.Cleanup(feedClient.Disconnect)
+
+	return feedClient, appContext
+}
+
+// readUntilClosed reads from the connection until it fails and returns the error. Pings are answered while reading.
+func readUntilClosed(conn *websocket.Conn) error {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForStatus fails the test if the feed client does not reach the status before the timeout
+func waitForStatus(t *testing.T, feedClient *FeedClient, status ConnectionStatus, timeout time.Duration) ConnectionState {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		state := feedClient.GetConnectionState()
+
+		if state.Status == status {
+			return state
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("connection status is %s, want %s", state.Status, status)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFeedClientConnect(t *testing.T) {
+	feed := newTestFeedServer(t, func(conn *websocket.Conn) {
+		readUntilClosed(conn)
+	})
+
+	feedClient, _ := newTestFeedClient(t, feed, testAccessToken)
+
+	if err := feedClient.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	waitForStatus(t, feedClient, CONNECTION_STATUS_CONNECTED, time.Second)
+
+	if !feedClient.IsConnected() {
+		t.Error("IsConnected() = false after connecting")
+	}
+
+	if got := feed.connections.Load(); got != 1 {
+		t.Errorf("server accepted %d connections, want 1", got)
+	}
+}
+
+func TestFeedClientConnectRejected(t *testing.T) {
+	feed := newTestFeedServer(t, func(conn *websocket.Conn) {
+		readUntilClosed(conn)
+	})
+
+	feedClient, _ := newTestFeedClient(t, feed, "wrong-token")
+
+	if err := feedClient.Connect(); err == nil {
+		t.Fatal("Connect() succeeded with an access token the server rejects")
+	}
+
+	if state := feedClient.GetConnectionState(); state.Status != CONNECTION_STATUS_DISCONNECTED || state.Reason == "" {
+		t.Errorf("connection state = %+v, want disconnected with a reason", state)
+	}
+
+	if feedClient.IsConnected() {
+		t.Error("IsConnected() = true after a rejected connection")
+	}
+}
+
+func TestFeedClientPingPongKeepsConnectionAlive(t *testing.T) {
+	// The server never sends a message of its own, only the pongs answering the client's pings
+	feed := newTestFeedServer(t, func(conn *websocket.Conn) {
+		readUntilClosed(conn)
+	})
+
+	pongWait := 100 * time.Millisecond
+	feedClient, _ := newTestFeedClient(t, feed, testAccessToken, FeedClientOption_Heartbeat(20*time.Millisecond, pongWait))
+
+	if err := feedClient.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	waitForStatus(t, feedClient, CONNECTION_STATUS_CONNECTED, time.Second)
+
+	// Outlive the read deadline several times over
+	time.Sleep(5 * pongWait)
+
+	state := feedClient.GetConnectionState()
+
+	if state.Status != CONNECTION_STATUS_CONNECTED {
+		t.Fatalf("connection status = %s after answering pings, want %s", state.Status, CONNECTION_STATUS_CONNECTED)
+	}
+
+	if state.Latency <= 0 {
+		t.Errorf("latency = %v, want it measured from the pongs", state.Latency)
+	}
+
+	if got := feed.connections.Load(); got != 1 {
+		t.Errorf("server accepted %d connections, want the first to stay up", got)
+	}
+}
+
+func TestFeedClientMissedPongDropsConnection(t *testing.T) {
+	feed := newTestFeedServer(t, func(conn *websocket.Conn) {
+		// Swallow pings so the client's read deadline passes
+		conn.SetPingHandler(func(string) error { return nil })
+		readUntilClosed(conn)
+	})
+
+	feedClient, _ := newTestFeedClient(t, feed, testAccessToken, FeedClientOption_Heartbeat(20*time.Millisecond, 100*time.Millisecond))
+
+	if err := feedClient.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	waitForStatus(t, feedClient, CONNECTION_STATUS_CONNECTED, time.Second)
+
+	state := waitForStatus(t, feedClient, CONNECTION_STATUS_RECONNECTING, time.Second)
+
+	if state.Reason != "Server stopped responding" {
+		t.Errorf("reason = %q, want the missed pong to be reported", state.Reason)
+	}
+
+	if feedClient.IsConnected() {
+		t.Error("IsConnected() = true after the read deadline passed")
+	}
+}
+
+func TestFeedClientSessionEndClosesConnection(t *testing.T) {
+	closeErrs := make(chan error, 1)
+
+	feed := newTestFeedServer(t, func(conn *websocket.Conn) {
+		closeErrs <- readUntilClosed(conn)
+	})
+
+	feedClient, appContext := newTestFeedClient(t, feed, testAccessToken)
+
+	_, chatMessages := feedClient.SubscribeToChatMessages()
+
+	if err := feedClient.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	waitForStatus(t, feedClient, CONNECTION_STATUS_CONNECTED, time.Second)
+
+	appContext.CancelUserSession()
+
+	// The server answers the close message so the grace period is never waited out
+	waitForStatus(t, feedClient, CONNECTION_STATUS_DISCONNECTED, closeGracePeriod/2)
+
+	select {
+	case err := <-closeErrs:
+		var closeErr *websocket.CloseError
+
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+			t.Errorf("server read error = %v, want a normal closure", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server did not see the connection close")
+	}
+
+	if _, ok := <-chatMessages; ok {
+		t.Error("chat message subscription is still open after the user session ended")
+	}
+
+	if feedClient.IsConnected() {
+		t.Error("IsConnected() = true after the user session ended")
+	}
+
+	if err := feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_CHAT_MESSAGE_REQUEST, chat.ChatMessageRequest{}); !errors.Is(err, ErrFeedNotConnected) {
+		t.Errorf("SendFeedMessage() after the user session ended error = %v, want %v", err, ErrFeedNotConnected)
+	}
+}
+
+func TestFeedClientDisconnectClosesConnection(t *testing.T) {
+	closeErrs := make(chan error, 1)
+
+	feed := newTestFeedServer(t, func(conn *websocket.Conn) {
+		closeErrs <- readUntilClosed(conn)
+	})
+
+	feedClient, _ := newTestFeedClient(t, feed, testAccessToken)
+
+	_, chatMessages := feedClient.SubscribeToChatMessages()
+
+	if err := feedClient.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	waitForStatus(t, feedClient, CONNECTION_STATUS_CONNECTED, time.Second)
+
+	start := time.Now()
+	feedClient.Disconnect()
+
+	// The server answers the close message so the grace period is never waited out
+	if elapsed := time.Since(start); elapsed >= closeGracePeriod {
+		t.Errorf("Disconnect() took %v, the close handshake was not completed", elapsed)
+	}
+
+	select {
+	case err := <-closeErrs:
+		var closeErr *websocket.CloseError
+
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+			t.Errorf("server read error = %v, want a normal closure", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server did not see the connection close")
+	}
+
+	if _, ok := <-chatMessages; ok {
+		t.Error("chat message subscription is still open after disconnecting")
+	}
+
+	if feedClient.IsConnected() {
+		t.Error("IsConnected() = true after disconnecting")
+	}
+
+	if state := feedClient.GetConnectionState(); state.Status != CONNECTION_STATUS_DISCONNECTED {
+		t.Errorf("connection status = %s after disconnecting, want %s", state.Status, CONNECTION_STATUS_DISCONNECTED)
+	}
+
+	if err := feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_CHAT_MESSAGE_REQUEST, chat.ChatMessageRequest{}); !errors.Is(err, ErrFeedNotConnected) {
+		t.Errorf("SendFeedMessage() after disconnecting error = %v, want %v", err, ErrFeedNotConnected)
+	}
+}
+
+func TestFeedClientConcurrentSends(t *testing.T) {
+	const senders = 8
+	const messagesPerSender = 25
+
+	var mu sync.Mutex
+	received := make(map[string]bool)
+	allReceived := make(chan struct{})
+
+	feed := newTestFeedServer(t, func(conn *websocket.Conn) {
+		for {
+			var feedMessage chat.FeedMessage
+
+			if err := conn.ReadJSON(&feedMessage); err != nil {
+				return
+			}
+
+			var request chat.ChatMessageRequest
+
+			if err := json.Unmarshal(feedMessage.Content, &request); err != nil {
+				t.Errorf("server could not decode the message - %v", err)
+				return
+			}
+
+			mu.Lock()
+			received[request.Content] = true
+
+			if len(received) == senders*messagesPerSender {
+				close(allReceived)
+			}
+
+			mu.Unlock()
+		}
+	})
+
+	feedClient, _ := newTestFeedClient(t, feed, testAccessToken)
+
+	if err := feedClient.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	waitForStatus(t, feedClient, CONNECTION_STATUS_CONNECTED, time.Second)
+
+	var wg sync.WaitGroup
+
+	for sender := 0; sender < senders; sender++ {
+		wg.Add(1)
+
+		go func(sender int) {
+			defer wg.Done()
+
+			for i := 0; i < messagesPerSender; i++ {
+				err := feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_CHAT_MESSAGE_REQUEST, chat.ChatMessageRequest{
+					ChannelId: "channel",
+					Content:   fmt.Sprintf("%d-%d", sender, i),
+				})
+
+				if err != nil {
+					t.Errorf("SendFeedMessage() error = %v", err)
+				}
+			}
+		}(sender)
+	}
+
+	wg.Wait()
+
+	select {
+	case <-allReceived:
+	case <-time.After(2 * time.Second):
+		mu.Lock()
+		defer mu.Unlock()
+
+		t.Fatalf("server received %d of %d messages", len(received), senders*messagesPerSender)
+	}
+}
@@ -0,0 +1,168 @@
+package state
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dmars8047/brolib/chat"
+)
+
+// MentionTracker counts the unread messages of each channel which mention the logged in user.
+// A message is unread if it was received after the channel was last opened, or after the tracker was created if it has not been.
+// Counts are kept in memory for the logged in user and start over when a different user logs in.
+// The server does not record what the user has read, so mentions received before the tracker was created are never counted.
+type MentionTracker struct {
+	userId string
+	// When counting started, used for channels which have not been opened
+	startedAt time.Time
+	// When each channel was last read, by channel id
+	lastRead map[string]time.Time
+	// The number of unread mentions of each channel, by channel id
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+// NewMentionTracker creates a mention tracker which counts mentions received from now on
+func NewMentionTracker() *MentionTracker {
+	return &MentionTracker{
+		startedAt: time.Now().UTC(),
+		lastRead:  make(map[string]time.Time),
+		counts:    make(map[string]int),
+	}
+}
+
+// MarkRead records that the user has read every message of the channel up to now
+func (tracker *MentionTracker) MarkRead(userId string, channelId string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.switchUser(userId)
+
+	tracker.lastRead[channelId] = time.Now().UTC()
+	delete(tracker.counts, channelId)
+}
+
+// Count returns the number of unread mentions of the user in the channel as of the last update
+func (tracker *MentionTracker) Count(userId string, channelId string) int {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.switchUser(userId)
+
+	return tracker.counts[channelId]
+}
+
+// Update counts the unread messages of the channel which mention the user, replacing the previous count.
+// The messages should be the latest of the channel. Messages sent by the user themselves are not counted.
+// Returns the new count.
+func (tracker *MentionTracker) Update(user chat.User, channelId string, messages []chat.ChatMessage) int {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.switchUser(user.Id)
+
+	readAt, ok := tracker.lastRead[channelId]
+
+	if !ok {
+		readAt = tracker.startedAt
+	}
+
+	count := 0
+
+	for _, msg := range messages {
+		if msg.SenderUserId != user.Id && msg.RecievedAtUtc.After(readAt) && Mentions(msg.Content, user.Username) {
+			count++
+		}
+	}
+
+	tracker.counts[channelId] = count
+
+	return count
+}
+
+// switchUser forgets the counts of the previous user if the user has changed. Must be called with the lock held.
+func (tracker *MentionTracker) switchUser(userId string) {
+	if userId == tracker.userId {
+		return
+	}
+
+	tracker.userId = userId
+	tracker.lastRead = make(map[string]time.Time)
+	tracker.counts = make(map[string]int)
+}
+
+// Mentions returns true if the content mentions the username with an @
+func Mentions(content string, username string) bool {
+	return len(MentionIndexes(content, username)) > 0
+}
+
+// MentionIndexes returns the start and end byte offsets of each @username in the content.
+// The username is matched regardless of case and must not be part of a longer word or email address.
+func MentionIndexes(content string, username string) [][2]int {
+	indexes := make([][2]int, 0)
+
+	if username == "" {
+		return indexes
+	}
+
+	for i := 0; i < len(content); i++ {
+		if content[i] != '@' {
+			continue
+		}
+
+		start, end := i, i+1+len(username)
+
+		if end > len(content) || !strings.EqualFold(content[start+1:end], username) {
+			continue
+		}
+
+		if before, _ := utf8.DecodeLastRuneInString(content[:start]); start > 0 && isMentionRune(before) {
+			continue
+		}
+
+		if after, _ := utf8.DecodeRuneInString(content[end:]); end < len(content) && isMentionRune(after) {
+			continue
+		}
+
+		indexes = append(indexes, [2]int{start, end})
+		i = end - 1
+	}
+
+	return indexes
+}
+
+// PartialMention returns the offset of the @ of the mention the text ends with, which may be no more than the @.
+// Returns false if the text does not end with a mention.
+func PartialMention(text string) (int, bool) {
+	end := len(text)
+
+	for end > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:end])
+
+		if !isMentionRune(r) {
+			break
+		}
+
+		end -= size
+	}
+
+	if end == 0 || text[end-1] != '@' {
+		return 0, false
+	}
+
+	start := end - 1
+
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isMentionRune(before) {
+		return 0, false
+	}
+
+	return start, true
+}
+
+// isMentionRune returns true if the rune can be part of a username
+func isMentionRune(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,117 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+)
+
+func TestMentionIndexes(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		username string
+		want     [][2]int
+	}{
+		{"mention", "hi @alice", "alice", [][2]int{{3, 9}}},
+		{"start and end", "@alice and @alice", "alice", [][2]int{{0, 6}, {11, 17}}},
+		{"case insensitive", "hi @ALICE!", "alice", [][2]int{{3, 9}}},
+		{"punctuation after", "@alice, @alice.", "alice", [][2]int{{0, 6}, {8, 14}}},
+		{"email address", "mail bob@alice.com", "alice", [][2]int{}},
+		{"longer username", "@alice_b @alice-b @alice2", "alice", [][2]int{}},
+		{"username with separators", "hi @al_ice-x", "al_ice-x", [][2]int{{3, 12}}},
+		{"letter before", "x@alice", "alice", [][2]int{}},
+		{"non ascii letter after", "@aliceé", "alice", [][2]int{}},
+		{"non ascii letter before", "é@alice", "alice", [][2]int{}},
+		{"non ascii username", "hi @zoë!", "zoë", [][2]int{{3, 8}}},
+		{"without the at sign", "alice", "alice", [][2]int{}},
+		{"empty username", "@ @alice", "", [][2]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MentionIndexes(tt.content, tt.username); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MentionIndexes(%q, %q) = %v, want %v", tt.content, tt.username, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartialMention(t *testing.T) {
+	tests := []struct {
+		text      string
+		wantStart int
+		wantOk    bool
+	}{
+		{"@", 0, true},
+		{"hi @al", 3, true},
+		{"hi @al_i-c", 3, true},
+		{"hi @zo", 3, true},
+		{"hi @zoë", 3, true},
+		{"hi @al ", 0, false},
+		{"bob@al", 0, false},
+		{"hi al", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		start, ok := PartialMention(tt.text)
+
+		if start != tt.wantStart || ok != tt.wantOk {
+			t.Errorf("PartialMention(%q) = %d, %v, want %d, %v", tt.text, start, ok, tt.wantStart, tt.wantOk)
+		}
+	}
+}
+
+func TestMentionTracker(t *testing.T) {
+	tracker := NewMentionTracker()
+	user := chat.User{Id: "alice-id", Username: "alice"}
+	now := time.Now().UTC()
+
+	// Pretend counting started a minute ago so messages can be placed between then and now
+	tracker.startedAt = now.Add(-time.Minute)
+
+	message := func(senderId string, at time.Time, content string) chat.ChatMessage {
+		return chat.ChatMessage{SenderUserId: senderId, RecievedAtUtc: at, Content: content}
+	}
+
+	messages := []chat.ChatMessage{
+		// Received before the tracker was created, so it cannot be told apart from a read message
+		message("bob-id", now.Add(-time.Hour), "@alice earlier"),
+		message("bob-id", now.Add(-30*time.Second), "@alice now"),
+		message("bob-id", now.Add(-20*time.Second), "no mention"),
+		// The user's own messages are not counted
+		message("alice-id", now.Add(-10*time.Second), "@alice me"),
+	}
+
+	if got := tracker.Update(user, "channel", messages); got != 1 {
+		t.Fatalf("Update() = %d, want 1", got)
+	}
+
+	if got := tracker.Count(user.Id, "channel"); got != 1 {
+		t.Errorf("Count() = %d, want 1", got)
+	}
+
+	tracker.MarkRead(user.Id, "channel")
+
+	if got := tracker.Count(user.Id, "channel"); got != 0 {
+		t.Errorf("Count() after MarkRead() = %d, want 0", got)
+	}
+
+	later := append(messages, message("bob-id", time.Now().UTC().Add(time.Second), "@alice after reading"))
+
+	if got := tracker.Update(user, "channel", later); got != 1 {
+		t.Errorf("Update() after MarkRead() = %d, want only the later mention", got)
+	}
+
+	// Another user starts over
+	if got := tracker.Count("bob-id", "channel"); got != 0 {
+		t.Errorf("Count() for another user = %d, want 0", got)
+	}
+
+	if got := tracker.Count(user.Id, "channel"); got != 0 {
+		t.Errorf("Count() after switching back = %d, want the counts forgotten", got)
+	}
+}
@@ -0,0 +1,350 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/logging"
+	"github.com/google/uuid"
+)
+
+const (
+	// How long a sent message may go without being echoed back by the feed before it is considered failed
+	outboxAckTimeout = 30 * time.Second
+	// How long a sent message goes without being echoed back before it is resent after reconnecting.
+	// Messages sent more recently may still be echoed over the new connection, resending them would deliver them twice.
+	outboxResendAfter = 10 * time.Second
+	// How many times a message is sent before giving up and marking it as failed
+	outboxMaxAttempts = 3
+)
+
+// outboxLogger logs the persistence of the outbox
+var outboxLogger = logging.Component("outbox")
+
+// OutboxEntryStatus describes where an outgoing chat message is in its delivery lifecycle.
+type OutboxEntryStatus uint8
+
+const (
+	// The message is waiting to be sent or waiting for the feed to echo it back.
+	OUTBOX_ENTRY_STATUS_PENDING OutboxEntryStatus = iota
+	// The message could not be delivered and needs to be resent or discarded by the user.
+	OUTBOX_ENTRY_STATUS_FAILED
+	// The message was echoed back by the feed. Delivered entries are removed from the outbox.
+	OUTBOX_ENTRY_STATUS_DELIVERED
+	// The message was discarded by the user. Discarded entries are removed from the outbox.
+	OUTBOX_ENTRY_STATUS_DISCARDED
+)
+
+// OutboxEntry is an outgoing chat message tracked by the outbox.
+type OutboxEntry struct {
+	// The local id of the entry.
+	Id string `json:"id"`
+	// The id of the user who sent the message.
+	UserId string `json:"user_id"`
+	// The message request.
+	Request chat.ChatMessageRequest `json:"request"`
+	// The delivery status of the message.
+	Status OutboxEntryStatus `json:"status"`
+	// How many times the message has been written to the feed.
+	Attempts int `json:"attempts"`
+	// When the message was queued.
+	QueuedAtUtc time.Time `json:"queued_at_utc"`
+	// When the message was last written to the feed. Zero if it has not been sent yet.
+	SentAtUtc time.Time `json:"sent_at_utc"`
+	// The id of the delivered chat message. Only set once delivered.
+	MessageId string `json:"message_id,omitempty"`
+}
+
+// Outbox holds outgoing chat messages until the feed confirms their delivery.
+// Undelivered messages are persisted to disk (when a file path is given) so they survive restarts.
+type Outbox struct {
+	filePath  string
+	entries   []*OutboxEntry
+	updateBus *eventBus[OutboxEntry]
+	mu        sync.Mutex
+}
+
+// NewOutbox creates a new outbox. If filePath is not empty previously persisted entries are loaded from it
+// and all changes are written back to it. An empty filePath creates an in-memory outbox.
+func NewOutbox(filePath string) (*Outbox, error) {
+	outbox := &Outbox{
+		filePath:  filePath,
+		entries:   make([]*OutboxEntry, 0),
+		updateBus: newEventBus[OutboxEntry]("outbox update", defaultSubscriberQueueSize, OVERFLOW_POLICY_DROP_OLDEST),
+	}
+
+	if filePath == "" {
+		return outbox, nil
+	}
+
+	outboxBytes, err := os.ReadFile(filePath)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return outbox, nil
+		}
+
+		return nil, err
+	}
+
+	err = json.Unmarshal(outboxBytes, &outbox.entries)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return outbox, nil
+}
+
+// SubscribeToUpdates subscribes to changes to outbox entries and returns a channel to receive them on.
+// The returned channel will be closed when the subscription is removed.
+func (outbox *Outbox) SubscribeToUpdates() (string, <-chan OutboxEntry) {
+	return outbox.updateBus.subscribe()
+}
+
+// UnsubscribeFromUpdates unsubscribes from outbox entry changes.
+func (outbox *Outbox) UnsubscribeFromUpdates(id string) {
+	outbox.updateBus.unsubscribe(id)
+}
+
+// GetEntries returns the undelivered entries for the user's channel in the order they were queued.
+func (outbox *Outbox) GetEntries(userId, channelId string) []OutboxEntry {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	entries := make([]OutboxEntry, 0)
+
+	for _, entry := range outbox.entries {
+		if entry.UserId == userId && entry.Request.ChannelId == channelId {
+			entries = append(entries, *entry)
+		}
+	}
+
+	return entries
+}
+
+// add queues a new pending message for the user.
+func (outbox *Outbox) add(userId string, request chat.ChatMessageRequest) OutboxEntry {
+	entry := &OutboxEntry{
+		Id:          uuid.NewString(),
+		UserId:      userId,
+		Request:     request,
+		Status:      OUTBOX_ENTRY_STATUS_PENDING,
+		QueuedAtUtc: time.Now().UTC(),
+	}
+
+	snapshot := *entry
+
+	outbox.mu.Lock()
+	outbox.entries = append(outbox.entries, entry)
+	outbox.persist()
+	outbox.mu.Unlock()
+
+	outbox.updateBus.publish(snapshot)
+
+	return snapshot
+}
+
+// sendable returns the pending entries for the user which have not been sent yet or whose send has gone unacknowledged.
+// Entries which have run out of attempts are marked as failed instead.
+func (outbox *Outbox) sendable(userId string) []OutboxEntry {
+	outbox.mu.Lock()
+
+	sendable := make([]OutboxEntry, 0)
+	updated := make([]OutboxEntry, 0)
+
+	for _, entry := range outbox.entries {
+		if entry.UserId != userId || entry.Status != OUTBOX_ENTRY_STATUS_PENDING {
+			continue
+		}
+
+		if entry.Attempts >= outboxMaxAttempts {
+			entry.Status = OUTBOX_ENTRY_STATUS_FAILED
+			updated = append(updated, *entry)
+			continue
+		}
+
+		sendable = append(sendable, *entry)
+	}
+
+	if len(updated) > 0 {
+		outbox.persist()
+	}
+
+	outbox.mu.Unlock()
+
+	for _, entry := range updated {
+		outbox.updateBus.publish(entry)
+	}
+
+	return sendable
+}
+
+// markSent records an attempt to write the entry to the feed.
+func (outbox *Outbox) markSent(id string) {
+	outbox.update(id, func(entry *OutboxEntry) bool {
+		entry.Attempts++
+		entry.SentAtUtc = time.Now().UTC()
+		return false
+	})
+}
+
+// acknowledge matches a chat message echoed back by the feed with an entry for the same user, channel and content.
+// The feed does not return an id for the request so identical messages are told apart by when they were sent.
+// Entries which have not been sent cannot have been echoed and are skipped. Of the rest the one sent first is matched,
+// since the feed echoes messages in the order it receives them.
+// The matching entry is marked as delivered and removed from the outbox.
+func (outbox *Outbox) acknowledge(msg chat.ChatMessage) {
+	outbox.mu.Lock()
+
+	match := -1
+
+	for i, entry := range outbox.entries {
+		if entry.Status == OUTBOX_ENTRY_STATUS_DELIVERED ||
+			entry.SentAtUtc.IsZero() ||
+			entry.UserId != msg.SenderUserId ||
+			entry.Request.ChannelId != msg.ChannelId ||
+			entry.Request.Content != msg.Content {
+			continue
+		}
+
+		if match == -1 || entry.SentAtUtc.Before(outbox.entries[match].SentAtUtc) {
+			match = i
+		}
+	}
+
+	if match == -1 {
+		outbox.mu.Unlock()
+		return
+	}
+
+	entry := outbox.entries[match]
+
+	entry.Status = OUTBOX_ENTRY_STATUS_DELIVERED
+	entry.MessageId = msg.Id
+	outbox.entries = append(outbox.entries[:match], outbox.entries[match+1:]...)
+	outbox.persist()
+	outbox.mu.Unlock()
+
+	// The entry is no longer reachable from the outbox so it is safe to read without the lock
+	outbox.updateBus.publish(*entry)
+}
+
+// expire marks sent entries which have not been acknowledged within the timeout as failed.
+func (outbox *Outbox) expire() {
+	outbox.mu.Lock()
+
+	expired := make([]OutboxEntry, 0)
+
+	for _, entry := range outbox.entries {
+		if entry.Status != OUTBOX_ENTRY_STATUS_PENDING || entry.SentAtUtc.IsZero() {
+			continue
+		}
+
+		if time.Since(entry.SentAtUtc) > outboxAckTimeout {
+			entry.Status = OUTBOX_ENTRY_STATUS_FAILED
+			expired = append(expired, *entry)
+		}
+	}
+
+	if len(expired) > 0 {
+		outbox.persist()
+	}
+
+	outbox.mu.Unlock()
+
+	for _, entry := range expired {
+		outbox.updateBus.publish(entry)
+	}
+}
+
+// retry moves a failed entry back to pending with a fresh set of attempts.
+// Returns false if the entry does not exist or has not failed, a pending entry may still be echoed back and is left alone.
+func (outbox *Outbox) retry(id string) (OutboxEntry, bool) {
+	outbox.mu.Lock()
+
+	failed := false
+
+	for _, entry := range outbox.entries {
+		if entry.Id == id {
+			failed = entry.Status == OUTBOX_ENTRY_STATUS_FAILED
+			break
+		}
+	}
+
+	outbox.mu.Unlock()
+
+	if !failed {
+		return OutboxEntry{}, false
+	}
+
+	return outbox.update(id, func(entry *OutboxEntry) bool {
+		entry.Status = OUTBOX_ENTRY_STATUS_PENDING
+		entry.Attempts = 0
+		entry.SentAtUtc = time.Time{}
+		return false
+	})
+}
+
+// Discard removes an undelivered entry from the outbox.
+func (outbox *Outbox) Discard(id string) {
+	outbox.update(id, func(entry *OutboxEntry) bool {
+		entry.Status = OUTBOX_ENTRY_STATUS_DISCARDED
+		return true
+	})
+}
+
+// update applies the change to the entry with the given id and publishes the result.
+// If change returns true the entry is removed from the outbox.
+func (outbox *Outbox) update(id string, change func(*OutboxEntry) bool) (OutboxEntry, bool) {
+	outbox.mu.Lock()
+
+	for i, entry := range outbox.entries {
+		if entry.Id != id {
+			continue
+		}
+
+		if change(entry) {
+			outbox.entries = append(outbox.entries[:i], outbox.entries[i+1:]...)
+		}
+
+		snapshot := *entry
+
+		outbox.persist()
+		outbox.mu.Unlock()
+
+		outbox.updateBus.publish(snapshot)
+
+		return snapshot, true
+	}
+
+	outbox.mu.Unlock()
+
+	return OutboxEntry{}, false
+}
+
+// persist writes the outbox to disk. Must be called with the outbox lock held.
+func (outbox *Outbox) persist() {
+	if outbox.filePath == "" {
+		return
+	}
+
+	outboxBytes, err := json.Marshal(outbox.entries)
+
+	if err != nil {
+		outboxLogger.Error("Error marshalling outbox", "error", err)
+		return
+	}
+
+	// Written to a temporary file and renamed into place so a crash part way through cannot lose the queued messages
+	err = config.WriteFileAtomic(outbox.filePath, outboxBytes, 0600)
+
+	if err != nil {
+		outboxLogger.Error("Error writing outbox", "path", outbox.filePath, "error", err)
+	}
+}
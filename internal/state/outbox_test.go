@@ -0,0 +1,149 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+)
+
+func newTestOutbox(t *testing.T, filePath string) *Outbox {
+	t.Helper()
+
+	outbox, err := NewOutbox(filePath)
+
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+
+	return outbox
+}
+
+func TestOutboxAcknowledgeIdenticalMessages(t *testing.T) {
+	outbox := newTestOutbox(t, "")
+	request := chat.ChatMessageRequest{ChannelId: "channel", Content: "same"}
+
+	first := outbox.add("user", request)
+	second := outbox.add("user", request)
+	unsent := outbox.add("user", request)
+
+	outbox.markSent(first.Id)
+	outbox.markSent(second.Id)
+
+	echo := chat.ChatMessage{Id: "message-1", ChannelId: "channel", SenderUserId: "user", Content: "same"}
+
+	outbox.acknowledge(echo)
+
+	entries := outbox.GetEntries("user", "channel")
+
+	if len(entries) != 2 || entries[0].Id != second.Id || entries[1].Id != unsent.Id {
+		t.Fatalf("entries after the first echo = %+v, want the first sent entry acknowledged", entries)
+	}
+
+	outbox.acknowledge(echo)
+
+	entries = outbox.GetEntries("user", "channel")
+
+	if len(entries) != 1 || entries[0].Id != unsent.Id {
+		t.Fatalf("entries after the second echo = %+v, want the unsent entry left", entries)
+	}
+
+	// An echo cannot belong to a message which has not been sent
+	outbox.acknowledge(echo)
+
+	if entries = outbox.GetEntries("user", "channel"); len(entries) != 1 {
+		t.Errorf("unsent entry was acknowledged")
+	}
+}
+
+func TestOutboxRetryOnlyFailedEntries(t *testing.T) {
+	outbox := newTestOutbox(t, "")
+
+	entry := outbox.add("user", chat.ChatMessageRequest{ChannelId: "channel", Content: "hello"})
+	outbox.markSent(entry.Id)
+
+	if _, ok := outbox.retry(entry.Id); ok {
+		t.Fatal("retry() succeeded for a pending entry")
+	}
+
+	if entries := outbox.GetEntries("user", "channel"); entries[0].Attempts != 1 || entries[0].SentAtUtc.IsZero() {
+		t.Fatalf("retry() reset a pending entry to %+v", entries[0])
+	}
+
+	outbox.update(entry.Id, func(entry *OutboxEntry) bool {
+		entry.Status = OUTBOX_ENTRY_STATUS_FAILED
+		return false
+	})
+
+	retried, ok := outbox.retry(entry.Id)
+
+	if !ok {
+		t.Fatal("retry() failed for a failed entry")
+	}
+
+	if retried.Status != OUTBOX_ENTRY_STATUS_PENDING || retried.Attempts != 0 || !retried.SentAtUtc.IsZero() {
+		t.Errorf("retried entry = %+v, want pending and unsent", retried)
+	}
+
+	if _, ok := outbox.retry("missing"); ok {
+		t.Error("retry() succeeded for an entry which does not exist")
+	}
+}
+
+func TestOutboxSendableMarksExhaustedEntriesFailed(t *testing.T) {
+	outbox := newTestOutbox(t, "")
+
+	entry := outbox.add("user", chat.ChatMessageRequest{ChannelId: "channel", Content: "hello"})
+
+	for i := 0; i < outboxMaxAttempts; i++ {
+		outbox.markSent(entry.Id)
+	}
+
+	if sendable := outbox.sendable("user"); len(sendable) != 0 {
+		t.Fatalf("sendable() = %+v, want the exhausted entry left out", sendable)
+	}
+
+	if entries := outbox.GetEntries("user", "channel"); entries[0].Status != OUTBOX_ENTRY_STATUS_FAILED {
+		t.Errorf("status = %d, want failed", entries[0].Status)
+	}
+}
+
+func TestOutboxPersist(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "outbox.json")
+
+	outbox := newTestOutbox(t, filePath)
+
+	kept := outbox.add("user", chat.ChatMessageRequest{ChannelId: "channel", Content: "kept"})
+	discarded := outbox.add("user", chat.ChatMessageRequest{ChannelId: "channel", Content: "discarded"})
+	outbox.markSent(kept.Id)
+	outbox.Discard(discarded.Id)
+
+	files, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Name() != "outbox.json" {
+		t.Errorf("directory holds %v, want only the outbox file", files)
+	}
+
+	info, err := os.Stat(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("outbox file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	entries := newTestOutbox(t, filePath).GetEntries("user", "channel")
+
+	if len(entries) != 1 || entries[0].Id != kept.Id || entries[0].Attempts != 1 || time.Since(entries[0].SentAtUtc) > time.Minute {
+		t.Errorf("reloaded entries = %+v, want the kept entry as sent", entries)
+	}
+}
@@ -0,0 +1,178 @@
+package state
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/logging"
+)
+
+// profileLogger logs profile switches
+var profileLogger = logging.Component("profile")
+
+// ProfileManager switches between the profiles defined in the config settings.
+// Switching ends the user session, disconnects the feed and re-points the server clients at the profile's server.
+type ProfileManager struct {
+	appContext    *ApplicationContext
+	serverClients *ServerClients
+	feedClient    *FeedClient
+	sessionStore  *SessionStore
+	settings      *config.ConfigSettings
+	mu            sync.Mutex
+}
+
+// NewProfileManager creates a new profile manager. The settings are shared with the caller and saved whenever a switch is persisted.
+func NewProfileManager(appContext *ApplicationContext, serverClients *ServerClients, feedClient *FeedClient, sessionStore *SessionStore, settings *config.ConfigSettings) *ProfileManager {
+	return &ProfileManager{
+		appContext:    appContext,
+		serverClients: serverClients,
+		feedClient:    feedClient,
+		sessionStore:  sessionStore,
+		settings:      settings,
+	}
+}
+
+// GetProfileNames returns the names of the defined profiles.
+func (manager *ProfileManager) GetProfileNames() []string {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	names := make([]string, 0, len(manager.settings.Profiles))
+
+	for _, profile := range manager.settings.Profiles {
+		names = append(names, profile.Name)
+	}
+
+	return names
+}
+
+// GetActiveProfile returns the active profile. Returns false if no profile is active and the top level settings are in use.
+func (manager *ProfileManager) GetActiveProfile() (config.Profile, bool) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	profile, ok := manager.settings.GetProfile(manager.settings.ActiveProfile)
+
+	if !ok {
+		return config.Profile{}, false
+	}
+
+	return *profile, true
+}
+
+// Switch makes the named profile active. An empty name switches back to the top level settings.
+// The user session is ended and the feed disconnected before the server clients are re-pointed.
+// If persist is true the choice is saved to the config file so it is used on the next launch.
+func (manager *ProfileManager) Switch(name string, persist bool) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	server := manager.settings.Server
+	themeCode := manager.settings.Theme
+
+	if name != "" {
+		profile, ok := manager.settings.GetProfile(name)
+
+		if !ok {
+			return fmt.Errorf("profile %q does not exist", name)
+		}
+
+		server = profile.Server
+
+		if profile.Theme != "" {
+			themeCode = profile.Theme
+		}
+	}
+
+	err := server.Validate()
+
+	if err != nil {
+		return fmt.Errorf("profile %q has invalid server settings - %w", name, err)
+	}
+
+	// Tear down everything bound to the current server before re-pointing the clients
+	manager.appContext.CancelUserSession()
+	manager.feedClient.Disconnect()
+
+	err = manager.applyServer(server)
+
+	if err != nil {
+		return err
+	}
+
+	manager.appContext.SetTheme(themeCode)
+	manager.settings.ActiveProfile = name
+
+	if !persist {
+		return nil
+	}
+
+	return config.SaveConfigSettings(manager.settings)
+}
+
+// ChangeServer re-points the server clients at the server without switching profiles.
+// If the server differs from the current one the user session is ended and the feed disconnected first, like a profile switch.
+// Saving the server to the config file is left to the caller.
+func (manager *ProfileManager) ChangeServer(server config.ServerSettings) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if server == manager.serverClients.GetSettings() {
+		return nil
+	}
+
+	err := server.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	manager.appContext.CancelUserSession()
+	manager.feedClient.Disconnect()
+
+	return manager.applyServer(server)
+}
+
+// applyServer re-points the server clients at the server if it has changed and forgets a remembered session from another server.
+// The user session must have ended. Must be called with the lock held.
+func (manager *ProfileManager) applyServer(server config.ServerSettings) error {
+	if server == manager.serverClients.GetSettings() {
+		return nil
+	}
+
+	err := manager.serverClients.Apply(server)
+
+	if err != nil {
+		return err
+	}
+
+	// A remembered session from the previous server cannot be restored on this one
+	err = manager.sessionStore.ClearUnlessFor(server)
+
+	if err != nil {
+		profileLogger.Error("Remembered session could not be removed after server change", "server", server.BaseUrl(), "error", err)
+	}
+
+	return nil
+}
+
+// RememberEmail records the email address used to log in with the active profile. Does nothing if no profile is active.
+func (manager *ProfileManager) RememberEmail(email string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	profile, ok := manager.settings.GetProfile(manager.settings.ActiveProfile)
+
+	if !ok || profile.Email == email {
+		return
+	}
+
+	profile.Email = email
+
+	err := config.SaveConfigSettings(manager.settings)
+
+	if err != nil {
+		profileLogger.Error("Error saving profile email", "profile", profile.Name, "error", err)
+	}
+}
@@ -0,0 +1,173 @@
+package state
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/idamlib/idam"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Timeout for http requests made to the server
+	httpClientTimeout = 10 * time.Second
+	// Timeout for the websocket handshake with the feed
+	feedHandshakeTimeout = 10 * time.Second
+)
+
+// ServerClients owns the clients used to talk to the BroChat server and re-points them when the server settings change.
+// Changing the server replaces the clients rather than updating them in place, so a client obtained earlier is never modified
+// while it is in use. Hold on to the ServerClients and get the clients from it for each use to follow the change.
+type ServerClients struct {
+	httpClient     *http.Client
+	userAuthClient *idam.UserAuthClient
+	brochatClient  *chat.BroChatClient
+	dialer         *websocket.Dialer
+	feedClients    []*FeedClient
+	settings       config.ServerSettings
+	mu             sync.Mutex
+}
+
+// NewServerClients creates the clients for the server described by the settings.
+func NewServerClients(settings config.ServerSettings) (*ServerClients, error) {
+	tlsConfig, err := settings.TLSConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	clients := &ServerClients{}
+	clients.replace(settings, tlsConfig)
+
+	return clients, nil
+}
+
+// replace creates the clients for the server described by the settings. Must be called with the lock held or before the clients are shared.
+func (clients *ServerClients) replace(settings config.ServerSettings, tlsConfig *tls.Config) {
+	httpClient := &http.Client{
+		Timeout:   httpClientTimeout,
+		Transport: newTransport(tlsConfig),
+	}
+
+	clients.httpClient = httpClient
+	clients.userAuthClient = idam.NewUserAuthClient(httpClient, settings.BaseUrl())
+	clients.brochatClient = chat.NewBroChatClient(httpClient, settings.BaseUrl())
+	clients.dialer = &websocket.Dialer{
+		HandshakeTimeout: feedHandshakeTimeout,
+		TLSClientConfig:  tlsConfig,
+	}
+	clients.settings = settings
+}
+
+// UserAuthClient returns the client for the identity and access management service of the current server.
+func (clients *ServerClients) UserAuthClient() *idam.UserAuthClient {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	return clients.userAuthClient
+}
+
+// BrochatClient returns the client for the BroChat api of the current server.
+func (clients *ServerClients) BrochatClient() *chat.BroChatClient {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	return clients.brochatClient
+}
+
+// HttpClient returns the http client used for requests to the current server.
+func (clients *ServerClients) HttpClient() *http.Client {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	return clients.httpClient
+}
+
+// Dialer returns the websocket dialer used to connect to the feed of the current server.
+func (clients *ServerClients) Dialer() *websocket.Dialer {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	return clients.dialer
+}
+
+// FeedUrl returns the url of the server's feed.
+func (clients *ServerClients) FeedUrl() string {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	feedUrl := url.URL{
+		Scheme: clients.settings.FeedScheme(),
+		Host:   clients.settings.Address(),
+		Path:   feedSuffix,
+	}
+
+	return feedUrl.String()
+}
+
+// NewFeedClient creates a feed client for the server which follows any later change to the server settings.
+func (clients *ServerClients) NewFeedClient(appContext *ApplicationContext, options ...FeedClientOption) *FeedClient {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	feedClient := NewFeedClient(clients.dialer, clients.settings.Address(), clients.brochatClient, appContext, options...)
+	feedClient.SetServer(clients.settings.FeedScheme(), clients.settings.Address())
+
+	clients.feedClients = append(clients.feedClients, feedClient)
+
+	return feedClient
+}
+
+// GetSettings returns the settings of the server the clients currently talk to.
+func (clients *ServerClients) GetSettings() config.ServerSettings {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	return clients.settings
+}
+
+// Apply replaces the clients with ones for the server described by the settings.
+// It should only be called while no user session is active since in-flight requests still use the previous server.
+// Feed clients pick up the change on their next connection.
+func (clients *ServerClients) Apply(settings config.ServerSettings) error {
+	err := settings.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := settings.TLSConfig()
+
+	if err != nil {
+		return err
+	}
+
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	clients.replace(settings, tlsConfig)
+
+	for _, feedClient := range clients.feedClients {
+		feedClient.setClients(clients.dialer, clients.brochatClient)
+		feedClient.SetServer(settings.FeedScheme(), settings.Address())
+	}
+
+	return nil
+}
+
+// newTransport creates the http transport using the TLS configuration. Returns nil to use the default transport when tlsConfig is nil.
+func newTransport(tlsConfig *tls.Config) http.RoundTripper {
+	if tlsConfig == nil {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return transport
+}
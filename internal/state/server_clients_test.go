@@ -0,0 +1,75 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dmars8047/broterm/internal/config"
+)
+
+func TestServerClientsApplyReplacesClients(t *testing.T) {
+	clients, err := NewServerClients(config.ServerSettings{Host: "first.example.com", Scheme: "https"})
+
+	if err != nil {
+		t.Fatalf("NewServerClients() error = %v", err)
+	}
+
+	feedClient := clients.NewFeedClient(NewApplicationContext(context.Background(), "default"))
+
+	previousBrochatClient := clients.BrochatClient()
+	previousUserAuthClient := clients.UserAuthClient()
+	previousDialer := clients.Dialer()
+
+	// Readers run alongside the change as the pages and the feed client do, the race detector reports any in place update
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				_ = *clients.BrochatClient()
+				_ = *clients.UserAuthClient()
+				_ = *clients.Dialer()
+				_ = *clients.HttpClient()
+				_, _ = feedClient.clients()
+			}
+		}()
+	}
+
+	second := config.ServerSettings{Host: "second.example.com", Scheme: "http", Port: 8080}
+	err = clients.Apply(second)
+
+	close(stop)
+	wg.Wait()
+
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if clients.BrochatClient() == previousBrochatClient || clients.UserAuthClient() == previousUserAuthClient || clients.Dialer() == previousDialer {
+		t.Error("Apply() did not replace the clients")
+	}
+
+	if dialer, broChatClient := feedClient.clients(); dialer != clients.Dialer() || broChatClient != clients.BrochatClient() {
+		t.Error("feed client still uses the previous server's clients")
+	}
+
+	if got, want := feedClient.feedUrl(), clients.FeedUrl(); got != want {
+		t.Errorf("feed url = %s, want %s", got, want)
+	}
+
+	if got := clients.GetSettings(); got != second {
+		t.Errorf("GetSettings() = %+v, want %+v", got, second)
+	}
+}
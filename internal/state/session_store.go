@@ -0,0 +1,230 @@
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dmars8047/broterm/internal/config"
+)
+
+// The key length in bytes. 32 bytes selects AES-256.
+const sessionKeySize = 32
+
+// StoredSession is a user session which is remembered between launches.
+type StoredSession struct {
+	// The access token for the session.
+	AccessToken string `json:"access_token"`
+	// When the access token expires.
+	TokenExpiration time.Time `json:"token_expiration"`
+	// The id of the logged in user.
+	UserId string `json:"user_id"`
+	// The base url of the server the session was started on. Empty for sessions remembered before it was recorded.
+	Server string `json:"server,omitempty"`
+}
+
+// BelongsTo returns true if the session was started on the server, or the server it was started on is not known.
+func (session StoredSession) BelongsTo(server config.ServerSettings) bool {
+	return session.Server == "" || session.Server == server.BaseUrl()
+}
+
+// SessionStore persists a remembered user session to disk.
+// The session is encrypted with AES-GCM using a key generated on first use and stored next to it.
+// Both files are only readable by the current user.
+type SessionStore struct {
+	sessionFilePath string
+	keyFilePath     string
+	mu              sync.Mutex
+}
+
+// NewSessionStore creates a new session store which keeps its files in the given directory.
+// An empty directory creates a store which never remembers anything.
+func NewSessionStore(directory string) *SessionStore {
+	if directory == "" {
+		return &SessionStore{}
+	}
+
+	return &SessionStore{
+		sessionFilePath: filepath.Join(directory, config.SESSION_FILE_NAME),
+		keyFilePath:     filepath.Join(directory, config.SESSION_KEY_FILE_NAME),
+	}
+}
+
+// Save encrypts the session and writes it to disk, replacing any previously stored session.
+func (store *SessionStore) Save(session StoredSession) error {
+	if store.sessionFilePath == "" {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key, err := store.loadKey(true)
+
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(session)
+
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newSessionCipher(key)
+
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	// The nonce is stored in front of the ciphertext
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+
+	return os.WriteFile(store.sessionFilePath, ciphertext, 0600)
+}
+
+// Load reads and decrypts the stored session.
+// Returns false if no session is stored or the stored session has expired.
+func (store *SessionStore) Load() (StoredSession, bool, error) {
+	if store.sessionFilePath == "" {
+		return StoredSession{}, false, nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	ciphertext, err := os.ReadFile(store.sessionFilePath)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return StoredSession{}, false, nil
+		}
+
+		return StoredSession{}, false, err
+	}
+
+	key, err := store.loadKey(false)
+
+	if err != nil {
+		return StoredSession{}, false, err
+	}
+
+	gcm, err := newSessionCipher(key)
+
+	if err != nil {
+		return StoredSession{}, false, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return StoredSession{}, false, errors.New("stored session is corrupt")
+	}
+
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+
+	if err != nil {
+		return StoredSession{}, false, fmt.Errorf("stored session could not be decrypted - %w", err)
+	}
+
+	var session StoredSession
+
+	err = json.Unmarshal(plaintext, &session)
+
+	if err != nil {
+		return StoredSession{}, false, err
+	}
+
+	if !time.Now().Before(session.TokenExpiration) {
+		return StoredSession{}, false, nil
+	}
+
+	return session, true, nil
+}
+
+// Clear removes the stored session. The key is kept so it can be reused by the next session.
+func (store *SessionStore) Clear() error {
+	if store.sessionFilePath == "" {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	err := os.Remove(store.sessionFilePath)
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// ClearUnlessFor removes the stored session unless it is known to have been started on the server.
+// Used when switching servers since a session from another server cannot be restored.
+func (store *SessionStore) ClearUnlessFor(server config.ServerSettings) error {
+	session, ok, err := store.Load()
+
+	if err == nil && ok && session.Server == server.BaseUrl() {
+		return nil
+	}
+
+	return store.Clear()
+}
+
+// loadKey reads the encryption key from disk. If create is true a new key is generated when none exists.
+// Must be called with the store lock held.
+func (store *SessionStore) loadKey(create bool) ([]byte, error) {
+	key, err := os.ReadFile(store.keyFilePath)
+
+	if err == nil {
+		if len(key) != sessionKeySize {
+			return nil, errors.New("session key is corrupt")
+		}
+
+		return key, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) || !create {
+		return nil, err
+	}
+
+	key = make([]byte, sessionKeySize)
+
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(store.keyFilePath, key, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// newSessionCipher creates the AES-GCM cipher used to seal the stored session.
+func newSessionCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,312 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// ColorMode is how many colors the terminal can show, which decides how themes are adapted before use.
+type ColorMode uint8
+
+const (
+	// Every 24-bit color is shown as it is.
+	COLOR_MODE_TRUECOLOR ColorMode = iota
+	// Colors are fitted to the 256 color xterm palette.
+	COLOR_MODE_256
+	// Colors are fitted to the 16 standard terminal colors.
+	COLOR_MODE_16
+	// Only black, white and text attributes such as bold, underline and reverse are used.
+	COLOR_MODE_MONOCHROME
+)
+
+// COLOR_MODE_AUTO is the color mode setting which detects the color mode from the terminal
+const COLOR_MODE_AUTO = "auto"
+
+// COLORBLIND_SAFE_CHAT_LABEL_COLORS are chat label colors which stay distinguishable with the common forms of color blindness.
+// They are the Okabe-Ito palette without black.
+var COLORBLIND_SAFE_CHAT_LABEL_COLORS = []string{
+	"#E69F00", // Orange
+	"#56B4E9", // Sky Blue
+	"#009E73", // Bluish Green
+	"#F0E442", // Yellow
+	"#0072B2", // Blue
+	"#D55E00", // Vermillion
+	"#CC79A7", // Reddish Purple
+}
+
+// COLORBLIND_SAFE_CONNECTION_COLORS are the colors of the connection indicator while connected, connecting and offline
+// which stay distinguishable with the common forms of color blindness. They are taken from the Okabe-Ito palette.
+var COLORBLIND_SAFE_CONNECTION_COLORS = [3]string{
+	"#56B4E9", // Sky Blue
+	"#F0E442", // Yellow
+	"#D55E00", // Vermillion
+}
+
+// monochromeChatLabelAttributes tell users apart in monochrome mode, as the attribute part of a tview style tag
+var monochromeChatLabelAttributes = []string{"b", "u", "r", "bu", "br", "ur", "i", "bi"}
+
+// DisplayOptions adapt a theme to the terminal it is shown in and to the needs of the user.
+type DisplayOptions struct {
+	// How many colors the terminal can show.
+	ColorMode ColorMode
+	// Replace the theme's chat label and connection indicator colors with colors which stay distinguishable with color blindness.
+	ColorblindSafeLabels bool
+}
+
+// String returns the setting value of the color mode.
+func (mode ColorMode) String() string {
+	switch mode {
+	case COLOR_MODE_256:
+		return "256"
+	case COLOR_MODE_16:
+		return "16"
+	case COLOR_MODE_MONOCHROME:
+		return "monochrome"
+	default:
+		return "truecolor"
+	}
+}
+
+// ColorModeSettings returns every valid color mode setting value, auto followed by the color modes
+func ColorModeSettings() []string {
+	return []string{COLOR_MODE_AUTO, COLOR_MODE_TRUECOLOR.String(), COLOR_MODE_256.String(), COLOR_MODE_16.String(), COLOR_MODE_MONOCHROME.String()}
+}
+
+// ParseColorMode parses a color mode setting value. Auto is not a color mode and is reported as an error, use ResolveColorMode for it.
+func ParseColorMode(value string) (ColorMode, error) {
+	for _, mode := range []ColorMode{COLOR_MODE_TRUECOLOR, COLOR_MODE_256, COLOR_MODE_16, COLOR_MODE_MONOCHROME} {
+		if strings.EqualFold(value, mode.String()) {
+			return mode, nil
+		}
+	}
+
+	return COLOR_MODE_TRUECOLOR, fmt.Errorf("color mode must be one of %s, got %q", strings.Join(ColorModeSettings(), ", "), value)
+}
+
+// ResolveColorMode returns the color mode for a color mode setting value.
+// Auto detects the color mode from the number of colors the terminal reports and honours the NO_COLOR convention.
+func ResolveColorMode(value string, terminalColors int) (ColorMode, error) {
+	if value != "" && !strings.EqualFold(value, COLOR_MODE_AUTO) {
+		return ParseColorMode(value)
+	}
+
+	// See https://no-color.org
+	if os.Getenv("NO_COLOR") != "" {
+		return COLOR_MODE_MONOCHROME, nil
+	}
+
+	return DetectColorMode(terminalColors), nil
+}
+
+// DetectColorMode returns the color mode for a terminal which can show the given number of colors, as reported by tcell.
+func DetectColorMode(terminalColors int) ColorMode {
+	switch {
+	case terminalColors >= 1<<24:
+		return COLOR_MODE_TRUECOLOR
+	case terminalColors >= 256:
+		return COLOR_MODE_256
+	case terminalColors >= 8:
+		return COLOR_MODE_16
+	default:
+		return COLOR_MODE_MONOCHROME
+	}
+}
+
+// palette returns the colors a theme is fitted to in the color mode, nil if colors are used as they are
+func (mode ColorMode) palette() []tcell.Color {
+	var size int
+
+	switch mode {
+	case COLOR_MODE_256:
+		size = 256
+	case COLOR_MODE_16:
+		size = 16
+	default:
+		return nil
+	}
+
+	palette := make([]tcell.Color, size)
+
+	for i := range palette {
+		palette[i] = tcell.PaletteColor(i)
+	}
+
+	return palette
+}
+
+// Adapt returns a copy of the theme adapted to the display options
+func (theme Theme) Adapt(options DisplayOptions) *Theme {
+	if options.ColorMode == COLOR_MODE_MONOCHROME {
+		return newMonochromeTheme(theme.Code)
+	}
+
+	adapted := theme
+	adapted.ChatLabelColors = append([]string(nil), theme.ChatLabelColors...)
+	adapted.ChatLabelAttributes = append([]string(nil), theme.ChatLabelAttributes...)
+
+	if options.ColorblindSafeLabels {
+		adapted.ChatLabelColors = append([]string(nil), COLORBLIND_SAFE_CHAT_LABEL_COLORS...)
+		adapted.ConnectedStyle = theme.ConnectedStyle.Foreground(tcell.GetColor(COLORBLIND_SAFE_CONNECTION_COLORS[0]))
+		adapted.ConnectingStyle = theme.ConnectingStyle.Foreground(tcell.GetColor(COLORBLIND_SAFE_CONNECTION_COLORS[1]))
+		adapted.OfflineStyle = theme.OfflineStyle.Foreground(tcell.GetColor(COLORBLIND_SAFE_CONNECTION_COLORS[2]))
+	}
+
+	palette := options.ColorMode.palette()
+
+	if palette == nil {
+		return &adapted
+	}
+
+	fit := func(color tcell.Color) tcell.Color {
+		// The terminal's own colors and the palette's colors need no fitting
+		if !color.Valid() || (!color.IsRGB() && int(color&^tcell.ColorValid) < len(palette)) {
+			return color
+		}
+
+		return tcell.FindColor(color, palette)
+	}
+
+	fitStyle := func(style tcell.Style) tcell.Style {
+		foreground, background, attributes := style.Decompose()
+		foreground, background = fit(foreground), fit(background)
+
+		return tcell.StyleDefault.Foreground(readableOn(foreground, background)).Background(background).Attributes(attributes)
+	}
+
+	adapted.BackgroundColor = fit(theme.BackgroundColor)
+	adapted.AccentColor = fit(theme.AccentColor)
+	adapted.AccentColorTwo = fit(theme.AccentColorTwo)
+
+	// Dark surfaces tend to collapse into the same palette color which would hide forms and fields against the page
+	if options.ColorMode == COLOR_MODE_16 {
+		if adapted.AccentColor == adapted.BackgroundColor {
+			adapted.AccentColor = contrastingSurface(adapted.BackgroundColor)
+		}
+
+		if adapted.AccentColorTwo == adapted.AccentColor {
+			adapted.AccentColorTwo = adapted.BackgroundColor
+		}
+	}
+
+	adapted.ForgroundColor = readableOn(fit(theme.ForgroundColor), adapted.BackgroundColor)
+	adapted.HighlightColor = readableOn(fit(theme.HighlightColor), adapted.AccentColor)
+	adapted.BorderColor = readableOn(fit(theme.BorderColor), adapted.BackgroundColor)
+	adapted.TitleColor = readableOn(fit(theme.TitleColor), adapted.BackgroundColor)
+	adapted.InfoColor = readableOn(fit(theme.InfoColor), adapted.BackgroundColor)
+	adapted.InfoColorTwo = readableOn(fit(theme.InfoColorTwo), adapted.BackgroundColor)
+	adapted.ChatTextColor = readableOn(fit(theme.ChatTextColor), adapted.BackgroundColor)
+	adapted.CodeBackgroundColor = fit(theme.CodeBackgroundColor)
+	adapted.CodeTextColor = readableOn(fit(theme.CodeTextColor), adapted.CodeBackgroundColor)
+	adapted.CodeKeywordColor = readableOn(fit(theme.CodeKeywordColor), adapted.CodeBackgroundColor)
+	adapted.CodeStringColor = readableOn(fit(theme.CodeStringColor), adapted.CodeBackgroundColor)
+	adapted.CodeCommentColor = readableOn(fit(theme.CodeCommentColor), adapted.CodeBackgroundColor)
+
+	adapted.ButtonStyle = fitStyle(theme.ButtonStyle)
+	adapted.ActivatedButtonStyle = fitStyle(theme.ActivatedButtonStyle)
+	adapted.DropdownListUnselectedStyle = fitStyle(theme.DropdownListUnselectedStyle)
+	adapted.DropdownListSelectedStyle = fitStyle(theme.DropdownListSelectedStyle)
+	adapted.TextAreaTextStyle = fitStyle(theme.TextAreaTextStyle)
+	adapted.MentionStyle = fitStyle(theme.MentionStyle)
+	adapted.ConnectedStyle = fitStyle(adapted.ConnectedStyle)
+	adapted.ConnectingStyle = fitStyle(adapted.ConnectingStyle)
+	adapted.OfflineStyle = fitStyle(adapted.OfflineStyle)
+
+	// Colors which fit to the same palette color are only kept once so every label color can be told apart
+	labelColors := make([]string, 0, len(adapted.ChatLabelColors))
+	seen := make(map[tcell.Color]bool)
+
+	for _, label := range adapted.ChatLabelColors {
+		color := readableOn(fit(tcell.GetColor(label)), adapted.BackgroundColor)
+
+		if seen[color] {
+			continue
+		}
+
+		seen[color] = true
+		labelColors = append(labelColors, tagColor(color))
+	}
+
+	adapted.ChatLabelColors = labelColors
+
+	return &adapted
+}
+
+// tagColor returns the color as it is written in a tview color tag.
+// Palette colors are written by name so the terminal's own palette is used rather than its RGB value.
+func tagColor(color tcell.Color) string {
+	if !color.IsRGB() {
+		for name, named := range tcell.ColorNames {
+			if named == color {
+				return name
+			}
+		}
+	}
+
+	return color.CSS()
+}
+
+// readableOn returns the color, or black or white if the color is the same as the background it is drawn on
+func readableOn(color tcell.Color, background tcell.Color) tcell.Color {
+	if color != background || !color.Valid() {
+		return color
+	}
+
+	return contrastingSurface(background)
+}
+
+// contrastingSurface returns black for light colors and white or dark gray for dark ones
+func contrastingSurface(color tcell.Color) tcell.Color {
+	r, g, b := color.RGB()
+
+	// Perceived brightness, see https://www.w3.org/TR/AERT/#color-contrast
+	if (r*299+g*587+b*114)/1000 > 127 {
+		return tcell.ColorBlack
+	}
+
+	if color == tcell.ColorBlack {
+		return tcell.ColorGray
+	}
+
+	return tcell.ColorWhite
+}
+
+// newMonochromeTheme returns a theme which only uses black, white and text attributes.
+// Selections are shown in reverse video and chat users are told apart by the attributes of their labels.
+// The connection indicator is dimmed while connecting and shown in reverse video while offline.
+func newMonochromeTheme(code string) *Theme {
+	plain := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorBlack)
+	selected := plain.Reverse(true)
+
+	return &Theme{
+		Code:                        code,
+		BackgroundColor:             tcell.ColorBlack,
+		ForgroundColor:              tcell.ColorWhite,
+		HighlightColor:              tcell.ColorWhite,
+		AccentColor:                 tcell.ColorBlack,
+		AccentColorTwo:              tcell.ColorBlack,
+		ButtonStyle:                 plain.Bold(true),
+		ActivatedButtonStyle:        selected.Bold(true),
+		DropdownListUnselectedStyle: plain,
+		DropdownListSelectedStyle:   selected,
+		TextAreaTextStyle:           plain,
+		BorderColor:                 tcell.ColorWhite,
+		TitleColor:                  tcell.ColorWhite,
+		InfoColor:                   tcell.ColorWhite,
+		InfoColorTwo:                tcell.ColorWhite,
+		ChatTextColor:               tcell.ColorWhite,
+		CodeBackgroundColor:         tcell.ColorBlack,
+		CodeTextColor:               tcell.ColorWhite,
+		CodeKeywordColor:            tcell.ColorWhite,
+		CodeStringColor:             tcell.ColorWhite,
+		CodeCommentColor:            tcell.ColorWhite,
+		MentionStyle:                selected.Bold(true),
+		ConnectedStyle:              plain.Bold(true),
+		ConnectingStyle:             plain.Dim(true),
+		OfflineStyle:                selected.Bold(true),
+		ChatLabelColors:             []string{tagColor(tcell.ColorWhite)},
+		ChatLabelAttributes:         append([]string(nil), monochromeChatLabelAttributes...),
+	}
+}
@@ -0,0 +1,203 @@
+package theme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Registry holds the active theme and notifies subscribers whenever it changes,
+// either because another theme was selected, the display options changed or the theme files were reloaded.
+// The active theme is always adapted to the display options.
+type Registry struct {
+	code        string
+	options     DisplayOptions
+	current     *Theme
+	subscribers map[string]chan Theme
+	mu          sync.RWMutex
+}
+
+// NewRegistry creates a new registry with the theme with the given code as the active theme.
+// Themes are used as they are until display options are set.
+func NewRegistry(code string) *Registry {
+	return &Registry{
+		code:        code,
+		current:     NewTheme(code).Adapt(DisplayOptions{}),
+		subscribers: make(map[string]chan Theme),
+	}
+}
+
+// Current returns a copy of the active theme
+func (registry *Registry) Current() Theme {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	return *registry.current
+}
+
+// SetCurrent makes the theme with the given code the active theme and notifies the subscribers
+func (registry *Registry) SetCurrent(code string) {
+	registry.mu.Lock()
+	registry.code = code
+	registry.current = NewTheme(code).Adapt(registry.options)
+	registry.mu.Unlock()
+
+	registry.notify()
+}
+
+// Preview returns the theme with the given code adapted to the display options without making it the active theme
+func (registry *Registry) Preview(code string) *Theme {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	return NewTheme(code).Adapt(registry.options)
+}
+
+// DisplayOptions returns the options the active theme is adapted with
+func (registry *Registry) DisplayOptions() DisplayOptions {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	return registry.options
+}
+
+// SetDisplayOptions adapts the active theme, and every theme selected after, with the options and notifies the subscribers
+func (registry *Registry) SetDisplayOptions(options DisplayOptions) {
+	registry.mu.Lock()
+	registry.options = options
+	registry.current = NewTheme(registry.code).Adapt(options)
+	registry.mu.Unlock()
+
+	registry.notify()
+}
+
+// Reload loads the theme files in the directory again and rebuilds the active theme from them.
+// The subscribers are notified even if the files failed to load as the valid ones may still have changed.
+func (registry *Registry) Reload(dir string) []error {
+	errs := LoadThemeFiles(dir)
+
+	registry.mu.Lock()
+	registry.current = NewTheme(registry.code).Adapt(registry.options)
+	registry.mu.Unlock()
+
+	registry.notify()
+
+	return errs
+}
+
+// Watch polls the theme files in the directory and reloads them whenever one is added, changed or removed
+// until the context is done. The reloaded func, if not nil, is called with the errors of every reload.
+func (registry *Registry) Watch(ctx context.Context, dir string, interval time.Duration, reloaded func([]error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		signature := themeFilesSignature(dir)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			latest := themeFilesSignature(dir)
+
+			if latest == signature {
+				continue
+			}
+
+			signature = latest
+			errs := registry.Reload(dir)
+
+			if reloaded != nil {
+				reloaded(errs)
+			}
+		}
+	}()
+}
+
+// Subscribe subscribes to changes of the active theme and returns a channel to receive the new theme on.
+// Slow readers only ever see the latest theme.
+func (registry *Registry) Subscribe() (string, <-chan Theme) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	id := uuid.NewString()
+	ch := make(chan Theme, 1)
+	registry.subscribers[id] = ch
+
+	return id, ch
+}
+
+// Unsubscribe removes the subscription and closes its channel. Unknown ids are ignored.
+func (registry *Registry) Unsubscribe(id string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	ch, ok := registry.subscribers[id]
+
+	if !ok {
+		return
+	}
+
+	close(ch)
+	delete(registry.subscribers, id)
+}
+
+// notify sends the active theme to every subscriber, replacing any theme they have not read yet
+func (registry *Registry) notify() {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	for _, ch := range registry.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+
+		select {
+		case ch <- *registry.current:
+		default:
+		}
+	}
+}
+
+// themeFilesSignature describes the names, sizes and modification times of the theme files in the directory
+// so that a change to any of them can be detected without reading them
+func themeFilesSignature(dir string) string {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return ""
+	}
+
+	parts := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+
+		if entry.IsDir() || (extension != ".json" && extension != ".toml") {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			continue
+		}
+
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+
+	sort.Strings(parts)
+
+	return strings.Join(parts, "|")
+}
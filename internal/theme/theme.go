@@ -5,6 +5,9 @@ import (
 	"github.com/rivo/tview"
 )
 
+// BUILT_IN_THEME_CODES are the codes of the themes compiled into the application, the first is the default theme
+var BUILT_IN_THEME_CODES = []string{"default", "america", "matrix", "halloween", "christmas", "satanic", "high-contrast"}
+
 type Theme struct {
 	Code                        string
 	BackgroundColor             tcell.Color
@@ -22,10 +25,62 @@ type Theme struct {
 	InfoColor                   tcell.Color
 	InfoColorTwo                tcell.Color
 	ChatTextColor               tcell.Color
-	ChatLabelColors             []string
+	// The background and text color of code blocks in chat messages
+	CodeBackgroundColor tcell.Color
+	CodeTextColor       tcell.Color
+	// The colors of the keywords, strings and numbers, and comments of syntax highlighted code
+	CodeKeywordColor tcell.Color
+	CodeStringColor  tcell.Color
+	CodeCommentColor tcell.Color
+	// The style of mentions of the logged in user in chat messages and of their mention counts
+	MentionStyle tcell.Style
+	// The styles of the connection indicator in the status bar while connected, while connecting or reconnecting and while offline
+	ConnectedStyle  tcell.Style
+	ConnectingStyle tcell.Style
+	OfflineStyle    tcell.Style
+	ChatLabelColors []string
+	// Text attributes used along with the chat label colors, as the attribute part of a tview style tag such as "bu".
+	// Empty unless there are too few colors to tell users apart, as in monochrome mode.
+	ChatLabelAttributes []string
 }
 
+// NewTheme returns the theme with the given code. User themes loaded with LoadThemeFiles are included.
+// Unknown codes return the default theme.
 func NewTheme(themeName string) *Theme {
+	if userTheme, ok := getUserTheme(themeName); ok {
+		return userTheme
+	}
+
+	return newBuiltInTheme(themeName)
+}
+
+// Codes returns the codes of every available theme, the built in themes followed by the user themes in alphabetical order
+func Codes() []string {
+	return append(append([]string(nil), BUILT_IN_THEME_CODES...), getUserThemeCodes()...)
+}
+
+// IsKnown returns true if the code is the code of an available theme
+func IsKnown(code string) bool {
+	if _, ok := getUserTheme(code); ok {
+		return true
+	}
+
+	return isBuiltIn(code)
+}
+
+// isBuiltIn returns true if the code is the code of a theme compiled into the application
+func isBuiltIn(code string) bool {
+	for _, builtIn := range BUILT_IN_THEME_CODES {
+		if builtIn == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newBuiltInTheme returns the built in theme with the given code or the default theme if there is none
+func newBuiltInTheme(themeName string) *Theme {
 	getDefault := func() *Theme {
 		return &Theme{
 			Code:                        "default",
@@ -39,11 +94,20 @@ func NewTheme(themeName string) *Theme {
 			DropdownListUnselectedStyle: tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite),
 			DropdownListSelectedStyle:   tcell.StyleDefault.Background(tcell.NewHexColor(0xFFC300)).Foreground(tcell.ColorBlack),
 			TextAreaTextStyle:           tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.NewHexColor(0x111111)),
+			MentionStyle:                tcell.StyleDefault.Background(tcell.NewHexColor(0xFFC300)).Foreground(tcell.ColorBlack).Bold(true),
+			ConnectedStyle:              tcell.StyleDefault.Foreground(tcell.NewHexColor(0x33DA7A)),
+			ConnectingStyle:             tcell.StyleDefault.Foreground(tcell.NewHexColor(0xFFC300)),
+			OfflineStyle:                tcell.StyleDefault.Foreground(tcell.NewHexColor(0xFF5555)),
 			BorderColor:                 tcell.ColorWhite,
 			TitleColor:                  tcell.ColorWhite,
 			InfoColor:                   tcell.ColorWhite,
 			InfoColorTwo:                tcell.NewHexColor(0x777777),
 			ChatTextColor:               tcell.ColorWhite,
+			CodeBackgroundColor:         tcell.NewHexColor(0x222222),
+			CodeTextColor:               tcell.NewHexColor(0xE0E0E0),
+			CodeKeywordColor:            tcell.NewHexColor(0xFFC300),
+			CodeStringColor:             tcell.NewHexColor(0x33DA7A),
+			CodeCommentColor:            tcell.NewHexColor(0x777777),
 			ChatLabelColors: []string{
 				"#33DA7A", // Light Green
 				"#C061CB", // Lilac
@@ -73,11 +137,20 @@ func NewTheme(themeName string) *Theme {
 			DropdownListUnselectedStyle: tcell.StyleDefault.Background(tcell.ColorBlue).Foreground(tcell.ColorWhite),
 			DropdownListSelectedStyle:   tcell.StyleDefault.Background(tcell.ColorRed).Foreground(tcell.ColorWhite),
 			TextAreaTextStyle:           tcell.StyleDefault.Background(tcell.ColorBlue).Foreground(tcell.ColorWhite),
+			MentionStyle:                tcell.StyleDefault.Background(tcell.ColorRed).Foreground(tcell.ColorWhite).Bold(true),
+			ConnectedStyle:              tcell.StyleDefault.Foreground(tcell.ColorLime),
+			ConnectingStyle:             tcell.StyleDefault.Foreground(tcell.ColorYellow),
+			OfflineStyle:                tcell.StyleDefault.Foreground(tcell.ColorRed),
 			BorderColor:                 tcell.ColorRed,
 			TitleColor:                  tcell.ColorRed,
 			InfoColor:                   tcell.ColorWhite,
 			InfoColorTwo:                tcell.ColorGhostWhite,
 			ChatTextColor:               tcell.ColorWhite,
+			CodeBackgroundColor:         tcell.ColorNavy,
+			CodeTextColor:               tcell.ColorWhite,
+			CodeKeywordColor:            tcell.ColorGold,
+			CodeStringColor:             tcell.ColorGreenYellow,
+			CodeCommentColor:            tcell.ColorLightSteelBlue,
 			ChatLabelColors: []string{
 				tcell.ColorRed.CSS(),
 				tcell.ColorGold.CSS(),
@@ -105,11 +178,20 @@ func NewTheme(themeName string) *Theme {
 			DropdownListUnselectedStyle: tcell.StyleDefault.Background(tcell.NewHexColor(0x222222)).Foreground(tcell.ColorGreen),
 			DropdownListSelectedStyle:   tcell.StyleDefault.Background(brightGreen).Foreground(trueBlack),
 			TextAreaTextStyle:           tcell.StyleDefault.Background(trueBlack).Foreground(brightGreen),
+			MentionStyle:                tcell.StyleDefault.Background(brightGreen).Foreground(trueBlack).Bold(true),
+			ConnectedStyle:              tcell.StyleDefault.Foreground(brightGreen),
+			ConnectingStyle:             tcell.StyleDefault.Foreground(tcell.ColorYellow),
+			OfflineStyle:                tcell.StyleDefault.Foreground(tcell.ColorRed),
 			BorderColor:                 darkerGreen,
 			TitleColor:                  brightGreen,
 			InfoColor:                   darkerGreen,
 			InfoColorTwo:                tcell.ColorDarkGreen,
 			ChatTextColor:               tcell.ColorWhite,
+			CodeBackgroundColor:         black,
+			CodeTextColor:               brightGreen,
+			CodeKeywordColor:            tcell.ColorWhite,
+			CodeStringColor:             tcell.ColorYellow,
+			CodeCommentColor:            tcell.ColorDarkGreen,
 			ChatLabelColors: []string{
 				tcell.ColorFuchsia.CSS(),
 				tcell.ColorAqua.CSS(),
@@ -138,11 +220,20 @@ func NewTheme(themeName string) *Theme {
 			DropdownListUnselectedStyle: tcell.StyleDefault.Background(black).Foreground(orange),
 			DropdownListSelectedStyle:   tcell.StyleDefault.Background(orange).Foreground(tcell.ColorDarkOrange),
 			TextAreaTextStyle:           tcell.StyleDefault.Background(trueBlack).Foreground(orange),
+			MentionStyle:                tcell.StyleDefault.Background(orange).Foreground(trueBlack).Bold(true),
+			ConnectedStyle:              tcell.StyleDefault.Foreground(tcell.ColorLime),
+			ConnectingStyle:             tcell.StyleDefault.Foreground(trueBlack),
+			OfflineStyle:                tcell.StyleDefault.Foreground(tcell.ColorDarkRed),
 			BorderColor:                 trueBlack,
 			TitleColor:                  trueBlack,
 			InfoColor:                   trueBlack,
 			InfoColorTwo:                tcell.NewHexColor(0x444444),
 			ChatTextColor:               trueBlack,
+			CodeBackgroundColor:         trueBlack,
+			CodeTextColor:               orange,
+			CodeKeywordColor:            tcell.ColorYellow,
+			CodeStringColor:             tcell.ColorOrangeRed,
+			CodeCommentColor:            tcell.NewHexColor(0x777777),
 			ChatLabelColors: []string{
 				tcell.ColorOrangeRed.CSS(),
 				tcell.ColorYellow.CSS(),
@@ -167,11 +258,20 @@ func NewTheme(themeName string) *Theme {
 			DropdownListUnselectedStyle: tcell.StyleDefault.Background(trueRed).Foreground(tcell.ColorWhite),
 			DropdownListSelectedStyle:   tcell.StyleDefault.Background(tcell.ColorDarkGreen).Foreground(tcell.ColorWhite),
 			TextAreaTextStyle:           tcell.StyleDefault.Background(tcell.ColorGreen).Foreground(tcell.ColorWhite),
+			MentionStyle:                tcell.StyleDefault.Background(trueRed).Foreground(tcell.ColorWhite).Bold(true),
+			ConnectedStyle:              tcell.StyleDefault.Foreground(lightGreen),
+			ConnectingStyle:             tcell.StyleDefault.Foreground(tcell.ColorGold),
+			OfflineStyle:                tcell.StyleDefault.Foreground(trueRed),
 			BorderColor:                 trueRed,
 			TitleColor:                  trueRed,
 			InfoColor:                   tcell.ColorWhite,
 			InfoColorTwo:                tcell.ColorAntiqueWhite,
 			ChatTextColor:               tcell.ColorWhite,
+			CodeBackgroundColor:         tcell.NewHexColor(0x003300),
+			CodeTextColor:               tcell.ColorWhite,
+			CodeKeywordColor:            tcell.ColorGold,
+			CodeStringColor:             lightGreen,
+			CodeCommentColor:            tcell.ColorSilver,
 			ChatLabelColors:             []string{tcell.ColorGold.CSS(), tcell.ColorYellow.CSS(), tcell.ColorRed.CSS(), lightGreen.CSS(), tcell.ColorGreen.CSS()},
 		}
 	case "satanic":
@@ -193,11 +293,20 @@ func NewTheme(themeName string) *Theme {
 			DropdownListUnselectedStyle: tcell.StyleDefault.Background(tcell.ColorDarkRed).Foreground(tcell.NewHexColor(0x111111)),
 			DropdownListSelectedStyle:   tcell.StyleDefault.Background(red).Foreground(black),
 			TextAreaTextStyle:           tcell.StyleDefault.Background(trueBlack).Foreground(red),
+			MentionStyle:                tcell.StyleDefault.Background(red).Foreground(trueBlack).Bold(true),
+			ConnectedStyle:              tcell.StyleDefault.Foreground(tcell.ColorGreen),
+			ConnectingStyle:             tcell.StyleDefault.Foreground(tcell.ColorYellow),
+			OfflineStyle:                tcell.StyleDefault.Foreground(red),
 			BorderColor:                 darkRed,
 			TitleColor:                  red,
 			InfoColor:                   mediumRed,
 			InfoColorTwo:                darkRed,
 			ChatTextColor:               tcell.ColorWhite,
+			CodeBackgroundColor:         black,
+			CodeTextColor:               tcell.ColorWhite,
+			CodeKeywordColor:            red,
+			CodeStringColor:             tcell.ColorOrange,
+			CodeCommentColor:            darkRed,
 			ChatLabelColors: []string{
 				tcell.ColorYellow.CSS(),
 				tcell.ColorDarkOrange.CSS(),
@@ -207,6 +316,40 @@ func NewTheme(themeName string) *Theme {
 				"#C061CB",
 				tcell.ColorPink.CSS()},
 		}
+	case "high-contrast":
+		trueBlack := tcell.NewHexColor(0x000000)
+		trueWhite := tcell.NewHexColor(0xFFFFFF)
+		yellow := tcell.NewHexColor(0xFFFF00)
+		cyan := tcell.NewHexColor(0x00FFFF)
+
+		return &Theme{
+			Code:                        "high-contrast",
+			BackgroundColor:             trueBlack,
+			ForgroundColor:              trueWhite,
+			HighlightColor:              yellow,
+			AccentColor:                 tcell.NewHexColor(0x262626),
+			AccentColorTwo:              trueBlack,
+			ButtonStyle:                 tcell.StyleDefault.Background(trueBlack).Foreground(trueWhite).Bold(true),
+			ActivatedButtonStyle:        tcell.StyleDefault.Background(yellow).Foreground(trueBlack).Bold(true),
+			DropdownListUnselectedStyle: tcell.StyleDefault.Background(trueBlack).Foreground(trueWhite),
+			DropdownListSelectedStyle:   tcell.StyleDefault.Background(yellow).Foreground(trueBlack),
+			TextAreaTextStyle:           tcell.StyleDefault.Background(trueBlack).Foreground(trueWhite),
+			MentionStyle:                tcell.StyleDefault.Background(yellow).Foreground(trueBlack).Bold(true),
+			ConnectedStyle:              tcell.StyleDefault.Foreground(cyan),
+			ConnectingStyle:             tcell.StyleDefault.Foreground(yellow),
+			OfflineStyle:                tcell.StyleDefault.Foreground(tcell.NewHexColor(0xFF5555)),
+			BorderColor:                 trueWhite,
+			TitleColor:                  yellow,
+			InfoColor:                   trueWhite,
+			InfoColorTwo:                cyan,
+			ChatTextColor:               trueWhite,
+			CodeBackgroundColor:         tcell.NewHexColor(0x262626),
+			CodeTextColor:               trueWhite,
+			CodeKeywordColor:            yellow,
+			CodeStringColor:             cyan,
+			CodeCommentColor:            tcell.NewHexColor(0xCCCCCC),
+			ChatLabelColors:             append([]string(nil), COLORBLIND_SAFE_CHAT_LABEL_COLORS...),
+		}
 
 	default:
 		return getDefault()
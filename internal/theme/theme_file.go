@@ -0,0 +1,363 @@
+package theme
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gdamore/tcell/v2"
+)
+
+// themeCodePattern is what a user theme code may look like so it can be typed and shown in the settings dropdown
+var themeCodePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// userThemes holds the themes loaded from theme files by code
+var userThemes struct {
+	themes map[string]*Theme
+	mu     sync.RWMutex
+}
+
+// themeFile is the content of a theme file. Every setting is optional and inherits from the base theme when left out.
+// Colors are hex colors like #1A2B3C, color names like red or default for the terminal's own color.
+type themeFile struct {
+	// The code the theme is selected by. Defaults to the file name without its extension.
+	Code string `json:"code" toml:"code"`
+	// The built in theme the settings left out are taken from. Defaults to the default theme.
+	Base string `json:"base" toml:"base"`
+
+	BackgroundColor *string `json:"background_color" toml:"background_color"`
+	ForegroundColor *string `json:"foreground_color" toml:"foreground_color"`
+	HighlightColor  *string `json:"highlight_color" toml:"highlight_color"`
+	AccentColor     *string `json:"accent_color" toml:"accent_color"`
+	AccentColorTwo  *string `json:"accent_color_two" toml:"accent_color_two"`
+	BorderColor     *string `json:"border_color" toml:"border_color"`
+	TitleColor      *string `json:"title_color" toml:"title_color"`
+	InfoColor       *string `json:"info_color" toml:"info_color"`
+	InfoColorTwo    *string `json:"info_color_two" toml:"info_color_two"`
+	ChatTextColor   *string `json:"chat_text_color" toml:"chat_text_color"`
+
+	CodeBackgroundColor *string `json:"code_background_color" toml:"code_background_color"`
+	CodeTextColor       *string `json:"code_text_color" toml:"code_text_color"`
+	CodeKeywordColor    *string `json:"code_keyword_color" toml:"code_keyword_color"`
+	CodeStringColor     *string `json:"code_string_color" toml:"code_string_color"`
+	CodeCommentColor    *string `json:"code_comment_color" toml:"code_comment_color"`
+
+	ButtonStyle                 *styleFile `json:"button_style" toml:"button_style"`
+	ActivatedButtonStyle        *styleFile `json:"activated_button_style" toml:"activated_button_style"`
+	DropdownListUnselectedStyle *styleFile `json:"dropdown_list_unselected_style" toml:"dropdown_list_unselected_style"`
+	DropdownListSelectedStyle   *styleFile `json:"dropdown_list_selected_style" toml:"dropdown_list_selected_style"`
+	TextAreaTextStyle           *styleFile `json:"text_area_text_style" toml:"text_area_text_style"`
+	MentionStyle                *styleFile `json:"mention_style" toml:"mention_style"`
+	ConnectedStyle              *styleFile `json:"connected_style" toml:"connected_style"`
+	ConnectingStyle             *styleFile `json:"connecting_style" toml:"connecting_style"`
+	OfflineStyle                *styleFile `json:"offline_style" toml:"offline_style"`
+
+	// The colors usernames are shown in within a chat. Replaces the base theme's colors when given.
+	ChatLabelColors []string `json:"chat_label_colors" toml:"chat_label_colors"`
+}
+
+// styleFile is a text style in a theme file. Parts left out are taken from the base theme's style.
+type styleFile struct {
+	Foreground *string `json:"foreground" toml:"foreground"`
+	Background *string `json:"background" toml:"background"`
+	Bold       *bool   `json:"bold" toml:"bold"`
+	Italic     *bool   `json:"italic" toml:"italic"`
+	Underline  *bool   `json:"underline" toml:"underline"`
+}
+
+// LoadThemeFiles loads every .json and .toml theme file in the directory, replacing the user themes loaded before.
+// Invalid files are skipped and reported in the returned errors, the valid ones are still loaded.
+// A missing directory is not an error.
+func LoadThemeFiles(dir string) []error {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return []error{err}
+	}
+
+	themes := make(map[string]*Theme)
+	var errs []error
+
+	// ReadDir sorts by name so the same file wins a duplicate code every time
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+
+		if entry.IsDir() || (extension != ".json" && extension != ".toml") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		theme, err := loadThemeFile(path)
+
+		if err == nil {
+			if _, exists := themes[theme.Code]; exists {
+				err = fmt.Errorf("code %q is already used by another theme file", theme.Code)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+
+		themes[theme.Code] = theme
+	}
+
+	userThemes.mu.Lock()
+	userThemes.themes = themes
+	userThemes.mu.Unlock()
+
+	return errs
+}
+
+// getUserTheme returns a copy of the user theme with the given code
+func getUserTheme(code string) (*Theme, bool) {
+	userThemes.mu.RLock()
+	defer userThemes.mu.RUnlock()
+
+	theme, ok := userThemes.themes[code]
+
+	if !ok {
+		return nil, false
+	}
+
+	themeCopy := *theme
+	themeCopy.ChatLabelColors = append([]string(nil), theme.ChatLabelColors...)
+	themeCopy.ChatLabelAttributes = append([]string(nil), theme.ChatLabelAttributes...)
+
+	return &themeCopy, true
+}
+
+// getUserThemeCodes returns the codes of the user themes in alphabetical order
+func getUserThemeCodes() []string {
+	userThemes.mu.RLock()
+	defer userThemes.mu.RUnlock()
+
+	codes := make([]string, 0, len(userThemes.themes))
+
+	for code := range userThemes.themes {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+
+	return codes
+}
+
+// loadThemeFile reads, validates and builds the theme described by a theme file
+func loadThemeFile(path string) (*Theme, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var file themeFile
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		metadata, err := toml.Decode(string(content), &file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s is not a theme setting", undecoded[0].String())
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+
+		err = decoder.Decode(&file)
+
+		if err != nil {
+			if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+				return nil, fmt.Errorf("%s is not a theme setting", strings.Trim(field, `"`))
+			}
+
+			return nil, err
+		}
+	}
+
+	if file.Code == "" {
+		file.Code = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return file.build()
+}
+
+// build validates the theme file and creates the theme from it and its base theme
+func (file themeFile) build() (*Theme, error) {
+	if !themeCodePattern.MatchString(file.Code) {
+		return nil, fmt.Errorf("code must be lower case letters, digits, - and _, got %q", file.Code)
+	}
+
+	if isBuiltIn(file.Code) {
+		return nil, fmt.Errorf("code %q is the code of a built in theme, pick another one", file.Code)
+	}
+
+	if file.Base == "" {
+		file.Base = BUILT_IN_THEME_CODES[0]
+	}
+
+	if !isBuiltIn(file.Base) {
+		return nil, fmt.Errorf("base must be one of %s, got %q", strings.Join(BUILT_IN_THEME_CODES, ", "), file.Base)
+	}
+
+	theme := newBuiltInTheme(file.Base)
+	theme.Code = file.Code
+
+	colors := []struct {
+		name   string
+		value  *string
+		target *tcell.Color
+	}{
+		{"background_color", file.BackgroundColor, &theme.BackgroundColor},
+		{"foreground_color", file.ForegroundColor, &theme.ForgroundColor},
+		{"highlight_color", file.HighlightColor, &theme.HighlightColor},
+		{"accent_color", file.AccentColor, &theme.AccentColor},
+		{"accent_color_two", file.AccentColorTwo, &theme.AccentColorTwo},
+		{"border_color", file.BorderColor, &theme.BorderColor},
+		{"title_color", file.TitleColor, &theme.TitleColor},
+		{"info_color", file.InfoColor, &theme.InfoColor},
+		{"info_color_two", file.InfoColorTwo, &theme.InfoColorTwo},
+		{"chat_text_color", file.ChatTextColor, &theme.ChatTextColor},
+		{"code_background_color", file.CodeBackgroundColor, &theme.CodeBackgroundColor},
+		{"code_text_color", file.CodeTextColor, &theme.CodeTextColor},
+		{"code_keyword_color", file.CodeKeywordColor, &theme.CodeKeywordColor},
+		{"code_string_color", file.CodeStringColor, &theme.CodeStringColor},
+		{"code_comment_color", file.CodeCommentColor, &theme.CodeCommentColor},
+	}
+
+	for _, color := range colors {
+		if color.value == nil {
+			continue
+		}
+
+		parsed, err := parseColor(color.name, *color.value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		*color.target = parsed
+	}
+
+	styles := []struct {
+		name   string
+		value  *styleFile
+		target *tcell.Style
+	}{
+		{"button_style", file.ButtonStyle, &theme.ButtonStyle},
+		{"activated_button_style", file.ActivatedButtonStyle, &theme.ActivatedButtonStyle},
+		{"dropdown_list_unselected_style", file.DropdownListUnselectedStyle, &theme.DropdownListUnselectedStyle},
+		{"dropdown_list_selected_style", file.DropdownListSelectedStyle, &theme.DropdownListSelectedStyle},
+		{"text_area_text_style", file.TextAreaTextStyle, &theme.TextAreaTextStyle},
+		{"mention_style", file.MentionStyle, &theme.MentionStyle},
+		{"connected_style", file.ConnectedStyle, &theme.ConnectedStyle},
+		{"connecting_style", file.ConnectingStyle, &theme.ConnectingStyle},
+		{"offline_style", file.OfflineStyle, &theme.OfflineStyle},
+	}
+
+	for _, style := range styles {
+		if style.value == nil {
+			continue
+		}
+
+		applied, err := style.value.apply(style.name, *style.target)
+
+		if err != nil {
+			return nil, err
+		}
+
+		*style.target = applied
+	}
+
+	if file.ChatLabelColors != nil {
+		if len(file.ChatLabelColors) == 0 {
+			return nil, errors.New("chat_label_colors must contain at least one color")
+		}
+
+		theme.ChatLabelColors = make([]string, 0, len(file.ChatLabelColors))
+
+		for i, value := range file.ChatLabelColors {
+			parsed, err := parseColor(fmt.Sprintf("chat_label_colors[%d]", i), value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// Chat labels are written as color tags which need a concrete color
+			if parsed == tcell.ColorDefault {
+				return nil, fmt.Errorf("chat_label_colors[%d] must be a hex color or color name, default is not allowed", i)
+			}
+
+			theme.ChatLabelColors = append(theme.ChatLabelColors, parsed.CSS())
+		}
+	}
+
+	return theme, nil
+}
+
+// apply returns the base style with the parts given in the style file replaced
+func (file styleFile) apply(name string, style tcell.Style) (tcell.Style, error) {
+	if file.Foreground != nil {
+		color, err := parseColor(name+".foreground", *file.Foreground)
+
+		if err != nil {
+			return style, err
+		}
+
+		style = style.Foreground(color)
+	}
+
+	if file.Background != nil {
+		color, err := parseColor(name+".background", *file.Background)
+
+		if err != nil {
+			return style, err
+		}
+
+		style = style.Background(color)
+	}
+
+	if file.Bold != nil {
+		style = style.Bold(*file.Bold)
+	}
+
+	if file.Italic != nil {
+		style = style.Italic(*file.Italic)
+	}
+
+	if file.Underline != nil {
+		style = style.Underline(*file.Underline)
+	}
+
+	return style, nil
+}
+
+// parseColor parses a hex color, a color name or default
+func parseColor(name string, value string) (tcell.Color, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.EqualFold(value, "default") {
+		return tcell.ColorDefault, nil
+	}
+
+	color := tcell.GetColor(strings.ToLower(value))
+
+	if color == tcell.ColorDefault {
+		return color, fmt.Errorf("%s must be a hex color like #1A2B3C, a color name or default, got %q", name, value)
+	}
+
+	return color, nil
+}
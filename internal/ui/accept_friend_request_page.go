@@ -3,7 +3,6 @@ package ui
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/dmars8047/brolib/chat"
 	"github.com/dmars8047/broterm/internal/state"
@@ -16,21 +15,19 @@ const ACCEPT_FRIEND_REQUEST_PAGE PageSlug = "accept_friend_request"
 
 // AcceptFriendRequestPage is the page for accepting friend requests
 type AcceptFriendRequestPage struct {
-	brochatClient       *chat.BroChatClient
+	serverClients       *state.ServerClients
 	userPendingRequests map[uint8]chat.UserRelationship
 	table               *tview.Table
 	feedClient          *state.FeedClient
-	currentThemeCode    string
 }
 
 // NewAcceptFriendRequestPage creates a new accept friend request page
-func NewAcceptFriendRequestPage(brochatClient *chat.BroChatClient, feedClient *state.FeedClient) *AcceptFriendRequestPage {
+func NewAcceptFriendRequestPage(serverClients *state.ServerClients, feedClient *state.FeedClient) *AcceptFriendRequestPage {
 	return &AcceptFriendRequestPage{
-		brochatClient:       brochatClient,
+		serverClients:       serverClients,
 		feedClient:          feedClient,
 		userPendingRequests: make(map[uint8]chat.UserRelationship, 0),
 		table:               tview.NewTable(),
-		currentThemeCode:    "NOT_SET",
 	}
 }
 
@@ -56,13 +53,13 @@ func (page *AcceptFriendRequestPage) Setup(app *tview.Application, appContext *s
 		accessToken, ok := appContext.GetAccessToken()
 
 		if !ok {
-			log.Printf("Valid user authentication information not found. Redirecting to login page.")
+			pageLogger(ACCEPT_FRIEND_REQUEST_PAGE).Info("Valid user authentication information not found, redirecting to login page")
 			nav.NavigateTo(LOGIN_PAGE, nil)
 			return
 		}
 
 		nav.Confirm(FIND_A_FRIEND_PAGE_CONFIRM, fmt.Sprintf("Accept Friend Request from %s?", selectedUser.Username), func() {
-			result := page.brochatClient.AcceptFriendRequest(accessToken, chat.AcceptFriendRequestRequest{
+			result := page.serverClients.BrochatClient().AcceptFriendRequest(accessToken, chat.AcceptFriendRequestRequest{
 				InitiatingUserId: selectedUser.UserId,
 			})
 
@@ -88,39 +85,24 @@ func (page *AcceptFriendRequestPage) Setup(app *tview.Application, appContext *s
 		})
 	})
 
+	keymap := nav.Keymap()
+
 	page.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(FRIENDS_LIST_PAGE, nil)
+		if keymap.Matches(ACTION_BACK, event) {
+			nav.BackOr(FRIENDS_LIST_PAGE)
 			page.userPendingRequests = make(map[uint8]chat.UserRelationship, 0)
 			page.table.Clear()
-		} else if event.Key() == tcell.KeyTab {
-			// Change the selected row to the next row
-			row, _ := page.table.GetSelection()
-			if row+1 >= page.table.GetRowCount() {
-				row = 1
-			} else {
-				row++
-			}
-
-			page.table.Select(row, 0)
-		} else if event.Key() == tcell.KeyBacktab {
-			// Change the selected row to the previous row
-			row, _ := page.table.GetSelection()
-
-			if row-1 < 1 {
-				row = page.table.GetRowCount() - 1
-			} else {
-				row--
-			}
-
-			page.table.Select(row, 0)
+			return nil
 		}
 
-		return event
+		return handleTableKeys(keymap, page.table, event)
 	})
 
 	tvInstructions := tview.NewTextView().SetTextAlign(tview.AlignCenter)
-	tvInstructions.SetText("(esc) Quit")
+	tvInstructions.SetText(instructions(
+		keymap.Hint("Accept Request", ACTION_SELECT),
+		keymap.Hint("Quit", ACTION_BACK),
+	))
 
 	grid := tview.NewGrid()
 	grid.SetBackgroundColor(theme.BackgroundColor)
@@ -138,27 +120,36 @@ func (page *AcceptFriendRequestPage) Setup(app *tview.Application, appContext *s
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetBordersColor(theme.BorderColor)
-			page.table.SetBorderColor(theme.BorderColor)
-			page.table.SetTitleColor(theme.TitleColor)
-			page.table.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
-			tvHeader.SetBackgroundColor(theme.BackgroundColor)
-			tvHeader.SetTextColor(theme.TitleColor)
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetBordersColor(theme.BorderColor)
+		page.table.SetBorderColor(theme.BorderColor)
+		page.table.SetTitleColor(theme.TitleColor)
+		page.table.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
+		tvHeader.SetBackgroundColor(theme.BackgroundColor)
+		tvHeader.SetTextColor(theme.TitleColor)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.InfoColor)
+
+		// Table cells keep the colors they were created with so an open table is filled again
+		if pageContext != nil && pageContext.Err() == nil {
+			page.populateTable(appContext.GetBrochatUser(), theme)
 		}
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(ACCEPT_FRIEND_REQUEST_PAGE, applyTheme)
+
+	nav.DescribeKeys(ACCEPT_FRIEND_REQUEST_PAGE,
+		KeyHelp{Action: ACTION_SELECT, Description: "Accept the selected friend request"},
+		KeyHelp{Action: ACTION_NEXT, Description: "Next request"},
+		KeyHelp{Action: ACTION_PREVIOUS, Description: "Previous request"},
+		KeyHelp{Action: ACTION_BACK, Description: "Back to the friends list"},
+	)
 
 	nav.Register(ACCEPT_FRIEND_REQUEST_PAGE, grid, true, false,
 		func(param interface{}) {
 			pageContext, cancel = appContext.GenerateUserSessionBoundContextWithCancel()
-			applyTheme()
 			page.onPageLoad(app, appContext, pageContext, page.feedClient)
 		},
 		func() {
@@ -182,7 +173,11 @@ func (page *AcceptFriendRequestPage) onPageLoad(app *tview.Application, appConte
 			select {
 			case <-pageContext.Done():
 				return
-			case updateCode := <-userProfileUpdatesChannel:
+			case updateCode, ok := <-userProfileUpdatesChannel:
+				if !ok {
+					return
+				}
+
 				if updateCode == chat.USER_PROFILE_UPDATE_REASON_RELATIONSHIP_UPDATE {
 					page.table.Clear()
 					app.QueueUpdateDraw(func() {
@@ -219,7 +214,7 @@ func (page *AcceptFriendRequestPage) populateTable(brochatUser chat.User, thm th
 
 	for _, rel := range brochatUser.Relationships {
 		if rel.Type&chat.RELATIONSHIP_TYPE_FRIEND_REQUEST_RECIEVED != 0 {
-			page.table.SetCell(row, 0, tview.NewTableCell(rel.Username).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
+			page.table.SetCell(row, 0, tview.NewTableCell(tview.Escape(rel.Username)).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
 			var dateString string = rel.LastOnlineUtc.Local().Format("Jan 2, 2006")
 			page.table.SetCell(row, 1, tview.NewTableCell(dateString).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignRight))
 
@@ -1,12 +1,12 @@
 package ui
 
 import (
-	"encoding/json"
-	"log"
-	"os"
-	"path/filepath"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/logging"
 	"github.com/dmars8047/broterm/internal/state"
 	"github.com/dmars8047/broterm/internal/theme"
 	"github.com/gdamore/tcell/v2"
@@ -15,27 +15,40 @@ import (
 
 const APP_SETTINGS_PAGE PageSlug = "app_settings"
 
+var (
+	logLevelOptions  = []string{"debug", "info", "warn", "error"}
+	logFormatOptions = []string{"text", "json"}
+)
+
 // AppSettingsPage is the location where users can configure application level settings.
 type AppSettingsPage struct {
-	settingsForm  *tview.Form
-	currentTheme  string
-	logginEnabled bool
+	settingsForm   *tview.Form
+	currentTheme   string
+	settings       *config.ConfigSettings
+	serverClients  *state.ServerClients
+	profileManager *state.ProfileManager
+	// The number of colors the terminal can show, used to resolve the auto color mode
+	terminalColors int
 }
 
 // NewAppSettingsPage creates a new instance of the application settings page
-func NewAppSettingsPage(logginEnabled bool) *AppSettingsPage {
+func NewAppSettingsPage(settings *config.ConfigSettings, serverClients *state.ServerClients, profileManager *state.ProfileManager) *AppSettingsPage {
 	return &AppSettingsPage{
-		settingsForm:  tview.NewForm(),
-		currentTheme:  "NOT_SET",
-		logginEnabled: logginEnabled,
+		settingsForm:   tview.NewForm(),
+		currentTheme:   "NOT_SET",
+		settings:       settings,
+		serverClients:  serverClients,
+		profileManager: profileManager,
 	}
 }
 
 // Setup configures the application settings page and registers it with the page navigator
 // The page includes a form which allows the user to set the following settings:
-// The host address of the server
-// The theme (default, america, matrix, halloween, and morning)
-// The log and setting config file storage location
+// The theme, chosen from the built-in and user themes, which is previewed while it is selected
+// The color mode, colorblind safe labels, timestamp format, Markdown and syntax highlighting
+// Whether log files are kept along with the log level and format
+// The server host, scheme, port and TLS settings
+// While a profile is active the theme and server are saved to the profile
 func (page *AppSettingsPage) Setup(app *tview.Application, appContext *state.ApplicationContext, nav *PageNavigator) {
 	const title = " BroChat - Application Settings "
 
@@ -48,11 +61,11 @@ func (page *AppSettingsPage) Setup(app *tview.Application, appContext *state.App
 	page.settingsForm.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignCenter)
 
 	// Dropdown for theme selection
-	page.settingsForm.AddDropDown("Theme: ", []string{"default", "america", "matrix", "halloween", "christmas", "satanic"}, 0, nil)
+	page.settingsForm.AddDropDown("Theme: ", theme.Codes(), 0, nil)
 
 	page.settingsForm.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(WELCOME_PAGE, nil)
+		if nav.Keymap().MatchesInText(ACTION_BACK, event) {
+			nav.BackOr(WELCOME_PAGE)
 			return nil
 		}
 
@@ -89,7 +102,19 @@ func (page *AppSettingsPage) Setup(app *tview.Application, appContext *state.App
 		if ok {
 			themeDropdown.SetListStyles(theme.DropdownListUnselectedStyle, theme.DropdownListSelectedStyle)
 		} else {
-			log.Printf("Theme dropdown form access failure on theme change for settings page")
+			pageLogger(APP_SETTINGS_PAGE).Error("Theme dropdown form access failure on theme change")
+		}
+
+		schemeDropdown, ok := page.settingsForm.GetFormItemByLabel("Server Scheme: ").(*tview.DropDown)
+
+		if ok {
+			schemeDropdown.SetListStyles(theme.DropdownListUnselectedStyle, theme.DropdownListSelectedStyle)
+		}
+
+		for _, label := range []string{"Color Mode: ", "Timestamps: ", "Log Level: ", "Log Format: "} {
+			if logDropdown, ok := page.settingsForm.GetFormItemByLabel(label).(*tview.DropDown); ok {
+				logDropdown.SetListStyles(theme.DropdownListUnselectedStyle, theme.DropdownListSelectedStyle)
+			}
 		}
 
 		page.currentTheme = theme.Code
@@ -99,15 +124,27 @@ func (page *AppSettingsPage) Setup(app *tview.Application, appContext *state.App
 	themeDropdown, ok := page.settingsForm.GetFormItemByLabel("Theme: ").(*tview.DropDown)
 
 	if !ok {
-		log.Printf("Theme dropdown form access failure on setup for settings page")
+		pageLogger(APP_SETTINGS_PAGE).Error("Theme dropdown form access failure on setup")
 	} else {
 		themeDropdown.SetSelectedFunc(func(text string, index int) {
-			preview := theme.NewTheme(text)
+			preview := appContext.GetThemeRegistry().Preview(text)
 			applyTheme(preview)
 		})
 	}
 
+	page.settingsForm.AddDropDown("Color Mode: ", theme.ColorModeSettings(), 0, nil)
+	page.settingsForm.AddCheckbox("Colorblind Safe Labels: ", false, nil)
+	page.settingsForm.AddDropDown("Timestamps: ", config.TimestampFormats(), 0, nil)
+	page.settingsForm.AddCheckbox("Render Markdown: ", false, nil)
+	page.settingsForm.AddCheckbox("Syntax Highlighting: ", true, nil)
 	page.settingsForm.AddCheckbox("Keep Error Log Files: ", true, nil)
+	page.settingsForm.AddDropDown("Log Level: ", logLevelOptions, 1, nil)
+	page.settingsForm.AddDropDown("Log Format: ", logFormatOptions, 0, nil)
+	page.settingsForm.AddInputField("Server Host: ", "", 0, nil, nil)
+	page.settingsForm.AddDropDown("Server Scheme: ", []string{"https", "http"}, 0, nil)
+	page.settingsForm.AddInputField("Server Port: ", "", 6, tview.InputFieldInteger, nil)
+	page.settingsForm.AddCheckbox("Verify TLS Certificates: ", true, nil)
+	page.settingsForm.AddInputField("CA Certificate Path: ", "", 0, nil, nil)
 
 	// Add the save and back buttons
 	page.settingsForm.AddButton("Save & Apply", func() {
@@ -116,7 +153,7 @@ func (page *AppSettingsPage) Setup(app *tview.Application, appContext *state.App
 		logsCheckbox, ok := page.settingsForm.GetFormItemByLabel("Keep Error Log Files: ").(*tview.Checkbox)
 
 		if !ok {
-			log.Printf("Logs checkbox form access failure on save for settings page")
+			pageLogger(APP_SETTINGS_PAGE).Error("Logs checkbox form access failure on save")
 			panic("logs checkbox form access failure")
 		}
 
@@ -124,99 +161,406 @@ func (page *AppSettingsPage) Setup(app *tview.Application, appContext *state.App
 		themeDropdown, ok := page.settingsForm.GetFormItemByLabel("Theme: ").(*tview.DropDown)
 
 		if !ok {
-			log.Printf("Theme dropdown form access failure on save for settings page")
+			pageLogger(APP_SETTINGS_PAGE).Error("Theme dropdown form access failure on save")
 			panic("theme dropdown form access failure")
 		}
 
 		_, themeText := themeDropdown.GetCurrentOption()
 
-		appSettings := config.NewConfigSettings()
-		appSettings.Theme = themeText
-		appSettings.LoggingEnabled = logsCheckbox.IsChecked()
+		serverSettings, err := page.getServerSettings()
 
-		bytesToSave, err := json.Marshal(appSettings)
+		if err == nil {
+			err = serverSettings.Validate()
+		}
+
+		if err == nil {
+			_, err = serverSettings.TLSConfig()
+		}
 
 		if err != nil {
-			log.Printf("Error marshalling app settings: %v", err)
-			panic("error marshalling app settings")
+			nav.Alert("settings:alert:err", "Invalid Server Settings - "+err.Error())
+			return
 		}
 
-		homeDir, err := os.UserHomeDir()
+		// The changes are made to a copy so the settings in use are untouched if they cannot be saved
+		updatedSettings := *page.settings
+		updatedSettings.Profiles = append([]config.Profile(nil), page.settings.Profiles...)
+
+		// While a profile is active the server and theme belong to the profile
+		if profile, ok := updatedSettings.GetProfile(updatedSettings.ActiveProfile); ok {
+			profile.Theme = themeText
+			profile.Server = serverSettings
+		} else {
+			updatedSettings.Theme = themeText
+			updatedSettings.Server = serverSettings
+		}
+
+		updatedSettings.Display = page.getDisplaySettings()
+		updatedSettings.Logging = page.getLoggingSettings()
+		updatedSettings.Logging.Enabled = logsCheckbox.IsChecked()
+
+		err = updatedSettings.Validate()
 
 		if err != nil {
-			log.Printf("Error getting user home directory: %v", err)
-			panic("error getting user home directory")
+			nav.Alert("settings:alert:err", "Settings Could Not Be Saved - "+err.Error())
+			return
 		}
 
-		configDir := filepath.Join(homeDir, config.DEFAULT_CONFIG_DIRECTORY_NAME)
+		// Re-point the clients before saving so the file never names a server the clients could not be pointed at.
+		// Changing the server ends the user session, like switching profiles.
+		previousServer := page.serverClients.GetSettings()
+
+		err = page.profileManager.ChangeServer(serverSettings)
 
-		//If the config directory does not exist, create it
-		if _, err := os.Stat(configDir); os.IsNotExist(err) {
-			err = os.Mkdir(configDir, os.ModePerm)
+		if err != nil {
+			nav.Alert("settings:alert:err", "Server Settings Could Not Be Applied - "+err.Error())
+			return
+		}
+
+		err = config.SaveConfigSettings(&updatedSettings)
+
+		if err != nil {
+			pageLogger(APP_SETTINGS_PAGE).Error("Error writing app settings to file", "error", err)
 
-			if err != nil {
-				log.Printf("Error creating config directory: %v", err)
-				panic("error creating config directory")
+			// Keep the clients matching the settings in use
+			if revertErr := page.profileManager.ChangeServer(previousServer); revertErr != nil {
+				pageLogger(APP_SETTINGS_PAGE).Error("Server clients could not be pointed back at the previous server", "error", revertErr)
 			}
+
+			nav.Alert("settings:alert:err", "Settings Could Not Be Saved - "+err.Error())
+			return
 		}
 
-		configFilePath := filepath.Join(configDir, config.CONFIG_FILE_NAME)
+		*page.settings = updatedSettings
 
-		err = os.WriteFile(configFilePath, bytesToSave, 0644)
+		err = logging.Reconfigure(page.settings.Logging)
 
 		if err != nil {
-			log.Printf("Error writing app settings to file: %v", err)
-			panic("error writing app settings to file")
+			nav.Alert("settings:alert:err", "Logging Settings Could Not Be Applied - "+err.Error())
+			return
 		}
 
 		// Save the theme to the config
+		appContext.GetThemeRegistry().SetDisplayOptions(page.settings.Display.DisplayOptions(page.terminalColors))
 		appContext.SetTheme(themeText)
-		page.logginEnabled = logsCheckbox.IsChecked()
 
 		nav.AlertWithDoneFunc("Settings Saved", "Settings have been saved and applied. Some settings may require an application restart.", func(_ int, _ string) {
-			nav.NavigateTo(WELCOME_PAGE, nil)
+			nav.BackOr(WELCOME_PAGE)
 		})
 	})
 
 	page.settingsForm.AddButton("Back", func() {
-		nav.NavigateTo(WELCOME_PAGE, nil)
+		nav.BackOr(WELCOME_PAGE)
 	})
 
 	grid.AddItem(page.settingsForm, 1, 1, 1, 1, 0, 0, true)
 
+	nav.SubscribeToThemeChanges(APP_SETTINGS_PAGE, func() {
+		// Keep showing the theme being previewed, rebuilt in case its theme file has changed
+		if nav.current == APP_SETTINGS_PAGE {
+			_, previewCode := themeDropdown.GetCurrentOption()
+			applyTheme(appContext.GetThemeRegistry().Preview(previewCode))
+			return
+		}
+
+		applyTheme(nil)
+	})
+
+	nav.DescribeKeys(APP_SETTINGS_PAGE,
+		KeyHelp{Action: ACTION_BACK, Description: "Leave without saving"},
+	)
+
 	nav.Register(APP_SETTINGS_PAGE, grid, true, false, func(param interface{}) {
 		applyTheme(nil)
 		page.settingsForm.SetFocus(0)
 
-		// Set the dropdown to the current theme
-		switch page.currentTheme {
-		case "default":
-			themeDropdown.SetCurrentOption(0)
-		case "america":
-			themeDropdown.SetCurrentOption(1)
-		case "matrix":
-			themeDropdown.SetCurrentOption(2)
-		case "halloween":
-			themeDropdown.SetCurrentOption(3)
-		case "christmas":
-			themeDropdown.SetCurrentOption(4)
-		case "satanic":
-			themeDropdown.SetCurrentOption(5)
-		default:
-			themeDropdown.SetCurrentOption(0)
+		// Refresh the themes in case theme files were added and select the current one
+		themeCodes := theme.Codes()
+		themeDropdown.SetOptions(themeCodes, nil)
+		themeDropdown.SetCurrentOption(0)
+
+		for i, code := range themeCodes {
+			if code == page.currentTheme {
+				themeDropdown.SetCurrentOption(i)
+			}
 		}
 
 		// Set the logs checkbox to the current value
 		logsCheckbox, ok := page.settingsForm.GetFormItemByLabel("Keep Error Log Files: ").(*tview.Checkbox)
 
 		if !ok {
-			log.Printf("Logs checkbox form access failure on open for settings page")
+			pageLogger(APP_SETTINGS_PAGE).Error("Logs checkbox form access failure on open")
 			panic("logs checkbox form access failure")
 		}
 
-		logsCheckbox.SetChecked(page.logginEnabled)
+		logsCheckbox.SetChecked(page.settings.Logging.Enabled)
+
+		page.setDisplaySettings(page.settings.Display)
+		page.setLoggingSettings(page.settings.Logging)
+
+		page.setServerSettings(page.serverClients.GetSettings())
 
 	}, func() {
 		applyTheme(nil)
 	})
 }
+
+// SetTerminalColors sets the number of colors the terminal can show, which decides the color mode when it is set to auto
+func (page *AppSettingsPage) SetTerminalColors(terminalColors int) {
+	page.terminalColors = terminalColors
+}
+
+// getDisplaySettings reads the display settings from the form
+func (page *AppSettingsPage) getDisplaySettings() config.DisplaySettings {
+	colorModeDropdown, ok := page.settingsForm.GetFormItemByLabel("Color Mode: ").(*tview.DropDown)
+
+	if !ok {
+		panic("color mode dropdown form access failure")
+	}
+
+	labelsCheckbox, ok := page.settingsForm.GetFormItemByLabel("Colorblind Safe Labels: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("colorblind safe labels checkbox form access failure")
+	}
+
+	timestampDropdown, ok := page.settingsForm.GetFormItemByLabel("Timestamps: ").(*tview.DropDown)
+
+	if !ok {
+		panic("timestamp format dropdown form access failure")
+	}
+
+	markdownCheckbox, ok := page.settingsForm.GetFormItemByLabel("Render Markdown: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("render markdown checkbox form access failure")
+	}
+
+	highlightingCheckbox, ok := page.settingsForm.GetFormItemByLabel("Syntax Highlighting: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("syntax highlighting checkbox form access failure")
+	}
+
+	settings := page.settings.Display
+
+	_, settings.ColorMode = colorModeDropdown.GetCurrentOption()
+	settings.ColorblindSafeLabels = labelsCheckbox.IsChecked()
+	_, settings.TimestampFormat = timestampDropdown.GetCurrentOption()
+	settings.Markdown = markdownCheckbox.IsChecked()
+	settings.SyntaxHighlighting = highlightingCheckbox.IsChecked()
+
+	return settings
+}
+
+// setDisplaySettings shows the display settings in the form
+func (page *AppSettingsPage) setDisplaySettings(settings config.DisplaySettings) {
+	colorModeDropdown, ok := page.settingsForm.GetFormItemByLabel("Color Mode: ").(*tview.DropDown)
+
+	if !ok {
+		panic("color mode dropdown form access failure")
+	}
+
+	labelsCheckbox, ok := page.settingsForm.GetFormItemByLabel("Colorblind Safe Labels: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("colorblind safe labels checkbox form access failure")
+	}
+
+	timestampDropdown, ok := page.settingsForm.GetFormItemByLabel("Timestamps: ").(*tview.DropDown)
+
+	if !ok {
+		panic("timestamp format dropdown form access failure")
+	}
+
+	markdownCheckbox, ok := page.settingsForm.GetFormItemByLabel("Render Markdown: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("render markdown checkbox form access failure")
+	}
+
+	highlightingCheckbox, ok := page.settingsForm.GetFormItemByLabel("Syntax Highlighting: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("syntax highlighting checkbox form access failure")
+	}
+
+	colorModeDropdown.SetCurrentOption(0)
+
+	for i, colorMode := range theme.ColorModeSettings() {
+		if strings.EqualFold(colorMode, settings.ColorMode) {
+			colorModeDropdown.SetCurrentOption(i)
+		}
+	}
+
+	labelsCheckbox.SetChecked(settings.ColorblindSafeLabels)
+
+	timestampDropdown.SetCurrentOption(0)
+
+	for i, format := range config.TimestampFormats() {
+		if format == settings.TimestampFormat {
+			timestampDropdown.SetCurrentOption(i)
+		}
+	}
+
+	markdownCheckbox.SetChecked(settings.Markdown)
+	highlightingCheckbox.SetChecked(settings.SyntaxHighlighting)
+}
+
+// getLoggingSettings reads the log level and format from the form, the remaining logging settings are kept as they are
+func (page *AppSettingsPage) getLoggingSettings() config.LoggingSettings {
+	levelDropdown, ok := page.settingsForm.GetFormItemByLabel("Log Level: ").(*tview.DropDown)
+
+	if !ok {
+		panic("log level dropdown form access failure")
+	}
+
+	formatDropdown, ok := page.settingsForm.GetFormItemByLabel("Log Format: ").(*tview.DropDown)
+
+	if !ok {
+		panic("log format dropdown form access failure")
+	}
+
+	settings := page.settings.Logging
+
+	_, settings.Level = levelDropdown.GetCurrentOption()
+	_, settings.Format = formatDropdown.GetCurrentOption()
+
+	return settings
+}
+
+// setLoggingSettings selects the log level and format in the form
+func (page *AppSettingsPage) setLoggingSettings(settings config.LoggingSettings) {
+	levelDropdown, ok := page.settingsForm.GetFormItemByLabel("Log Level: ").(*tview.DropDown)
+
+	if !ok {
+		panic("log level dropdown form access failure")
+	}
+
+	formatDropdown, ok := page.settingsForm.GetFormItemByLabel("Log Format: ").(*tview.DropDown)
+
+	if !ok {
+		panic("log format dropdown form access failure")
+	}
+
+	levelDropdown.SetCurrentOption(1)
+
+	for i, level := range logLevelOptions {
+		if strings.EqualFold(level, settings.Level) {
+			levelDropdown.SetCurrentOption(i)
+		}
+	}
+
+	formatDropdown.SetCurrentOption(0)
+
+	for i, format := range logFormatOptions {
+		if format == settings.Format {
+			formatDropdown.SetCurrentOption(i)
+		}
+	}
+}
+
+// getServerSettings reads the server settings from the form
+func (page *AppSettingsPage) getServerSettings() (config.ServerSettings, error) {
+	hostInput, ok := page.settingsForm.GetFormItemByLabel("Server Host: ").(*tview.InputField)
+
+	if !ok {
+		panic("server host input form access failure")
+	}
+
+	schemeDropdown, ok := page.settingsForm.GetFormItemByLabel("Server Scheme: ").(*tview.DropDown)
+
+	if !ok {
+		panic("server scheme dropdown form access failure")
+	}
+
+	portInput, ok := page.settingsForm.GetFormItemByLabel("Server Port: ").(*tview.InputField)
+
+	if !ok {
+		panic("server port input form access failure")
+	}
+
+	verifyCheckbox, ok := page.settingsForm.GetFormItemByLabel("Verify TLS Certificates: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("verify tls checkbox form access failure")
+	}
+
+	caPathInput, ok := page.settingsForm.GetFormItemByLabel("CA Certificate Path: ").(*tview.InputField)
+
+	if !ok {
+		panic("ca path input form access failure")
+	}
+
+	_, scheme := schemeDropdown.GetCurrentOption()
+
+	port := 0
+	portText := strings.TrimSpace(portInput.GetText())
+
+	if portText != "" {
+		var err error
+		port, err = strconv.Atoi(portText)
+
+		if err != nil {
+			return config.ServerSettings{}, fmt.Errorf("server port must be a number, got %q", portText)
+		}
+	}
+
+	return config.ServerSettings{
+		Host:          strings.TrimSpace(hostInput.GetText()),
+		Scheme:        scheme,
+		Port:          port,
+		SkipTLSVerify: !verifyCheckbox.IsChecked(),
+		CAPath:        strings.TrimSpace(caPathInput.GetText()),
+	}, nil
+}
+
+// setServerSettings fills the server fields of the form
+func (page *AppSettingsPage) setServerSettings(settings config.ServerSettings) {
+	hostInput, ok := page.settingsForm.GetFormItemByLabel("Server Host: ").(*tview.InputField)
+
+	if !ok {
+		panic("server host input form access failure")
+	}
+
+	schemeDropdown, ok := page.settingsForm.GetFormItemByLabel("Server Scheme: ").(*tview.DropDown)
+
+	if !ok {
+		panic("server scheme dropdown form access failure")
+	}
+
+	portInput, ok := page.settingsForm.GetFormItemByLabel("Server Port: ").(*tview.InputField)
+
+	if !ok {
+		panic("server port input form access failure")
+	}
+
+	verifyCheckbox, ok := page.settingsForm.GetFormItemByLabel("Verify TLS Certificates: ").(*tview.Checkbox)
+
+	if !ok {
+		panic("verify tls checkbox form access failure")
+	}
+
+	caPathInput, ok := page.settingsForm.GetFormItemByLabel("CA Certificate Path: ").(*tview.InputField)
+
+	if !ok {
+		panic("ca path input form access failure")
+	}
+
+	hostInput.SetText(settings.Host)
+
+	if settings.Scheme == "http" {
+		schemeDropdown.SetCurrentOption(1)
+	} else {
+		schemeDropdown.SetCurrentOption(0)
+	}
+
+	if settings.Port == 0 {
+		portInput.SetText("")
+	} else {
+		portInput.SetText(strconv.Itoa(settings.Port))
+	}
+
+	verifyCheckbox.SetChecked(!settings.SkipTLSVerify)
+	caPathInput.SetText(settings.CAPath)
+}
@@ -3,11 +3,13 @@ package ui
 import (
 	"context"
 	"fmt"
-	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
 	"github.com/dmars8047/broterm/internal/state"
 	"github.com/dmars8047/broterm/internal/theme"
 	"github.com/gdamore/tcell/v2"
@@ -16,24 +18,66 @@ import (
 
 const CHAT_PAGE PageSlug = "chat"
 
+// MAX_INPUT_HISTORY_LENGTH is how many sent messages can be recalled into the composer
+const MAX_INPUT_HISTORY_LENGTH = 100
+
+const CHAT_PAGE_SEND_FAILURE_MESSAGE = "Macro not sent - the connection to BroChat is down. Your macro has been kept so you can send it again once reconnected."
+
 // ChatPage is the chat page
 type ChatPage struct {
-	brochatClient    *chat.BroChatClient
-	feedClient       *state.FeedClient
-	textView         *tview.TextView
-	textArea         *tview.TextArea
-	mu               sync.Mutex
-	currentThemeCode string
+	serverClients  *state.ServerClients
+	feedClient     *state.FeedClient
+	mentions       *state.MentionTracker
+	settings       *config.ConfigSettings
+	textView       *tview.TextView
+	textArea       *tview.TextArea
+	tvInstructions *tview.TextView
+	// The instruction bar text, and the one shown while messages failed to send, described with the active keymap
+	instructions       string
+	failedInstructions string
+	// The loaded messages, oldest first. They are kept unformatted so the transcript can be redrawn when the theme changes.
+	messages []chat.ChatMessage
+	// The members of the channel, used to look up the sender of a message
+	channelUsers []chat.UserInfo
+	// The users chat label colors are assigned to, including those who have left the channel since the page was opened
+	manifestUsers []chat.UserInfo
+	// The id and username of the logged in user, shown on undelivered messages
+	userId        string
+	username      string
+	outboxEntries []state.OutboxEntry
+	// The id of the open channel
+	channelId string
+	// The unsent text of the composer by channel id, kept while the chat is closed
+	drafts map[string]string
+	// The messages sent from the composer, oldest first
+	inputHistory []string
+	// The position of the message recalled from the input history, the length of the history when none is
+	inputHistoryPosition int
+	// The text which was being written before a message was recalled from the input history
+	inputHistoryDraft string
+	// The @username being completed in the composer, nil when none is
+	mentionCompletion *mentionCompletion
+	// Whether any of the undelivered messages failed to send, which changes the instruction bar
+	hasFailedEntries bool
+	// Whether messages are shown exactly as written, so they can be copied
+	showRaw bool
+	// The width of the transcript the messages were last wrapped at
+	renderedWidth int
+	mu            sync.Mutex
 }
 
-// NewChatPage creates a new chat page
-func NewChatPage(brochatClient *chat.BroChatClient, feedClient *state.FeedClient) *ChatPage {
+// NewChatPage creates a new chat page. Messages are shown with the display settings.
+// Opening a chat marks the mentions of the user in it as read in the mention tracker.
+func NewChatPage(serverClients *state.ServerClients, feedClient *state.FeedClient, mentions *state.MentionTracker, settings *config.ConfigSettings) *ChatPage {
 	return &ChatPage{
-		brochatClient:    brochatClient,
-		feedClient:       feedClient,
-		textView:         tview.NewTextView(),
-		textArea:         tview.NewTextArea(),
-		currentThemeCode: "NOT_SET",
+		serverClients:  serverClients,
+		feedClient:     feedClient,
+		mentions:       mentions,
+		settings:       settings,
+		drafts:         make(map[string]string),
+		textView:       tview.NewTextView(),
+		textArea:       tview.NewTextArea(),
+		tvInstructions: tview.NewTextView(),
 	}
 }
 
@@ -42,6 +86,8 @@ func (page *ChatPage) Setup(app *tview.Application, appContext *state.Applicatio
 	page.textView.SetDynamicColors(true)
 	page.textView.SetBorder(true)
 	page.textView.SetScrollable(true)
+	// Messages are wrapped by the renderer so code blocks can be left unwrapped
+	page.textView.SetWrap(false)
 
 	page.textView.SetChangedFunc(func() {
 		app.Draw()
@@ -49,9 +95,24 @@ func (page *ChatPage) Setup(app *tview.Application, appContext *state.Applicatio
 
 	page.textArea.SetBorder(true)
 
-	tvInstructions := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	page.tvInstructions.SetTextAlign(tview.AlignCenter)
+	keymap := nav.Keymap()
+
+	page.instructions = instructions(
+		keymap.TextHint("Send", ACTION_SEND_MESSAGE),
+		keymap.TextHint("New Line", ACTION_NEW_LINE),
+		keymap.TextHint("Scroll", ACTION_SCROLL_UP, ACTION_SCROLL_DOWN),
+		keymap.TextHint("Raw Text", ACTION_TOGGLE_RAW),
+		keymap.TextHint("Back", ACTION_BACK),
+	)
+
+	page.failedInstructions = instructions(
+		keymap.TextHint("Resend Failed", ACTION_RESEND_FAILED),
+		keymap.TextHint("Discard Failed", ACTION_DISCARD_FAILED),
+		keymap.TextHint("Back", ACTION_BACK),
+	)
 
-	tvInstructions.SetText("(enter) Send - (pgup/pgdn) Scroll - (esc) Back")
+	page.tvInstructions.SetText(page.instructions)
 
 	grid := tview.NewGrid()
 
@@ -60,7 +121,7 @@ func (page *ChatPage) Setup(app *tview.Application, appContext *state.Applicatio
 
 	grid.AddItem(page.textView, 0, 0, 1, 1, 0, 0, false)
 	grid.AddItem(page.textArea, 1, 0, 1, 1, 0, 0, true)
-	grid.AddItem(tvInstructions, 2, 0, 1, 1, 0, 0, false)
+	grid.AddItem(page.tvInstructions, 2, 0, 1, 1, 0, 0, false)
 
 	var pageContext context.Context
 	var cancel context.CancelFunc
@@ -68,28 +129,62 @@ func (page *ChatPage) Setup(app *tview.Application, appContext *state.Applicatio
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.textView.SetBackgroundColor(theme.BackgroundColor)
-			page.textView.SetBorderColor(theme.BorderColor)
-			page.textView.SetTitleColor(theme.TitleColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.textView.SetBackgroundColor(theme.BackgroundColor)
+		page.textView.SetBorderColor(theme.BorderColor)
+		page.textView.SetTitleColor(theme.TitleColor)
 
-			page.textArea.SetTextStyle(theme.TextAreaTextStyle)
-			page.textArea.SetBorderColor(theme.BorderColor)
-			page.textArea.SetTitleColor(theme.TitleColor)
-			page.textArea.SetBorderStyle(theme.TextAreaTextStyle)
+		page.textArea.SetTextStyle(theme.TextAreaTextStyle)
+		page.textArea.SetBorderColor(theme.BorderColor)
+		page.textArea.SetTitleColor(theme.TitleColor)
+		page.textArea.SetBorderStyle(theme.TextAreaTextStyle)
 
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
+		page.tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		page.tvInstructions.SetTextColor(theme.InfoColor)
+
+		// The transcript has the colors written into it so an open chat is drawn again with the new ones
+		if pageContext != nil && pageContext.Err() == nil {
+			page.mu.Lock()
+			page.redraw(theme)
+			page.mu.Unlock()
 		}
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(CHAT_PAGE, applyTheme)
+
+	// The messages are wrapped at the width of the transcript so they are drawn again when it changes
+	page.textView.SetDrawFunc(func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
+		if pageContext != nil && pageContext.Err() == nil && width-2 != page.renderedWidth {
+			app.QueueUpdateDraw(func() {
+				page.mu.Lock()
+				defer page.mu.Unlock()
+
+				page.redraw(appContext.GetTheme())
+			})
+		}
+
+		// The inner rect within the border
+		return x + 1, y + 1, width - 2, height - 2
+	})
+
+	nav.DescribeKeys(CHAT_PAGE,
+		KeyHelp{Action: ACTION_SEND_MESSAGE},
+		KeyHelp{Action: ACTION_NEW_LINE},
+		KeyHelp{Action: ACTION_OPEN_EDITOR},
+		KeyHelp{Action: ACTION_COMPLETE_MENTION},
+		KeyHelp{Action: ACTION_HISTORY_PREVIOUS},
+		KeyHelp{Action: ACTION_HISTORY_NEXT},
+		KeyHelp{Action: ACTION_SCROLL_UP},
+		KeyHelp{Action: ACTION_SCROLL_DOWN},
+		KeyHelp{Action: ACTION_RESEND_FAILED},
+		KeyHelp{Action: ACTION_DISCARD_FAILED},
+		KeyHelp{Action: ACTION_TOGGLE_RAW},
+		KeyHelp{Action: ACTION_BACK, Description: "Leave the chat"},
+	)
 
 	nav.Register(CHAT_PAGE, grid, true, false,
 		func(param interface{}) {
-			applyTheme()
 			pageContext, cancel = appContext.GenerateUserSessionBoundContextWithCancel()
 			page.onPageLoad(param, app, appContext, nav, pageContext)
 		},
@@ -114,16 +209,18 @@ func (page *ChatPage) onPageLoad(param interface{},
 		return
 	}
 
+	logger := pageLogger(CHAT_PAGE).With("channel_id", chatParam.channel_id)
+
 	accessToken, ok := appContext.GetAccessToken()
 
 	if !ok {
-		log.Printf("Valid user authentication information not found. Redirecting to login page.")
+		logger.Info("Valid user authentication information not found, redirecting to login page")
 		nav.NavigateTo(LOGIN_PAGE, nil)
 		return
 	}
 
 	// Get the channel
-	getChannelResult := page.brochatClient.GetChannel(accessToken, chatParam.channel_id)
+	getChannelResult := page.serverClients.BrochatClient().GetChannel(accessToken, chatParam.channel_id)
 
 	err := getChannelResult.Err()
 
@@ -145,22 +242,17 @@ func (page *ChatPage) onPageLoad(param interface{},
 	channel := getChannelResult.Content
 
 	if channel.Type == chat.CHANNEL_TYPE_DIRECT_MESSAGE {
-		page.textView.SetTitle(fmt.Sprintf(" %s - %s ", channel.Users[0].Username, channel.Users[1].Username))
+		page.textView.SetTitle(fmt.Sprintf(" %s - %s ", tview.Escape(channel.Users[0].Username), tview.Escape(channel.Users[1].Username)))
 	} else if chatParam.title != "" {
-		page.textView.SetTitle(fmt.Sprintf(" %s ", chatParam.title))
+		page.textView.SetTitle(fmt.Sprintf(" %s ", tview.Escape(chatParam.title)))
 	}
 
-	theme := appContext.GetTheme()
-
-	// Get the color manifest
-	colorManifest := getColorManifest(channel.Users, theme)
-
 	const pageSize = 100
 	entireConversationLoaded := false
 	oldestMessageId := ""
 
 	// Get the channel messages
-	getChannelMessagesResult := page.brochatClient.GetChannelMessages(accessToken, chatParam.channel_id, chat.GetChannelMessages_Page(1), chat.GetChannelMessages_PageSize(pageSize))
+	getChannelMessagesResult := page.serverClients.BrochatClient().GetChannelMessages(accessToken, chatParam.channel_id, chat.GetChannelMessages_Page(1), chat.GetChannelMessages_PageSize(pageSize))
 
 	err = getChannelMessagesResult.Err()
 
@@ -187,63 +279,61 @@ func (page *ChatPage) onPageLoad(param interface{},
 		oldestMessageId = messages[len(messages)-1].Id
 	}
 
-	// Write the messages to the text view
-	w := page.textView.BatchWriter()
-	defer w.Close()
-	w.Clear()
-
-	for i := len(messages) - 1; i >= 0; i-- {
-		// Write the messages to the text view
-		var senderUsername string
-		var msg = messages[i]
-
-		color := colorManifest[msg.SenderUserId]
-
-		for _, u := range channel.Users {
-			if u.Id == msg.SenderUserId {
-				senderUsername = u.Username
-				break
-			}
-		}
-
-		// If for some reason the user info is not found just make the username "Unknown User"
-		if senderUsername == "" {
-			senderUsername = "Unknown User"
-		}
+	brochatUser := appContext.GetBrochatUser()
+	outbox := page.feedClient.GetOutbox()
 
-		// If the color is not found then just make it red
-		if color == "" {
-			color = "#FF0000"
-		}
-
-		var dateString string
-
-		// If the message is from a date in the past (not today) then format the date string differently
-		if msg.RecievedAtUtc.Local().Day() == time.Now().Day() {
-			dateString = msg.RecievedAtUtc.Local().Format(time.Kitchen)
-		} else {
-			dateString = msg.RecievedAtUtc.Local().Format("Jan 2, 2006 3:04 PM")
-		}
-
-		msgString := fmt.Sprintf("[%s]%s [%s][%s]: %s", color, senderUsername, dateString, theme.ChatTextColor.CSS(), msg.Content)
-		fmt.Fprintln(w, msgString)
+	// Drafts and sent messages belong to the user who wrote them
+	if brochatUser.Id != page.userId {
+		page.drafts = make(map[string]string)
+		page.inputHistory = nil
 	}
 
+	page.channelId = channel.Id
+	page.textArea.SetText(page.drafts[channel.Id], true)
+	page.inputHistoryPosition = len(page.inputHistory)
+	page.inputHistoryDraft = ""
+
+	page.mu.Lock()
+	page.messages = reverseMessages(messages)
+	page.channelUsers = channel.Users
+	page.manifestUsers = channel.Users
+	page.userId = brochatUser.Id
+	page.username = brochatUser.Username
+	page.outboxEntries = outbox.GetEntries(brochatUser.Id, channel.Id)
+	page.redraw(appContext.GetTheme())
+	page.mu.Unlock()
+
 	page.textView.ScrollToEnd()
 
+	page.mentions.MarkRead(brochatUser.Id, channel.Id)
+
 	// Tell the server that this is the active channel
 	page.feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_SET_ACTIVE_CHANNEL_REQUEST, &chat.SetActiveChannelRequest{
 		ChannelId: channel.Id,
 	})
 
+	keymap := nav.Keymap()
+
 	page.textArea.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyPgUp {
+		// Any other key finishes completing the mention
+		if page.mentionCompletion != nil && !keymap.MatchesInText(ACTION_COMPLETE_MENTION, event) {
+			page.mentionCompletion = nil
+			page.updateInstructions()
+		}
+
+		if keymap.MatchesInText(ACTION_COMPLETE_MENTION, event) {
+			if page.completeMention() {
+				return nil
+			}
+
+			return event
+		} else if keymap.MatchesInText(ACTION_SCROLL_UP, event) {
 			// scroll up 10 lines
 			r, _ := page.textView.GetScrollOffset()
 
 			if r == 0 {
 				if !entireConversationLoaded {
-					getChannelMessagesResult := page.brochatClient.GetChannelMessages(accessToken, chatParam.channel_id,
+					getChannelMessagesResult := page.serverClients.BrochatClient().GetChannelMessages(accessToken, chatParam.channel_id,
 						chat.GetChannelMessages_Page(1),
 						chat.GetChannelMessages_PageSize(pageSize),
 						chat.GetChannelMessages_BeforeMessage(oldestMessageId))
@@ -276,52 +366,8 @@ func (page *ChatPage) onPageLoad(param interface{},
 						oldestMessageId = messages[len(messages)-1].Id
 					}
 
-					oldText := []byte(page.textView.GetText(false))
-
-					// Prepend the messages to the text view
-					writer := page.textView.BatchWriter()
-					defer writer.Close()
-
-					writer.Clear()
-
-					for i := len(messages) - 1; i >= 0; i-- {
-						// Write the messages to the text view
-						var senderUsername string
-						var msg = messages[i]
-
-						color := colorManifest[msg.SenderUserId]
-
-						for _, u := range channel.Users {
-							if u.Id == msg.SenderUserId {
-								senderUsername = u.Username
-								break
-							}
-						}
-
-						// If for some reason the user info is not found just make the username "Unknown User"
-						if senderUsername == "" {
-							senderUsername = "Unknown User"
-						}
-
-						// If the color is not found then just make it red
-						if color == "" {
-							color = "#FF0000"
-						}
-
-						var dateString string
-
-						// If the message is from a date in the past (not today) then format the date string differently
-						if msg.RecievedAtUtc.Local().Day() == time.Now().Day() {
-							dateString = msg.RecievedAtUtc.Local().Format(time.Kitchen)
-						} else {
-							dateString = msg.RecievedAtUtc.Local().Format("Jan 2, 2006 3:04 PM")
-						}
-
-						msgString := fmt.Sprintf("[%s]%s [%s][%s]: %s", color, senderUsername, dateString, theme.ChatTextColor.CSS(), msg.Content)
-						fmt.Fprintln(writer, msgString)
-					}
-
-					writer.Write(oldText)
+					page.messages = append(reverseMessages(messages), page.messages...)
+					page.redraw(appContext.GetTheme())
 
 					// Scroll to the top if there are less than 10 messages otherwise scroll up the normal 10 lines
 					if len(messages) > 10 {
@@ -336,11 +382,11 @@ func (page *ChatPage) onPageLoad(param interface{},
 
 			page.textView.ScrollTo(r-10, 0)
 			return nil
-		} else if event.Key() == tcell.KeyPgDn {
+		} else if keymap.MatchesInText(ACTION_SCROLL_DOWN, event) {
 			r, _ := page.textView.GetScrollOffset()
 			page.textView.ScrollTo(r+10, 0)
 			return nil
-		} else if event.Key() == tcell.KeyEnter {
+		} else if keymap.MatchesInText(ACTION_SEND_MESSAGE, event) {
 			text := page.textArea.GetText()
 
 			if len(text) > 0 {
@@ -348,28 +394,130 @@ func (page *ChatPage) onPageLoad(param interface{},
 				isMacro, macroType := chat.IsMacro(text)
 
 				if isMacro {
-					page.feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_MACRO_REQUEST, chat.MacroRequest{
+					err := page.feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_MACRO_REQUEST, chat.MacroRequest{
 						Type: macroType,
 						Body: text,
 					})
+
+					// Macros are not tracked by the outbox so keep the text to let the user try again once the connection is back
+					if err != nil {
+						logger.Warn("Error sending macro", "error", err)
+						nav.Alert("home:chat:alert:err", CHAT_PAGE_SEND_FAILURE_MESSAGE)
+						return nil
+					}
 				} else {
-					page.feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_CHAT_MESSAGE_REQUEST, chat.ChatMessageRequest{
+					// The outbox takes care of delivery, including while the feed is reconnecting
+					page.feedClient.QueueChatMessage(chat.ChatMessageRequest{
 						ChannelId: channel.Id,
 						Content:   text,
 					})
 				}
 
+				page.recordInput(text)
 				page.textArea.SetText("", false)
 			}
 
 			return nil
-		} else if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(chatParam.returnPage, nil)
+		} else if keymap.MatchesInText(ACTION_NEW_LINE, event) {
+			// The text area starts a new line on a plain enter
+			return tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)
+		} else if keymap.MatchesInText(ACTION_OPEN_EDITOR, event) {
+			text, err := editInEditor(app, page.textArea.GetText())
+
+			if err != nil {
+				logger.Warn("Error editing message in external editor", "error", err)
+				nav.Alert("home:chat:alert:err", "The message could not be edited - "+err.Error())
+				return nil
+			}
+
+			page.textArea.SetText(text, true)
+
+			return nil
+		} else if keymap.MatchesInText(ACTION_HISTORY_PREVIOUS, event) && page.isCursorOnFirstLine() && page.recallInput(-1) {
+			return nil
+		} else if keymap.MatchesInText(ACTION_HISTORY_NEXT, event) && page.isCursorOnLastLine() && page.recallInput(1) {
+			return nil
+		} else if keymap.MatchesInText(ACTION_RESEND_FAILED, event) {
+			for _, entry := range page.failedOutboxEntries() {
+				page.feedClient.ResendChatMessage(entry.Id)
+			}
+
+			return nil
+		} else if keymap.MatchesInText(ACTION_DISCARD_FAILED, event) {
+			for _, entry := range page.failedOutboxEntries() {
+				outbox.Discard(entry.Id)
+			}
+
+			return nil
+		} else if keymap.MatchesInText(ACTION_TOGGLE_RAW, event) {
+			page.mu.Lock()
+			defer page.mu.Unlock()
+
+			// Raw messages are wrapped by the text view as they are not wrapped by the renderer
+			page.showRaw = !page.showRaw
+			page.textView.SetWrap(page.showRaw)
+			page.redraw(appContext.GetTheme())
+
+			return nil
+		} else if keymap.MatchesInText(ACTION_BACK, event) {
+			nav.BackOr(HOME_PAGE)
+			return nil
 		}
 
 		return event
 	})
 
+	// Start the listener for connection state changes
+	// Input is disabled while the feed is down so nothing is typed into the void
+	go func() {
+		subscriptionId, connStateChannel := page.feedClient.SubscribeToConnectionState()
+		defer page.feedClient.UnsubscribeFromConnectionState(subscriptionId)
+
+		for {
+			select {
+			case <-pageContext.Done():
+				return
+			case connState, ok := <-connStateChannel:
+				if !ok {
+					return
+				}
+
+				app.QueueUpdateDraw(func() {
+					page.applyConnectionState(connState)
+				})
+			}
+		}
+	}()
+
+	// Start the listener for outbox changes so pending and failed markers stay up to date
+	go func() {
+		subscriptionId, outboxUpdateChannel := outbox.SubscribeToUpdates()
+		defer outbox.UnsubscribeFromUpdates(subscriptionId)
+
+		for {
+			select {
+			case <-pageContext.Done():
+				return
+			case entry, ok := <-outboxUpdateChannel:
+				if !ok {
+					return
+				}
+
+				if entry.Request.ChannelId != channel.Id {
+					continue
+				}
+
+				app.QueueUpdateDraw(func() {
+					page.mu.Lock()
+					defer page.mu.Unlock()
+
+					page.outboxEntries = outbox.GetEntries(brochatUser.Id, channel.Id)
+					page.redraw(appContext.GetTheme())
+				})
+			}
+		}
+	}()
+
 	// Start the listener for channel updates
 	go func() {
 		subscriptionId, channelUpdateChannel := page.feedClient.SubscribeToChannelUpdates()
@@ -380,49 +528,77 @@ func (page *ChatPage) onPageLoad(param interface{},
 			select {
 			case <-pageContext.Done():
 				return
-			case eventChannelId := <-channelUpdateChannel:
-				if eventChannelId == channel.Id {
-					page.mu.Lock()
-					defer page.mu.Unlock()
+			case eventChannelId, ok := <-channelUpdateChannel:
+				if !ok {
+					return
+				}
 
+				if eventChannelId == channel.Id {
 					accessToken, ok := appContext.GetAccessToken()
 
 					if !ok {
-						log.Println("No valid authentication information available for channel update event processing")
+						logger.Warn("No valid authentication information available for channel update event processing")
 						appContext.CancelUserSession()
 						return
 					}
 
-					getChannelResult := page.brochatClient.GetChannel(accessToken, channel.Id)
+					getChannelResult := page.serverClients.BrochatClient().GetChannel(accessToken, channel.Id)
 
 					err := getChannelResult.Err()
 
 					if err != nil {
-						log.Printf("Error getting channel during channel update event processing: %s", err.Error())
-						return
+						logger.Error("Error getting channel during channel update event processing", "error", err)
+						continue
 					}
 
 					newChannel := getChannelResult.Content
 
+					page.mu.Lock()
+
 					usersForManifest := newChannel.Users
 
-					for _, u := range newChannel.Users {
-						// if the user is not in the manifest then add them
-						if _, ok := colorManifest[u.Id]; !ok {
+					// Users who left the channel keep a color so their messages stay labelled
+					for _, u := range page.manifestUsers {
+						if !containsUser(newChannel.Users, u.Id) {
 							usersForManifest = append(usersForManifest, u)
 						}
 					}
 
-					colorManifest = getColorManifest(usersForManifest, theme)
+					page.manifestUsers = usersForManifest
+					page.channelUsers = newChannel.Users
 
 					channel = newChannel
+
+					page.mu.Unlock()
 				}
 			}
 		}
 	}()
 
+	// Keep relative timestamps up to date
+	if page.settings.Display.TimestampFormat == config.TIMESTAMP_FORMAT_RELATIVE {
+		go func() {
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-pageContext.Done():
+					return
+				case <-ticker.C:
+					app.QueueUpdateDraw(func() {
+						page.mu.Lock()
+						defer page.mu.Unlock()
+
+						page.redraw(appContext.GetTheme())
+					})
+				}
+			}
+		}()
+	}
+
 	// Start the chat message listener
-	go func(ch *chat.Channel, a *tview.Application, tv *tview.TextView) {
+	go func() {
 		subscriptionId, chatMsgChannel := page.feedClient.SubscribeToChatMessages()
 		defer page.feedClient.UnsubscribeFromChatMessages(subscriptionId)
 
@@ -430,48 +606,274 @@ func (page *ChatPage) onPageLoad(param interface{},
 			select {
 			case <-pageContext.Done():
 				return
-			case msg := <-chatMsgChannel:
-				if msg.ChannelId == ch.Id {
-					a.QueueUpdateDraw(func() {
+			case msg, ok := <-chatMsgChannel:
+				if !ok {
+					return
+				}
+
+				if msg.ChannelId == chatParam.channel_id {
+					app.QueueUpdateDraw(func() {
 						page.mu.Lock()
 						defer page.mu.Unlock()
 
-						var senderUsername string
-						color := colorManifest[msg.SenderUserId]
+						page.messages = append(page.messages, msg)
+						page.redraw(appContext.GetTheme())
+						page.textView.ScrollToEnd()
+					})
+				}
+			}
+		}
+	}()
+}
 
-						for _, u := range ch.Users {
-							if u.Id == msg.SenderUserId {
-								senderUsername = u.Username
-								break
-							}
-						}
+// applyConnectionState shows the health of the feed connection on the message input
+func (page *ChatPage) applyConnectionState(connState state.ConnectionState) {
+	if connState.Status == state.CONNECTION_STATUS_CONNECTED {
+		page.textArea.SetTitle("")
+		return
+	}
 
-						// If for some reason the user info is not found just make the username "Unknown User"
-						if senderUsername == "" {
-							senderUsername = "Unknown User"
-						}
+	page.textArea.SetTitle(fmt.Sprintf(" %s... messages will be sent once connected ", connState.Status.String()))
+}
 
-						// If the color is not found then just make it red
-						if color == "" {
-							color = "#FF0000"
-						}
+// redraw writes the transcript followed by any undelivered messages to the text view using the theme's colors.
+// Must be called with the page lock held.
+func (page *ChatPage) redraw(thm theme.Theme) {
+	var w strings.Builder
 
-						dateString := msg.RecievedAtUtc.Local().Format(time.Kitchen)
+	_, _, width, _ := page.textView.GetInnerRect()
+	page.renderedWidth = width
 
-						msgString := fmt.Sprintf("[%s]%s [%s][%s]: %s", color, senderUsername, dateString, theme.ChatTextColor.CSS(), msg.Content)
-						tv.Write([]byte(msgString + "\n"))
-						tv.ScrollToEnd()
-					})
-				}
+	wrapWidth := width
+
+	if page.showRaw {
+		wrapWidth = 0
+	}
+
+	renderer := newMessageRenderer(page.channelUsers, getColorManifest(page.manifestUsers, thm), thm, page.settings.Display, page.username, wrapWidth, page.showRaw, time.Now())
+
+	for _, msg := range page.messages {
+		for _, line := range renderer.Render(msg) {
+			fmt.Fprintln(&w, line)
+		}
+	}
+
+	hasFailed := false
+
+	for _, entry := range page.outboxEntries {
+		var marker string
+
+		if entry.Status == state.OUTBOX_ENTRY_STATUS_FAILED {
+			hasFailed = true
+			marker = "[red](failed)[-]"
+		} else {
+			marker = fmt.Sprintf("[%s](sending...)[-]", thm.InfoColorTwo.CSS())
+		}
+
+		for _, line := range renderer.RenderPending(page.userId, page.username, entry.QueuedAtUtc, entry.Request.Content, marker) {
+			fmt.Fprintln(&w, line)
+		}
+	}
+
+	page.textView.SetText(w.String())
+
+	page.hasFailedEntries = hasFailed
+	page.updateInstructions()
+}
+
+// updateInstructions shows the usernames a mention can be completed to while one is being completed,
+// otherwise the instructions for the page
+func (page *ChatPage) updateInstructions() {
+	switch {
+	case page.mentionCompletion != nil:
+		completion := page.mentionCompletion
+		names := make([]string, 0, len(completion.usernames))
+
+		for _, username := range completion.usernames {
+			names = append(names, "@"+username)
+		}
+
+		page.tvInstructions.SetText(fmt.Sprintf("%d/%d: %s", completion.index+1, len(names), strings.Join(names, "  ")))
+	case page.hasFailedEntries:
+		page.tvInstructions.SetText(page.failedInstructions)
+	default:
+		page.tvInstructions.SetText(page.instructions)
+	}
+}
+
+// mentionCompletion is an @username being completed in the composer
+type mentionCompletion struct {
+	// The byte offsets of the completed mention in the composer text, the cursor is at the end
+	start int
+	end   int
+	// The usernames of the channel users starting with what was written, in alphabetical order
+	usernames []string
+	// The username the mention is completed to
+	index int
+	// What is written after the username
+	suffix string
+}
+
+// completeMention completes the @username before the cursor of the composer with the username of a channel user.
+// Completing the same mention again moves on to the next username which matches what was written.
+// Returns false if there is no mention before the cursor.
+func (page *ChatPage) completeMention() bool {
+	text := page.textArea.GetText()
+	_, cursor, _ := page.textArea.GetSelection()
+
+	completion := page.mentionCompletion
+
+	if completion != nil && completion.end == cursor {
+		completion.index = (completion.index + 1) % len(completion.usernames)
+	} else {
+		start, ok := state.PartialMention(text[:cursor])
+
+		if !ok {
+			return false
+		}
+
+		prefix := strings.ToLower(text[start+1 : cursor])
+		usernames := make([]string, 0)
+
+		page.mu.Lock()
+
+		for _, u := range page.channelUsers {
+			if u.Id != page.userId && strings.HasPrefix(strings.ToLower(u.Username), prefix) {
+				usernames = append(usernames, u.Username)
 			}
 		}
-	}(&channel, app, page.textView)
+
+		page.mu.Unlock()
+
+		// Tab is swallowed when nothing matches so a tab is not typed into the middle of the mention
+		if len(usernames) == 0 {
+			return true
+		}
+
+		sort.Slice(usernames, func(i, j int) bool {
+			return strings.ToLower(usernames[i]) < strings.ToLower(usernames[j])
+		})
+
+		completion = &mentionCompletion{start: start, end: cursor, usernames: usernames}
+
+		// The mention is followed by a space unless there already is one
+		if !strings.HasPrefix(text[cursor:], " ") {
+			completion.suffix = " "
+		}
+
+		page.mentionCompletion = completion
+	}
+
+	mention := "@" + completion.usernames[completion.index] + completion.suffix
+
+	page.textArea.Replace(completion.start, completion.end, mention)
+	completion.end = completion.start + len(mention)
+	page.updateInstructions()
+
+	return true
+}
+
+// recordInput adds a sent message to the input history and stops recalling messages from it
+func (page *ChatPage) recordInput(text string) {
+	if len(page.inputHistory) == 0 || page.inputHistory[len(page.inputHistory)-1] != text {
+		page.inputHistory = append(page.inputHistory, text)
+	}
+
+	if len(page.inputHistory) > MAX_INPUT_HISTORY_LENGTH {
+		page.inputHistory = page.inputHistory[len(page.inputHistory)-MAX_INPUT_HISTORY_LENGTH:]
+	}
+
+	page.inputHistoryPosition = len(page.inputHistory)
+	page.inputHistoryDraft = ""
+}
+
+// recallInput replaces the text of the composer with an earlier (-1) or later (1) message of the input history.
+// Moving past the latest message brings back the text which was being written.
+// Returns false if there is no message to move to.
+func (page *ChatPage) recallInput(step int) bool {
+	position := page.inputHistoryPosition + step
+
+	if position < 0 || position > len(page.inputHistory) {
+		return false
+	}
+
+	if page.inputHistoryPosition == len(page.inputHistory) {
+		page.inputHistoryDraft = page.textArea.GetText()
+	}
+
+	page.inputHistoryPosition = position
+
+	if position == len(page.inputHistory) {
+		page.textArea.SetText(page.inputHistoryDraft, true)
+	} else {
+		page.textArea.SetText(page.inputHistory[position], true)
+	}
+
+	return true
+}
+
+// isCursorOnFirstLine returns true if the cursor of the composer is on the first line of the text
+func (page *ChatPage) isCursorOnFirstLine() bool {
+	_, start, _ := page.textArea.GetSelection()
+
+	return !strings.Contains(page.textArea.GetText()[:start], "\n")
+}
+
+// isCursorOnLastLine returns true if the cursor of the composer is on the last line of the text
+func (page *ChatPage) isCursorOnLastLine() bool {
+	_, _, end := page.textArea.GetSelection()
+
+	return !strings.Contains(page.textArea.GetText()[end:], "\n")
+}
+
+// failedOutboxEntries returns the undelivered messages shown on the page which failed to send
+func (page *ChatPage) failedOutboxEntries() []state.OutboxEntry {
+	page.mu.Lock()
+	defer page.mu.Unlock()
+
+	failed := make([]state.OutboxEntry, 0)
+
+	for _, entry := range page.outboxEntries {
+		if entry.Status == state.OUTBOX_ENTRY_STATUS_FAILED {
+			failed = append(failed, entry)
+		}
+	}
+
+	return failed
 }
 
 // onPageClose is called when the chat page is navigated away from
 func (page *ChatPage) onPageClose() {
+	if page.channelId != "" {
+		// Whatever arrived while the chat was open has been seen
+		page.mentions.MarkRead(page.userId, page.channelId)
+
+		// Keep the unsent text for when the chat is opened again
+		if text := page.textArea.GetText(); text != "" {
+			page.drafts[page.channelId] = text
+		} else {
+			delete(page.drafts, page.channelId)
+		}
+
+		page.channelId = ""
+	}
+
+	page.mentionCompletion = nil
+
+	page.mu.Lock()
+	page.messages = nil
+	page.channelUsers = nil
+	page.manifestUsers = nil
+	page.outboxEntries = nil
+	page.showRaw = false
+	page.mu.Unlock()
+
 	page.textView.Clear()
+	page.textView.SetWrap(false)
 	page.textArea.SetText("", false)
+	page.textArea.SetTitle("")
+	page.hasFailedEntries = false
+	page.tvInstructions.SetText(page.instructions)
 
 	page.feedClient.SendFeedMessage(chat.FEED_MESSAGE_TYPE_SET_ACTIVE_CHANNEL_REQUEST, &chat.SetActiveChannelRequest{
 		ChannelId: "NONE",
@@ -482,25 +884,57 @@ func (page *ChatPage) onPageClose() {
 type ChatPageParameters struct {
 	channel_id string
 	title      string
-	returnPage PageSlug
 }
 
-// getColorManifest takes in a slice of users and assigns each users and a color.
-// The color manifest is a map of user ids to hex colors.
-// The colors are assigned based upon the users index (position) in the slice.
+// getColorManifest takes in a slice of users and assigns each users a label style.
+// The color manifest is a map of user ids to the content of a tview style tag, a color optionally followed by attributes.
+// The styles are assigned based upon the users index (position) in the slice.
 func getColorManifest(users []chat.UserInfo, thm theme.Theme) map[string]string {
-
 	var possibleColors = thm.ChatLabelColors
+	var possibleAttributes = thm.ChatLabelAttributes
 
 	colorManifest := make(map[string]string)
 
+	// There are as many styles as there are colors or attributes, whichever is more
+	styleCount := len(possibleColors)
+
+	if len(possibleAttributes) > styleCount {
+		styleCount = len(possibleAttributes)
+	}
+
 	for i, user := range users {
-		if i >= len(possibleColors) {
-			i = i % len(possibleColors)
+		i = i % styleCount
+
+		label := possibleColors[i%len(possibleColors)]
+
+		if len(possibleAttributes) > 0 {
+			label += "::" + possibleAttributes[i%len(possibleAttributes)]
 		}
 
-		colorManifest[user.Id] = possibleColors[i]
+		colorManifest[user.Id] = label
 	}
 
 	return colorManifest
 }
+
+// reverseMessages returns the messages in reverse order. The server returns messages newest first.
+func reverseMessages(messages []chat.ChatMessage) []chat.ChatMessage {
+	reversed := make([]chat.ChatMessage, 0, len(messages))
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		reversed = append(reversed, messages[i])
+	}
+
+	return reversed
+}
+
+// containsUser returns true if a user with the given id is in the slice
+func containsUser(users []chat.UserInfo, userId string) bool {
+	for _, u := range users {
+		if u.Id == userId {
+			return true
+		}
+	}
+
+	return false
+}
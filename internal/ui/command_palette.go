@@ -0,0 +1,317 @@
+package ui
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/logging"
+	"github.com/dmars8047/broterm/internal/state"
+	"github.com/dmars8047/broterm/internal/theme"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	COMMAND_PALETTE_ID           = "palette"
+	COMMAND_PALETTE_THEME_ID     = "palette:theme"
+	COMMAND_PALETTE_ALERT_ERR    = "palette:alert:err"
+	COMMAND_PALETTE_VISIBLE_ROWS = 12
+)
+
+// paletteCommand is an entry of the command palette
+type paletteCommand struct {
+	// What kind of entry it is, for example a room or an action
+	category string
+	label    string
+	run      func()
+}
+
+// text returns the text the command is searched by and shown as
+func (command paletteCommand) text() string {
+	return command.category + ": " + command.label
+}
+
+// CommandPalette is an overlay opened from any page after login which jumps to rooms, friends and actions by fuzzy search
+type CommandPalette struct {
+	serverClients *state.ServerClients
+	sessionStore  *state.SessionStore
+	settings      *config.ConfigSettings
+	input         *tview.InputField
+	list          *tview.List
+	commands      []paletteCommand
+	// The commands shown in the list, in list order
+	matches []paletteCommand
+}
+
+// NewCommandPalette creates a new instance of the command palette
+func NewCommandPalette(serverClients *state.ServerClients, sessionStore *state.SessionStore, settings *config.ConfigSettings) *CommandPalette {
+	return &CommandPalette{
+		serverClients: serverClients,
+		sessionStore:  sessionStore,
+		settings:      settings,
+		input:         tview.NewInputField(),
+		list:          tview.NewList(),
+	}
+}
+
+// Setup builds the command palette and binds it to the command palette action
+func (palette *CommandPalette) Setup(app *tview.Application, appContext *state.ApplicationContext, nav *PageNavigator) {
+	palette.input.SetLabel("> ")
+
+	palette.input.SetChangedFunc(func(query string) {
+		palette.filter(query)
+	})
+
+	keymap := nav.Keymap()
+
+	palette.input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyDown || event.Key() == tcell.KeyTab:
+			palette.moveSelection(1)
+			return nil
+		case event.Key() == tcell.KeyUp || event.Key() == tcell.KeyBacktab:
+			palette.moveSelection(-1)
+			return nil
+		case event.Key() == tcell.KeyEnter || keymap.MatchesInText(ACTION_SELECT, event):
+			palette.runSelected(nav)
+			return nil
+		case keymap.MatchesInText(ACTION_BACK, event):
+			palette.close(nav)
+			return nil
+		}
+
+		return event
+	})
+
+	palette.list.ShowSecondaryText(false)
+	palette.list.SetHighlightFullLine(true)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(palette.input, 1, 0, true).
+		AddItem(palette.list, 0, 1, false)
+
+	layout.SetBorder(true).SetTitle(" Go To ").SetTitleAlign(tview.AlignCenter)
+
+	grid := tview.NewGrid().
+		SetRows(0, COMMAND_PALETTE_VISIBLE_ROWS+3, 0).
+		SetColumns(0, 60, 0).
+		AddItem(layout, 1, 1, 1, 1, 0, 0, true)
+
+	nav.BindGlobalAction(ACTION_COMMAND_PALETTE, func() {
+		if front, _ := nav.Pages.GetFrontPage(); front == COMMAND_PALETTE_ID {
+			palette.close(nav)
+			return
+		}
+
+		// Rooms, friends and most actions need a user session
+		if _, ok := appContext.GetAccessToken(); !ok {
+			return
+		}
+
+		palette.commands = palette.buildCommands(app, appContext, nav)
+		palette.input.SetText("")
+		palette.filter("")
+
+		nav.addModal(COMMAND_PALETTE_ID, grid, true, func(theme theme.Theme) {
+			layout.SetBackgroundColor(theme.AccentColor)
+			layout.SetBorderColor(theme.BorderColor)
+			layout.SetTitleColor(theme.TitleColor)
+			palette.input.SetBackgroundColor(theme.AccentColor)
+			palette.input.SetLabelColor(theme.HighlightColor)
+			palette.input.SetFieldBackgroundColor(theme.AccentColorTwo)
+			palette.input.SetFieldTextColor(theme.ForgroundColor)
+			palette.list.SetBackgroundColor(theme.AccentColor)
+			palette.list.SetMainTextColor(theme.ForgroundColor)
+			palette.list.SetSelectedBackgroundColor(theme.HighlightColor)
+			palette.list.SetSelectedTextColor(theme.BackgroundColor)
+		})
+	})
+}
+
+// buildCommands lists the current user's rooms and friends followed by the actions
+func (palette *CommandPalette) buildCommands(app *tview.Application, appContext *state.ApplicationContext, nav *PageNavigator) []paletteCommand {
+	brochatUser := appContext.GetBrochatUser()
+	commands := make([]paletteCommand, 0, len(brochatUser.Rooms)+len(brochatUser.Relationships)+9)
+
+	for _, room := range brochatUser.Rooms {
+		params := ChatPageParameters{
+			channel_id: room.ChannelId,
+			title:      room.Name,
+		}
+
+		commands = append(commands, paletteCommand{category: "Room", label: room.Name, run: func() {
+			nav.NavigateTo(CHAT_PAGE, params)
+		}})
+	}
+
+	for _, rel := range brochatUser.Relationships {
+		if rel.Type != chat.RELATIONSHIP_TYPE_FRIEND {
+			continue
+		}
+
+		params := ChatPageParameters{
+			channel_id: rel.DirectMessageChannelId,
+		}
+
+		commands = append(commands, paletteCommand{category: "Bro", label: rel.Username, run: func() {
+			nav.NavigateTo(CHAT_PAGE, params)
+		}})
+	}
+
+	navigateTo := func(page PageSlug) func() {
+		return func() {
+			nav.NavigateTo(page, nil)
+		}
+	}
+
+	return append(commands,
+		paletteCommand{category: "Action", label: "Home", run: navigateTo(HOME_PAGE)},
+		paletteCommand{category: "Action", label: "Room list", run: navigateTo(ROOM_LIST_PAGE)},
+		paletteCommand{category: "Action", label: "Find a room", run: navigateTo(ROOM_FINDER_PAGE)},
+		paletteCommand{category: "Action", label: "Create a room", run: navigateTo(ROOM_EDITOR_PAGE)},
+		paletteCommand{category: "Action", label: "Friends list", run: navigateTo(FRIENDS_LIST_PAGE)},
+		paletteCommand{category: "Action", label: "Find a bro", run: navigateTo(FRIENDS_FINDER_PAGE)},
+		paletteCommand{category: "Action", label: "Pending friend requests", run: navigateTo(ACCEPT_FRIEND_REQUEST_PAGE)},
+		paletteCommand{category: "Action", label: "Change theme", run: func() {
+			nav.Select(COMMAND_PALETTE_THEME_ID, " Change Theme ", theme.Codes(), func(_ int, code string) {
+				palette.changeTheme(appContext, nav, code)
+			})
+		}},
+		paletteCommand{category: "Action", label: "Logout", run: func() {
+			logout(app, appContext, nav, palette.serverClients.UserAuthClient(), palette.sessionStore, paletteLogger())
+		}},
+	)
+}
+
+// changeTheme makes the theme the active theme and saves it to the config, to the active profile if there is one
+func (palette *CommandPalette) changeTheme(appContext *state.ApplicationContext, nav *PageNavigator, code string) {
+	// The change is made to a copy so the settings in use are untouched if they cannot be saved
+	updatedSettings := *palette.settings
+	updatedSettings.Profiles = append([]config.Profile(nil), palette.settings.Profiles...)
+
+	err := config.SetSetting(&updatedSettings, "theme", code)
+
+	if err == nil {
+		err = config.SaveConfigSettings(&updatedSettings)
+	}
+
+	if err != nil {
+		paletteLogger().Error("Theme could not be saved", "theme", code, "error", err)
+		nav.Alert(COMMAND_PALETTE_ALERT_ERR, "Theme Could Not Be Saved - "+err.Error())
+		return
+	}
+
+	*palette.settings = updatedSettings
+	appContext.SetTheme(code)
+}
+
+// filter shows the commands which match the query, best match first
+func (palette *CommandPalette) filter(query string) {
+	type scoredCommand struct {
+		command paletteCommand
+		score   int
+	}
+
+	scored := make([]scoredCommand, 0, len(palette.commands))
+
+	for _, command := range palette.commands {
+		score, ok := fuzzyMatch(query, command.text())
+
+		if ok {
+			scored = append(scored, scoredCommand{command: command, score: score})
+		}
+	}
+
+	// Equal matches keep the order rooms, friends then actions
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	palette.list.Clear()
+	palette.matches = palette.matches[:0]
+
+	for _, match := range scored {
+		palette.matches = append(palette.matches, match.command)
+		palette.list.AddItem(tview.Escape(match.command.text()), "", 0, nil)
+	}
+}
+
+// moveSelection moves the list selection by the offset, wrapping around at either end
+func (palette *CommandPalette) moveSelection(offset int) {
+	count := palette.list.GetItemCount()
+
+	if count == 0 {
+		return
+	}
+
+	palette.list.SetCurrentItem((palette.list.GetCurrentItem() + offset + count) % count)
+}
+
+// runSelected closes the palette and runs the selected command
+func (palette *CommandPalette) runSelected(nav *PageNavigator) {
+	index := palette.list.GetCurrentItem()
+
+	if index < 0 || index >= len(palette.matches) {
+		return
+	}
+
+	command := palette.matches[index]
+
+	palette.close(nav)
+	command.run()
+}
+
+// close removes the palette from the screen
+func (palette *CommandPalette) close(nav *PageNavigator) {
+	nav.Pages.HidePage(COMMAND_PALETTE_ID).RemovePage(COMMAND_PALETTE_ID)
+	palette.commands = nil
+}
+
+// paletteLogger returns the logger of the command palette
+func paletteLogger() *slog.Logger {
+	return logging.Component("ui").With("overlay", COMMAND_PALETTE_ID)
+}
+
+// fuzzyMatch reports whether every character of the query appears in the text in order, ignoring case.
+// Matches score higher when their characters are consecutive or start a word.
+func fuzzyMatch(query, text string) (int, bool) {
+	queryRunes := []rune(strings.ToLower(strings.TrimSpace(query)))
+	textRunes := []rune(strings.ToLower(text))
+
+	score := 0
+	queryIndex := 0
+	previousMatch := -2
+
+	for i, r := range textRunes {
+		if queryIndex == len(queryRunes) {
+			break
+		}
+
+		if r != queryRunes[queryIndex] {
+			continue
+		}
+
+		score++
+
+		if previousMatch == i-1 {
+			score += 2
+		}
+
+		if i == 0 || !unicode.IsLetter(textRunes[i-1]) && !unicode.IsDigit(textRunes[i-1]) {
+			score += 3
+		}
+
+		previousMatch = i
+		queryIndex++
+	}
+
+	if queryIndex < len(queryRunes) {
+		return 0, false
+	}
+
+	return score, true
+}
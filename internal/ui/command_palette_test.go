@@ -0,0 +1,56 @@
+package ui
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		want  bool
+	}{
+		{"", "Create Room", true},
+		{"  ", "Create Room", true},
+		{"cr", "Create Room", true},
+		{"CR", "create room", true},
+		{" room ", "Create Room", true},
+		{"crrm", "Create Room", true},
+		{"rc", "Create Room", false},
+		{"rooms", "Create Room", false},
+		{"café", "Open Café", true},
+		{"cafe", "Open Café", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := fuzzyMatch(tt.query, tt.text); ok != tt.want {
+			t.Errorf("fuzzyMatch(%q, %q) matched = %v, want %v", tt.query, tt.text, ok, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatchScore(t *testing.T) {
+	// Each query should score higher against the first text than the second
+	tests := []struct {
+		query  string
+		better string
+		worse  string
+	}{
+		{"cr", "Create Room", "Discard"},
+		{"room", "Find Room", "Forgot Password: Reset Our Own Mail"},
+		{"fr", "Find Room", "Pending Friend Requests"},
+		{"help", "Help", "Switch Profile: Help Desk"},
+	}
+
+	for _, tt := range tests {
+		betterScore, betterOk := fuzzyMatch(tt.query, tt.better)
+		worseScore, worseOk := fuzzyMatch(tt.query, tt.worse)
+
+		if !betterOk || !worseOk {
+			t.Errorf("fuzzyMatch(%q) did not match both %q and %q", tt.query, tt.better, tt.worse)
+			continue
+		}
+
+		if betterScore <= worseScore {
+			t.Errorf("fuzzyMatch(%q) scored %q %d and %q %d, want the first higher", tt.query, tt.better, betterScore, tt.worse, worseScore)
+		}
+	}
+}
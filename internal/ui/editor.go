@@ -0,0 +1,80 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// editorCommand returns the editor named by $VISUAL or $EDITOR, split into the program and its arguments.
+// vi, or notepad on Windows, is used if neither is set.
+func editorCommand() []string {
+	for _, variable := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(variable)); len(fields) > 0 {
+			return fields
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+
+	return []string{"vi"}
+}
+
+// editInEditor suspends the application and opens the text in the user's editor.
+// Returns the text as it was saved once the editor exits.
+func editInEditor(app *tview.Application, text string) (string, error) {
+	file, err := os.CreateTemp("", "broterm-message-*.md")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(text)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	command := editorCommand()
+
+	var runErr error
+
+	suspended := app.Suspend(func() {
+		cmd := exec.Command(command[0], append(command[1:], file.Name())...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		runErr = cmd.Run()
+	})
+
+	if !suspended {
+		return "", errors.New("the terminal could not be handed over to the editor")
+	}
+
+	if runErr != nil {
+		return "", fmt.Errorf("%s exited with an error - %w", command[0], runErr)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+
+	if err != nil {
+		return "", err
+	}
+
+	// Editors end the file with a new line which is not part of the message
+	return strings.TrimRight(string(edited), "\r\n"), nil
+}
@@ -2,7 +2,6 @@ package ui
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/dmars8047/brolib/chat"
 	"github.com/dmars8047/broterm/internal/state"
@@ -20,19 +19,17 @@ const (
 
 // FindAFriendPage is the find a friend page
 type FindAFriendPage struct {
-	brochatClient *chat.BroChatClient
+	serverClients *state.ServerClients
 	table         *tview.Table
 	users         map[uint8]chat.UserInfo
-	themeCode     string
 }
 
 // NewFindAFriendPage creates a new find a friend page
-func NewFindAFriendPage(brochatClient *chat.BroChatClient) *FindAFriendPage {
+func NewFindAFriendPage(serverClients *state.ServerClients) *FindAFriendPage {
 	return &FindAFriendPage{
-		brochatClient: brochatClient,
+		serverClients: serverClients,
 		table:         tview.NewTable(),
 		users:         make(map[uint8]chat.UserInfo, 0),
-		themeCode:     "NOT_SET",
 	}
 }
 
@@ -55,13 +52,13 @@ func (page *FindAFriendPage) Setup(app *tview.Application, appContext *state.App
 		accessToken, ok := appContext.GetAccessToken()
 
 		if !ok {
-			log.Printf("Valid user authentication information not found. Redirecting to login page.")
+			pageLogger(FRIENDS_FINDER_PAGE).Info("Valid user authentication information not found, redirecting to login page")
 			nav.NavigateTo(LOGIN_PAGE, nil)
 			return
 		}
 
 		nav.Confirm(FIND_A_FRIEND_PAGE_CONFIRM, fmt.Sprintf("Send Friend Request to %s?", selectedUser.Username), func() {
-			sendFriendRequestResult := page.brochatClient.SendFriendRequest(accessToken, chat.SendFriendRequestRequest{
+			sendFriendRequestResult := page.serverClients.BrochatClient().SendFriendRequest(accessToken, chat.SendFriendRequestRequest{
 				RequestedUserId: selectedUser.Id,
 			})
 
@@ -87,39 +84,24 @@ func (page *FindAFriendPage) Setup(app *tview.Application, appContext *state.App
 		})
 	})
 
+	keymap := nav.Keymap()
+
 	page.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(FRIENDS_LIST_PAGE, nil)
+		if keymap.Matches(ACTION_BACK, event) {
+			nav.BackOr(FRIENDS_LIST_PAGE)
 			page.users = make(map[uint8]chat.UserInfo, 0)
 			page.table.Clear()
-		} else if event.Key() == tcell.KeyTab {
-			// Change the selected row to the next row
-			row, _ := page.table.GetSelection()
-			if row+1 >= page.table.GetRowCount() {
-				row = 1
-			} else {
-				row++
-			}
-
-			page.table.Select(row, 0)
-		} else if event.Key() == tcell.KeyBacktab {
-			// Change the selected row to the previous row
-			row, _ := page.table.GetSelection()
-
-			if row-1 < 1 {
-				row = page.table.GetRowCount() - 1
-			} else {
-				row--
-			}
-
-			page.table.Select(row, 0)
+			return nil
 		}
 
-		return event
+		return handleTableKeys(keymap, page.table, event)
 	})
 
 	tvInstructions := tview.NewTextView().SetTextAlign(tview.AlignCenter)
-	tvInstructions.SetText("(esc) Quit")
+	tvInstructions.SetText(instructions(
+		keymap.Hint("Send Friend Request", ACTION_SELECT),
+		keymap.Hint("Quit", ACTION_BACK),
+	))
 
 	grid := tview.NewGrid()
 
@@ -133,26 +115,39 @@ func (page *FindAFriendPage) Setup(app *tview.Application, appContext *state.App
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.themeCode != theme.Code {
-			page.themeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			tvHeader.SetBackgroundColor(theme.BackgroundColor)
-			tvHeader.SetTextColor(theme.TitleColor)
-			page.table.SetBordersColor(theme.BorderColor)
-			page.table.SetBorderColor(theme.BorderColor)
-			page.table.SetTitleColor(theme.TitleColor)
-			page.table.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		tvHeader.SetBackgroundColor(theme.BackgroundColor)
+		tvHeader.SetTextColor(theme.TitleColor)
+		page.table.SetBordersColor(theme.BorderColor)
+		page.table.SetBorderColor(theme.BorderColor)
+		page.table.SetTitleColor(theme.TitleColor)
+		page.table.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.InfoColor)
+
+		// Table cells keep the colors they were created with so the found users are recolored
+		for row := 0; row < page.table.GetRowCount(); row++ {
+			for column := 0; column < page.table.GetColumnCount(); column++ {
+				if cell := page.table.GetCell(row, column); cell != nil {
+					cell.SetTextColor(theme.ForgroundColor)
+				}
+			}
 		}
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(FRIENDS_FINDER_PAGE, applyTheme)
+
+	nav.DescribeKeys(FRIENDS_FINDER_PAGE,
+		KeyHelp{Action: ACTION_SELECT, Description: "Send a friend request to the selected user"},
+		KeyHelp{Action: ACTION_NEXT, Description: "Next user"},
+		KeyHelp{Action: ACTION_PREVIOUS, Description: "Previous user"},
+		KeyHelp{Action: ACTION_BACK, Description: "Back to the friends list"},
+	)
 
 	nav.Register(FRIENDS_FINDER_PAGE, grid, true, false,
 		func(_ interface{}) {
-			applyTheme()
 			page.onPageLoad(app, appContext, nav)
 		},
 		func() {
@@ -165,7 +160,7 @@ func (page *FindAFriendPage) onPageLoad(app *tview.Application, appContext *stat
 	accessToken, ok := appContext.GetAccessToken()
 
 	if !ok {
-		log.Printf("Valid user authentication information not found. Redirecting to login page.")
+		pageLogger(FRIENDS_FINDER_PAGE).Info("Valid user authentication information not found, redirecting to login page")
 		nav.NavigateTo(LOGIN_PAGE, nil)
 		return
 	}
@@ -185,7 +180,7 @@ func (page *FindAFriendPage) onPageLoad(app *tview.Application, appContext *stat
 		SetSelectable(false).
 		SetAttributes(tcell.AttrBold|tcell.AttrUnderline))
 
-	getUsersResult := page.brochatClient.GetUsers(accessToken, chat.GetUsersOption_ExcludeSelf(),
+	getUsersResult := page.serverClients.BrochatClient().GetUsers(accessToken, chat.GetUsersOption_ExcludeSelf(),
 		chat.GetUsersOption_ExcludeFriends(),
 		chat.GetUsersOption_Page(1),
 		chat.GetUsersOption_PageSize(10))
@@ -212,7 +207,7 @@ func (page *FindAFriendPage) onPageLoad(app *tview.Application, appContext *stat
 	for i, usr := range usrs {
 		row := i + 1
 
-		page.table.SetCell(row, 0, tview.NewTableCell(usr.Username).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
+		page.table.SetCell(row, 0, tview.NewTableCell(tview.Escape(usr.Username)).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
 		var dateString string = usr.LastOnlineUtc.Local().Format("Jan 2, 2006")
 		page.table.SetCell(row, 1, tview.NewTableCell(dateString).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignRight))
 
@@ -19,17 +19,15 @@ const (
 
 // ForgotPasswordPage is the forgot password page
 type ForgotPasswordPage struct {
-	userAuthClient   *idam.UserAuthClient
-	forgotPWForm     *tview.Form
-	currentThemeCode string
+	serverClients *state.ServerClients
+	forgotPWForm  *tview.Form
 }
 
 // NewForgotPasswordPage creates a new instance of the forgot password page
-func NewForgotPasswordPage(userAuthClient *idam.UserAuthClient) *ForgotPasswordPage {
+func NewForgotPasswordPage(serverClients *state.ServerClients) *ForgotPasswordPage {
 	return &ForgotPasswordPage{
-		userAuthClient:   userAuthClient,
-		forgotPWForm:     tview.NewForm(),
-		currentThemeCode: "NOT_SET",
+		serverClients: serverClients,
+		forgotPWForm:  tview.NewForm(),
 	}
 }
 
@@ -66,7 +64,7 @@ func (page *ForgotPasswordPage) Setup(app *tview.Application, appContext *state.
 			Email: email,
 		}
 
-		err := page.userAuthClient.InitiatePasswordReset("brochat", request)
+		err := page.serverClients.UserAuthClient().InitiatePasswordReset("brochat", request)
 
 		if err != nil {
 			errMessage := err.Error()
@@ -109,25 +107,25 @@ func (page *ForgotPasswordPage) Setup(app *tview.Application, appContext *state.
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.forgotPWForm.SetBackgroundColor(theme.AccentColor)
-			page.forgotPWForm.SetFieldBackgroundColor(theme.AccentColorTwo)
-			page.forgotPWForm.SetLabelColor(theme.HighlightColor)
-			page.forgotPWForm.SetButtonStyle(theme.ButtonStyle)
-			page.forgotPWForm.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
-			page.forgotPWForm.SetBorderColor(theme.BorderColor)
-			page.forgotPWForm.SetTitleColor(theme.TitleColor)
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
-		}
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.forgotPWForm.SetBackgroundColor(theme.AccentColor)
+		page.forgotPWForm.SetFieldBackgroundColor(theme.AccentColorTwo)
+		page.forgotPWForm.SetLabelColor(theme.HighlightColor)
+		page.forgotPWForm.SetButtonStyle(theme.ButtonStyle)
+		page.forgotPWForm.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
+		page.forgotPWForm.SetBorderColor(theme.BorderColor)
+		page.forgotPWForm.SetTitleColor(theme.TitleColor)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.InfoColor)
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(FORGOT_PW_PAGE, applyTheme)
+
+	nav.ExcludeFromHistory(FORGOT_PW_PAGE)
 
 	nav.Register(FORGOT_PW_PAGE, grid, true, false,
 		func(param interface{}) {
-			applyTheme()
 			page.onPageLoad()
 		},
 		func() {
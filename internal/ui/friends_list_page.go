@@ -19,22 +19,21 @@ const (
 )
 
 type FriendsListPage struct {
-	brochatClient    *chat.BroChatClient
-	feedClient       *state.FeedClient
-	table            *tview.Table
-	tvInstructions   *tview.TextView
-	userFriends      map[uint8]chat.UserRelationship
-	currentThemeCode string
+	serverClients  *state.ServerClients
+	feedClient     *state.FeedClient
+	table          *tview.Table
+	tvInstructions *tview.TextView
+	keymap         *Keymap
+	userFriends    map[uint8]chat.UserRelationship
 }
 
-func NewFriendsListPage(brochatClient *chat.BroChatClient, feedClient *state.FeedClient) *FriendsListPage {
+func NewFriendsListPage(serverClients *state.ServerClients, feedClient *state.FeedClient) *FriendsListPage {
 	return &FriendsListPage{
-		brochatClient:    brochatClient,
-		feedClient:       feedClient,
-		table:            tview.NewTable(),
-		tvInstructions:   tview.NewTextView(),
-		userFriends:      make(map[uint8]chat.UserRelationship, 0),
-		currentThemeCode: "NOT_SET",
+		serverClients:  serverClients,
+		feedClient:     feedClient,
+		table:          tview.NewTable(),
+		tvInstructions: tview.NewTextView(),
+		userFriends:    make(map[uint8]chat.UserRelationship, 0),
 	}
 }
 
@@ -55,54 +54,35 @@ func (page *FriendsListPage) Setup(app *tview.Application, appContext *state.App
 
 		nav.NavigateTo(CHAT_PAGE, ChatPageParameters{
 			channel_id: rel.DirectMessageChannelId,
-			returnPage: FRIENDS_LIST_PAGE,
 		})
 	})
 
+	keymap := nav.Keymap()
+	page.keymap = keymap
+
 	page.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyRune {
-			switch event.Rune() {
-			case 'p':
-				nav.NavigateTo(ACCEPT_FRIEND_REQUEST_PAGE, nil)
-				page.userFriends = make(map[uint8]chat.UserRelationship, 0)
-				page.table.Clear()
-			case 'f':
-				nav.NavigateTo(FRIENDS_FINDER_PAGE, nil)
-				page.userFriends = make(map[uint8]chat.UserRelationship, 0)
-				page.table.Clear()
-			}
-		} else if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(HOME_PAGE, nil)
+		if keymap.Matches(ACTION_PENDING_REQUESTS, event) {
+			nav.NavigateTo(ACCEPT_FRIEND_REQUEST_PAGE, nil)
 			page.userFriends = make(map[uint8]chat.UserRelationship, 0)
 			page.table.Clear()
-		} else if event.Key() == tcell.KeyTab {
-			// Change the selected row to the next row
-			row, _ := page.table.GetSelection()
-			if row+1 >= page.table.GetRowCount() {
-				row = 1
-			} else {
-				row++
-			}
-
-			page.table.Select(row, 0)
-		} else if event.Key() == tcell.KeyBacktab {
-			// Change the selected row to the previous row
-			row, _ := page.table.GetSelection()
-
-			if row-1 < 1 {
-				row = page.table.GetRowCount() - 1
-			} else {
-				row--
-			}
-
-			page.table.Select(row, 0)
+			return nil
+		} else if keymap.Matches(ACTION_FIND_FRIEND, event) {
+			nav.NavigateTo(FRIENDS_FINDER_PAGE, nil)
+			page.userFriends = make(map[uint8]chat.UserRelationship, 0)
+			page.table.Clear()
+			return nil
+		} else if keymap.Matches(ACTION_BACK, event) {
+			nav.BackOr(HOME_PAGE)
+			page.userFriends = make(map[uint8]chat.UserRelationship, 0)
+			page.table.Clear()
+			return nil
 		}
 
-		return event
+		return handleTableKeys(keymap, page.table, event)
 	})
 
 	page.tvInstructions.SetTextAlign(tview.AlignCenter)
-	page.tvInstructions.SetText("(f) Find a new Bro - (p) View Pending - (esc) Quit")
+	page.tvInstructions.SetText(page.instructions(0))
 
 	grid := tview.NewGrid()
 
@@ -119,27 +99,38 @@ func (page *FriendsListPage) Setup(app *tview.Application, appContext *state.App
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetBordersColor(theme.BorderColor)
-			page.table.SetBorderColor(theme.BorderColor)
-			page.table.SetTitleColor(theme.TitleColor)
-			page.table.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
-			tvHeader.SetBackgroundColor(theme.BackgroundColor)
-			tvHeader.SetTextColor(theme.TitleColor)
-			page.tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			page.tvInstructions.SetTextColor(theme.InfoColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetBordersColor(theme.BorderColor)
+		page.table.SetBorderColor(theme.BorderColor)
+		page.table.SetTitleColor(theme.TitleColor)
+		page.table.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
+		tvHeader.SetBackgroundColor(theme.BackgroundColor)
+		tvHeader.SetTextColor(theme.TitleColor)
+		page.tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		page.tvInstructions.SetTextColor(theme.InfoColor)
+
+		// Table cells keep the colors they were created with so an open table is filled again
+		if pageContext != nil && pageContext.Err() == nil {
+			page.populateTable(appContext.GetBrochatUser(), theme)
 		}
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(FRIENDS_LIST_PAGE, applyTheme)
+
+	nav.DescribeKeys(FRIENDS_LIST_PAGE,
+		KeyHelp{Action: ACTION_SELECT, Description: "Chat with the selected Bro"},
+		KeyHelp{Action: ACTION_NEXT, Description: "Next Bro"},
+		KeyHelp{Action: ACTION_PREVIOUS, Description: "Previous Bro"},
+		KeyHelp{Action: ACTION_FIND_FRIEND},
+		KeyHelp{Action: ACTION_PENDING_REQUESTS},
+		KeyHelp{Action: ACTION_BACK, Description: "Back to the home page"},
+	)
 
 	nav.Register(FRIENDS_LIST_PAGE, grid, true, false,
 		func(_ interface{}) {
 			pageContext, cancel = appContext.GenerateUserSessionBoundContextWithCancel()
-			applyTheme()
 			page.onPageLoad(app, appContext, pageContext)
 		},
 		func() {
@@ -162,7 +153,11 @@ func (page *FriendsListPage) onPageLoad(app *tview.Application, appContext *stat
 			select {
 			case <-pageContext.Done():
 				return
-			case updateCode := <-userProfileUpdatesChannel:
+			case updateCode, ok := <-userProfileUpdatesChannel:
+				if !ok {
+					return
+				}
+
 				if updateCode == chat.USER_PROFILE_UPDATE_REASON_RELATIONSHIP_UPDATE {
 					page.table.Clear()
 					app.QueueUpdateDraw(func() {
@@ -208,7 +203,7 @@ func (page *FriendsListPage) populateTable(brochatUser chat.User, thm theme.Them
 		}
 	}
 
-	page.tvInstructions.SetText(fmt.Sprintf("(f) Find a new Bro - (p) View Pending [%d] - (esc) Quit", countOfPendingFriendRequests))
+	page.tvInstructions.SetText(page.instructions(countOfPendingFriendRequests))
 
 	row := 1
 
@@ -218,7 +213,7 @@ func (page *FriendsListPage) populateTable(brochatUser chat.User, thm theme.Them
 			continue
 		}
 
-		page.table.SetCell(row, 0, tview.NewTableCell(rel.Username).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
+		page.table.SetCell(row, 0, tview.NewTableCell(tview.Escape(rel.Username)).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
 		if rel.IsOnline {
 			page.table.SetCell(row, 1, tview.NewTableCell("Online").SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
 		} else {
@@ -234,3 +229,12 @@ func (page *FriendsListPage) populateTable(brochatUser chat.User, thm theme.Them
 		row++
 	}
 }
+
+// instructions describes the keys of the page along with the number of pending friend requests
+func (page *FriendsListPage) instructions(countOfPendingFriendRequests int) string {
+	return instructions(
+		page.keymap.Hint("Find a new Bro", ACTION_FIND_FRIEND),
+		page.keymap.Hint(fmt.Sprintf("View Pending [%d]", countOfPendingFriendRequests), ACTION_PENDING_REQUESTS),
+		page.keymap.Hint("Quit", ACTION_BACK),
+	)
+}
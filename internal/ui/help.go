@@ -0,0 +1,198 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dmars8047/broterm/internal/theme"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	HELP_MODAL_ID         = "help"
+	HELP_MODAL_WIDTH      = 64
+	HELP_MODAL_MAX_HEIGHT = 24
+)
+
+// The categories the help groups keys into, in the order they are listed
+const (
+	KEY_CATEGORY_NAVIGATION = "Navigation"
+	KEY_CATEGORY_CHAT       = "Chat"
+	KEY_CATEGORY_FRIENDS    = "Friends"
+	KEY_CATEGORY_ROOMS      = "Rooms"
+	KEY_CATEGORY_ACCOUNT    = "Account"
+	KEY_CATEGORY_GENERAL    = "General"
+)
+
+var keyCategories = []string{
+	KEY_CATEGORY_NAVIGATION,
+	KEY_CATEGORY_CHAT,
+	KEY_CATEGORY_FRIENDS,
+	KEY_CATEGORY_ROOMS,
+	KEY_CATEGORY_ACCOUNT,
+	KEY_CATEGORY_GENERAL,
+}
+
+// actionDescription is how an action is listed in the help when a page does not describe it
+type actionDescription struct {
+	category    string
+	description string
+}
+
+// ACTION_DESCRIPTIONS describe every action
+var ACTION_DESCRIPTIONS = map[Action]actionDescription{
+	ACTION_BACK:             {KEY_CATEGORY_NAVIGATION, "Go back"},
+	ACTION_NEXT:             {KEY_CATEGORY_NAVIGATION, "Next item"},
+	ACTION_PREVIOUS:         {KEY_CATEGORY_NAVIGATION, "Previous item"},
+	ACTION_SELECT:           {KEY_CATEGORY_NAVIGATION, "Select"},
+	ACTION_NAVIGATE_BACK:    {KEY_CATEGORY_NAVIGATION, "Back to the previous page"},
+	ACTION_NAVIGATE_FORWARD: {KEY_CATEGORY_NAVIGATION, "Forward to the next page"},
+	ACTION_SEND_MESSAGE:     {KEY_CATEGORY_CHAT, "Send the message"},
+	ACTION_NEW_LINE:         {KEY_CATEGORY_CHAT, "Start a new line in the message"},
+	ACTION_OPEN_EDITOR:      {KEY_CATEGORY_CHAT, "Write the message in $EDITOR"},
+	ACTION_COMPLETE_MENTION: {KEY_CATEGORY_CHAT, "Complete the @username being written, again for the next match"},
+	ACTION_HISTORY_PREVIOUS: {KEY_CATEGORY_CHAT, "Recall the previous sent message"},
+	ACTION_HISTORY_NEXT:     {KEY_CATEGORY_CHAT, "Recall the next sent message"},
+	ACTION_SCROLL_UP:        {KEY_CATEGORY_CHAT, "Scroll up, loading older messages at the top"},
+	ACTION_SCROLL_DOWN:      {KEY_CATEGORY_CHAT, "Scroll down"},
+	ACTION_RESEND_FAILED:    {KEY_CATEGORY_CHAT, "Resend the messages which failed to send"},
+	ACTION_DISCARD_FAILED:   {KEY_CATEGORY_CHAT, "Discard the messages which failed to send"},
+	ACTION_TOGGLE_RAW:       {KEY_CATEGORY_CHAT, "Show messages as written, for copying"},
+	ACTION_FIND_FRIEND:      {KEY_CATEGORY_FRIENDS, "Find a new Bro"},
+	ACTION_PENDING_REQUESTS: {KEY_CATEGORY_FRIENDS, "View pending friend requests"},
+	ACTION_FIND_ROOM:        {KEY_CATEGORY_ROOMS, "Find a room to join"},
+	ACTION_CREATE_ROOM:      {KEY_CATEGORY_ROOMS, "Create a room"},
+	ACTION_FORGOT_PASSWORD:  {KEY_CATEGORY_ACCOUNT, "Reset a forgotten password"},
+	ACTION_SWITCH_PROFILE:   {KEY_CATEGORY_ACCOUNT, "Switch profile"},
+	ACTION_COMMAND_PALETTE:  {KEY_CATEGORY_GENERAL, "Jump to a room, Bro or action"},
+	ACTION_SHOW_HELP:        {KEY_CATEGORY_GENERAL, "Show or hide this help"},
+}
+
+// KeyHelp is an action available on a page along with what it does there
+type KeyHelp struct {
+	Action Action
+	// What the action does on the page, the action's own description if empty
+	Description string
+}
+
+// DescribeKeys sets the actions listed in the help of the page, along with what they do there.
+// The global actions are listed on every page and need not be described.
+func (nav *PageNavigator) DescribeKeys(page PageSlug, keys ...KeyHelp) {
+	nav.pageKeys[page] = keys
+}
+
+// toggleHelp shows the keys of the current page and the global keys in a modal, or closes it if it is already shown
+func (nav *PageNavigator) toggleHelp() {
+	if front, _ := nav.Pages.GetFrontPage(); front == HELP_MODAL_ID {
+		nav.Pages.HidePage(HELP_MODAL_ID).RemovePage(HELP_MODAL_ID)
+		return
+	}
+
+	keys := append([]KeyHelp(nil), nav.pageKeys[nav.current]...)
+
+	for _, action := range nav.globalActions {
+		keys = append(keys, KeyHelp{Action: action})
+	}
+
+	textView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetWrap(false)
+
+	textView.SetBorder(true).
+		SetTitle(" Keyboard Shortcuts ").
+		SetTitleAlign(tview.AlignCenter)
+
+	textView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEnter || nav.keymap.Matches(ACTION_BACK, event) {
+			nav.Pages.HidePage(HELP_MODAL_ID).RemovePage(HELP_MODAL_ID)
+			return nil
+		}
+
+		return event
+	})
+
+	height := strings.Count(nav.helpText(keys, theme.Theme{}), "\n") + 3
+
+	if height > HELP_MODAL_MAX_HEIGHT {
+		height = HELP_MODAL_MAX_HEIGHT
+	}
+
+	// Center the help on the screen
+	grid := tview.NewGrid().
+		SetRows(0, height, 0).
+		SetColumns(0, HELP_MODAL_WIDTH, 0).
+		AddItem(textView, 1, 1, 1, 1, 0, 0, true)
+
+	nav.addModal(HELP_MODAL_ID, grid, true, func(theme theme.Theme) {
+		textView.SetBackgroundColor(theme.BackgroundColor)
+		textView.SetTextColor(theme.ForgroundColor)
+		textView.SetBorderColor(theme.BorderColor)
+		textView.SetBorderStyle(theme.TextAreaTextStyle)
+		textView.SetTitleColor(theme.TitleColor)
+		textView.SetText(nav.helpText(keys, theme))
+	})
+}
+
+// helpText lists the keys grouped by category, leaving out actions without keys and those listed already
+func (nav *PageNavigator) helpText(keys []KeyHelp, thm theme.Theme) string {
+	var builder strings.Builder
+
+	for _, category := range keyCategories {
+		lines := make([]string, 0)
+
+		for i, key := range keys {
+			description, ok := ACTION_DESCRIPTIONS[key.Action]
+
+			if !ok || description.category != category || isListedBefore(keys[:i], key.Action) {
+				continue
+			}
+
+			bindings := nav.keymap.Bindings(key.Action)
+
+			if len(bindings) == 0 {
+				continue
+			}
+
+			labels := make([]string, 0, len(bindings))
+
+			for _, binding := range bindings {
+				labels = append(labels, binding.label())
+			}
+
+			text := key.Description
+
+			if text == "" {
+				text = description.description
+			}
+
+			lines = append(lines, fmt.Sprintf(" [%s]%-18s[-] %s", thm.HighlightColor.CSS(), tview.Escape(strings.Join(labels, ", ")), tview.Escape(text)))
+		}
+
+		if len(lines) == 0 {
+			continue
+		}
+
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+
+		builder.WriteString(fmt.Sprintf("[%s::b]%s[-::-]\n", thm.TitleColor.CSS(), category))
+		builder.WriteString(strings.Join(lines, "\n"))
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+// isListedBefore reports whether the action is one of the keys
+func isListedBefore(keys []KeyHelp, action Action) bool {
+	for _, key := range keys {
+		if key.Action == action {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,7 +1,7 @@
 package ui
 
 import (
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/dmars8047/broterm/internal/state"
@@ -13,14 +13,14 @@ import (
 const HOME_PAGE PageSlug = "home"
 
 type HomePage struct {
-	userAuthClient   *idam.UserAuthClient
-	currentThemeCode string
+	serverClients *state.ServerClients
+	sessionStore  *state.SessionStore
 }
 
-func NewHomePage(userAuthClient *idam.UserAuthClient) *HomePage {
+func NewHomePage(serverClients *state.ServerClients, sessionStore *state.SessionStore) *HomePage {
 	return &HomePage{
-		userAuthClient:   userAuthClient,
-		currentThemeCode: "NOT_SET",
+		serverClients: serverClients,
+		sessionStore:  sessionStore,
 	}
 }
 
@@ -70,24 +70,7 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 	logoutButton := tview.NewButton("Logout")
 
 	logoutButton.SetSelectedFunc(func() {
-		accessToken, ok := appContext.GetAccessToken()
-
-		if !ok {
-			log.Printf("Valid user authentication information not found. Redirecting to login page.")
-			nav.NavigateTo(LOGIN_PAGE, nil)
-			return
-		}
-
-		err := page.userAuthClient.Logout(accessToken)
-
-		if err != nil {
-			nav.AlertFatal(app, "home:menu:alert:err", err.Error())
-			return
-		}
-
-		appContext.CancelUserSession()
-
-		nav.NavigateTo(WELCOME_PAGE, nil)
+		logout(app, appContext, nav, page.serverClients.UserAuthClient(), page.sessionStore, pageLogger(HOME_PAGE))
 	})
 
 	buttonGrid := tview.NewGrid()
@@ -128,17 +111,9 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 			}
 		}
 
-		// vim movement keys
-		if event.Key() == tcell.KeyRune {
-			switch event.Rune() {
-			case 'l':
-				goRight()
-			case 'h':
-				goLeft()
-			}
-		} else if event.Key() == tcell.KeyTab || event.Key() == tcell.KeyRight {
+		if nav.Keymap().Matches(ACTION_NEXT, event) {
 			goRight()
-		} else if event.Key() == tcell.KeyBacktab || event.Key() == tcell.KeyLeft {
+		} else if nav.Keymap().Matches(ACTION_PREVIOUS, event) {
 			goLeft()
 		}
 
@@ -161,35 +136,37 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if theme.Code != page.currentThemeCode {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
 
-			logoBro.SetBackgroundColor(theme.BackgroundColor)
-			logoBro.SetTextColor(tcell.ColorWhite)
-			logoChat.SetBackgroundColor(theme.BackgroundColor)
-			logoChat.SetBackgroundColor(theme.BackgroundColor)
-			logoChat.SetTextColor(theme.HighlightColor)
+		logoBro.SetBackgroundColor(theme.BackgroundColor)
+		logoBro.SetTextColor(tcell.ColorWhite)
+		logoChat.SetBackgroundColor(theme.BackgroundColor)
+		logoChat.SetBackgroundColor(theme.BackgroundColor)
+		logoChat.SetTextColor(theme.HighlightColor)
 
-			brosButton.SetActivatedStyle(theme.ActivatedButtonStyle)
-			brosButton.SetStyle(theme.ButtonStyle)
+		brosButton.SetActivatedStyle(theme.ActivatedButtonStyle)
+		brosButton.SetStyle(theme.ButtonStyle)
 
-			chatButton.SetActivatedStyle(theme.ActivatedButtonStyle)
-			chatButton.SetStyle(theme.ButtonStyle)
+		chatButton.SetActivatedStyle(theme.ActivatedButtonStyle)
+		chatButton.SetStyle(theme.ButtonStyle)
 
-			logoutButton.SetActivatedStyle(theme.ActivatedButtonStyle)
-			logoutButton.SetStyle(theme.ButtonStyle)
+		logoutButton.SetActivatedStyle(theme.ActivatedButtonStyle)
+		logoutButton.SetStyle(theme.ButtonStyle)
 
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.ForgroundColor)
-		}
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.ForgroundColor)
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(HOME_PAGE, applyTheme)
+
+	nav.DescribeKeys(HOME_PAGE,
+		KeyHelp{Action: ACTION_NEXT, Description: "Next button"},
+		KeyHelp{Action: ACTION_PREVIOUS, Description: "Previous button"},
+	)
 
 	nav.Register(HOME_PAGE, grid, true, false,
 		func(_ interface{}) {
-			applyTheme()
 			page.onPageLoad(appContext, nav)
 		}, func() {
 			page.onPageClose()
@@ -207,3 +184,38 @@ func (page *HomePage) onPageLoad(appContext *state.ApplicationContext, nav *Page
 func (page *HomePage) onPageClose() {
 	// Nothing to do here
 }
+
+// logout ends the user session, forgets any remembered session and returns to the welcome page
+func logout(app *tview.Application,
+	appContext *state.ApplicationContext,
+	nav *PageNavigator,
+	userAuthClient *idam.UserAuthClient,
+	sessionStore *state.SessionStore,
+	logger *slog.Logger) {
+
+	accessToken, ok := appContext.GetAccessToken()
+
+	if !ok {
+		logger.Info("Valid user authentication information not found, redirecting to login page")
+		nav.NavigateTo(LOGIN_PAGE, nil)
+		return
+	}
+
+	err := userAuthClient.Logout(accessToken)
+
+	if err != nil {
+		nav.AlertFatal(app, "home:menu:alert:err", err.Error())
+		return
+	}
+
+	err = sessionStore.Clear()
+
+	if err != nil {
+		logger.Error("Remembered session could not be removed during logout", "error", err)
+	}
+
+	appContext.CancelUserSession()
+
+	nav.NavigateTo(WELCOME_PAGE, nil)
+	nav.ClearHistory()
+}
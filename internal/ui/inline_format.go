@@ -0,0 +1,185 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/dmars8047/broterm/internal/state"
+	"github.com/rivo/tview"
+)
+
+// inlineStyle is what formatInline styles a line of text with
+type inlineStyle struct {
+	textColor           string
+	codeColor           string
+	codeBackgroundColor string
+	// The username whose mentions are highlighted with the mention tag, empty to highlight none
+	mentionUsername string
+	mentionTag      string
+}
+
+// formatInline turns the markdown style emphasis of a line of text into tview style tags and escapes everything else,
+// so the text itself can never restyle the screen.
+// **bold**, *italic*, _italic_ and `code` are supported. Markers which are not closed on the same line are shown as they are.
+// Mentions are highlighted outside of code. The spaces of code are made non-breaking so it is never wrapped.
+func formatInline(line string, inline inlineStyle) string {
+	var builder strings.Builder
+
+	runes := []rune(line)
+	bold, italic := false, false
+	// The marker which opened the italic text, * or _
+	var italicMarker rune
+	// The start of the text which has not been written yet
+	start := 0
+
+	// emphasis returns the tag for the current emphasis
+	emphasis := func() string {
+		attributes := ""
+
+		if bold {
+			attributes += "b"
+		}
+
+		if italic {
+			attributes += "i"
+		}
+
+		if attributes == "" {
+			attributes = "-"
+		}
+
+		return fmt.Sprintf("[%s:-:%s]", inline.textColor, attributes)
+	}
+
+	// flush writes the text before end which has not been written yet
+	flush := func(end int) {
+		builder.WriteString(highlightMentions(string(runes[start:end]), inline.mentionUsername, inline.mentionTag, emphasis()))
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '`':
+			end := indexOfRune(runes, i+1, '`')
+
+			if end <= i+1 {
+				continue
+			}
+
+			// Code is shown as it is written, without emphasis
+			flush(i)
+			builder.WriteString(fmt.Sprintf("[%s:%s:-]", inline.codeColor, inline.codeBackgroundColor))
+			builder.WriteString(tview.Escape(strings.ReplaceAll(string(runes[i+1:end]), " ", "\u00a0")))
+			builder.WriteString(emphasis())
+			i = end
+			start = end + 1
+		case r == '*' && i+1 < len(runes) && runes[i+1] == '*':
+			if bold && isClosingMarker(runes, i, 2) || !bold && isOpeningMarker(runes, i, 2) && hasClosingMarker(runes, i+2, "**") {
+				flush(i)
+				bold = !bold
+				builder.WriteString(emphasis())
+				start = i + 2
+			}
+
+			i++
+		case r == '*' || r == '_':
+			if italic && r == italicMarker && isClosingMarker(runes, i, 1) {
+				flush(i)
+				italic = false
+				builder.WriteString(emphasis())
+				start = i + 1
+			} else if !italic && isOpeningMarker(runes, i, 1) && hasClosingMarker(runes, i+1, string(r)) {
+				flush(i)
+				italic = true
+				italicMarker = r
+				builder.WriteString(emphasis())
+				start = i + 1
+			}
+		}
+	}
+
+	flush(len(runes))
+
+	// Emphasis must not carry over to the following lines
+	if bold || italic {
+		builder.WriteString(fmt.Sprintf("[%s:-:-]", inline.textColor))
+	}
+
+	return builder.String()
+}
+
+// highlightMentions escapes the text and wraps each mention of the username in the mention tag.
+// The restore tag is written after each mention to go back to the style of the surrounding text.
+func highlightMentions(text string, username string, mentionTag string, restoreTag string) string {
+	var builder strings.Builder
+
+	start := 0
+
+	for _, index := range state.MentionIndexes(text, username) {
+		builder.WriteString(tview.Escape(text[start:index[0]]))
+		builder.WriteString(mentionTag)
+		builder.WriteString(tview.Escape(text[index[0]:index[1]]))
+		builder.WriteString(restoreTag)
+		start = index[1]
+	}
+
+	builder.WriteString(tview.Escape(text[start:]))
+
+	return builder.String()
+}
+
+// indexOfRune returns the index of the first r at or after from, or -1 if there is none
+func indexOfRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isOpeningMarker returns true if the marker of the given length at i can open emphasis.
+// It must be followed by text, and an underscore must not be inside a word so snake_case is left alone.
+func isOpeningMarker(runes []rune, i int, length int) bool {
+	if i+length >= len(runes) || unicode.IsSpace(runes[i+length]) {
+		return false
+	}
+
+	return runes[i] != '_' || i == 0 || !isWordRune(runes[i-1])
+}
+
+// isClosingMarker returns true if the marker of the given length at i can close emphasis.
+// It must follow text, and an underscore must not be inside a word.
+func isClosingMarker(runes []rune, i int, length int) bool {
+	if i == 0 || unicode.IsSpace(runes[i-1]) {
+		return false
+	}
+
+	// A single asterisk next to another one is part of a bold marker
+	if length == 1 && runes[i] == '*' && (runes[i-1] == '*' || i+1 < len(runes) && runes[i+1] == '*') {
+		return false
+	}
+
+	return runes[i] != '_' || i+length == len(runes) || !isWordRune(runes[i+length])
+}
+
+// hasClosingMarker returns true if the marker can close emphasis somewhere at or after from
+func hasClosingMarker(runes []rune, from int, marker string) bool {
+	markerRunes := []rune(marker)
+
+	for i := from + 1; i+len(markerRunes) <= len(runes); i++ {
+		if string(runes[i:i+len(markerRunes)]) == marker && isClosingMarker(runes, i, len(markerRunes)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isWordRune returns true if the rune is a letter or digit
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,78 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/theme"
+)
+
+var testInlineStyle = inlineStyle{
+	textColor:           "white",
+	codeColor:           "yellow",
+	codeBackgroundColor: "black",
+	mentionUsername:     "alice",
+	mentionTag:          "[red::b]",
+}
+
+func TestFormatInline(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"plain text", "plain text", "plain text"},
+		{"emphasis", "**bold** and *italic* and _italic_", "[white:-:b]bold[white:-:-] and [white:-:i]italic[white:-:-] and [white:-:i]italic[white:-:-]"},
+		{"nested emphasis", "**bold *both* bold**", "[white:-:b]bold [white:-:bi]both[white:-:b] bold[white:-:-]"},
+		{"unclosed bold", "**unclosed bold", "**unclosed bold"},
+		{"unclosed italic", "*unclosed", "*unclosed"},
+		{"unclosed code", "`unclosed code", "`unclosed code"},
+		{"empty code", "a`` b", "a`` b"},
+		{"markers around spaces", "a ** b ** c", "a ** b ** c"},
+		{"spaced asterisks", "* not italic *", "* not italic *"},
+		{"snake case", "snake_case_name stays", "snake_case_name stays"},
+		{"snake case after italic", "_leading_ snake_case", "[white:-:i]leading[white:-:-] snake_case"},
+		{"non ascii snake case", "café_ü_x", "café_ü_x"},
+		{"code keeps spaces together", "`a b`", "[yellow:black:-]a b[white:-:-]"},
+		{"tags in text", "[red]injected[::b] tags", "[red[]injected[::b[] tags"},
+		{"tags in code", "`[red]code[::b]`", "[yellow:black:-][red[]code[::b[][white:-:-]"},
+		{"tags in emphasis", "**[red]**", "[white:-:b][red[][white:-:-]"},
+		{"mention", "hi @alice and email bob@alice.com", "hi [red::b]@alice[white:-:-] and email bob@alice.com"},
+		{"mention in code", "`@alice` in code", "[yellow:black:-]@alice[white:-:-] in code"},
+		{"mention in bold", "**@alice**", "[white:-:b][red::b]@alice[white:-:b][white:-:-]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatInline(tt.line, testInlineStyle); got != tt.want {
+				t.Errorf("formatInline(%q)\n got  %q\n want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageRendererEscapesTags(t *testing.T) {
+	users := []chat.UserInfo{{Id: "eve-id", Username: "[red]eve[::b]"}}
+	thm := *theme.NewTheme("default")
+
+	for _, markdown := range []bool{false, true} {
+		for _, raw := range []bool{false, true} {
+			display := config.NewDisplaySettings()
+			display.Markdown = markdown
+
+			renderer := newMessageRenderer(users, getColorManifest(users, thm), thm, display, "", 0, raw, renderNow)
+			lines := renderer.Render(renderMessage("eve-id", time.Minute, "[red]content[::b] [#00FF00:black:u]more"))
+			transcript := strings.Join(lines, "\n")
+
+			// Escaped tags end in [] so tview shows them as written
+			for _, tag := range []string{"[red[]eve[::b[]", "[red[]content[::b[]", "[#00FF00:black:u[]more"} {
+				if !strings.Contains(transcript, tag) {
+					t.Errorf("markdown = %v, raw = %v: %q is not escaped in\n%s", markdown, raw, tag, transcript)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Action is something the user does with a key, such as going back or sending a message
+type Action string
+
+const (
+	ACTION_BACK             Action = "back"
+	ACTION_NEXT             Action = "next"
+	ACTION_PREVIOUS         Action = "previous"
+	ACTION_SELECT           Action = "select"
+	ACTION_SEND_MESSAGE     Action = "send_message"
+	ACTION_NEW_LINE         Action = "new_line"
+	ACTION_OPEN_EDITOR      Action = "open_editor"
+	ACTION_COMPLETE_MENTION Action = "complete_mention"
+	ACTION_HISTORY_PREVIOUS Action = "history_previous"
+	ACTION_HISTORY_NEXT     Action = "history_next"
+	ACTION_SCROLL_UP        Action = "scroll_up"
+	ACTION_SCROLL_DOWN      Action = "scroll_down"
+	ACTION_RESEND_FAILED    Action = "resend_failed"
+	ACTION_DISCARD_FAILED   Action = "discard_failed"
+	ACTION_TOGGLE_RAW       Action = "toggle_raw"
+	ACTION_FORGOT_PASSWORD  Action = "forgot_password"
+	ACTION_SWITCH_PROFILE   Action = "switch_profile"
+	ACTION_FIND_FRIEND      Action = "find_friend"
+	ACTION_PENDING_REQUESTS Action = "pending_requests"
+	ACTION_FIND_ROOM        Action = "find_room"
+	ACTION_CREATE_ROOM      Action = "create_room"
+	ACTION_COMMAND_PALETTE  Action = "command_palette"
+	ACTION_NAVIGATE_BACK    Action = "navigate_back"
+	ACTION_NAVIGATE_FORWARD Action = "navigate_forward"
+	ACTION_SHOW_HELP        Action = "help"
+)
+
+// DEFAULT_KEYS are the keys of every action in the default preset
+var DEFAULT_KEYS = map[Action][]string{
+	ACTION_BACK:             {"Esc"},
+	ACTION_NEXT:             {"Tab", "Right"},
+	ACTION_PREVIOUS:         {"Shift+Tab", "Left"},
+	ACTION_SELECT:           {"Enter"},
+	ACTION_SEND_MESSAGE:     {"Enter"},
+	ACTION_NEW_LINE:         {"Alt+Enter", "Shift+Enter", "Ctrl+J"},
+	ACTION_OPEN_EDITOR:      {"Ctrl+E"},
+	ACTION_COMPLETE_MENTION: {"Tab"},
+	ACTION_HISTORY_PREVIOUS: {"Up"},
+	ACTION_HISTORY_NEXT:     {"Down"},
+	ACTION_SCROLL_UP:        {"PgUp"},
+	ACTION_SCROLL_DOWN:      {"PgDn"},
+	ACTION_RESEND_FAILED:    {"Ctrl+R"},
+	ACTION_DISCARD_FAILED:   {"Ctrl+T"},
+	ACTION_TOGGLE_RAW:       {"Alt+r"},
+	ACTION_FORGOT_PASSWORD:  {"Ctrl+F"},
+	ACTION_SWITCH_PROFILE:   {"p"},
+	ACTION_FIND_FRIEND:      {"f"},
+	ACTION_PENDING_REQUESTS: {"p"},
+	ACTION_FIND_ROOM:        {"f"},
+	ACTION_CREATE_ROOM:      {"n"},
+	ACTION_COMMAND_PALETTE:  {"Ctrl+K"},
+	ACTION_NAVIGATE_BACK:    {"Ctrl+O"},
+	ACTION_NAVIGATE_FORWARD: {"Ctrl+G"},
+	ACTION_SHOW_HELP:        {"?", "F1"},
+}
+
+// PRESET_KEYS are the actions each preset binds differently from the default preset
+var PRESET_KEYS = map[string]map[Action][]string{
+	config.KEYBINDINGS_PRESET_DEFAULT: {},
+	config.KEYBINDINGS_PRESET_VIM: {
+		ACTION_NEXT:        {"Tab", "Right", "l", "j"},
+		ACTION_PREVIOUS:    {"Shift+Tab", "Left", "h", "k"},
+		ACTION_SCROLL_UP:   {"PgUp", "Ctrl+B"},
+		ACTION_SCROLL_DOWN: {"PgDn", "Ctrl+F"},
+	},
+	config.KEYBINDINGS_PRESET_EMACS: {
+		ACTION_NEXT:        {"Tab", "Right", "Ctrl+N"},
+		ACTION_PREVIOUS:    {"Shift+Tab", "Left", "Ctrl+P"},
+		ACTION_SCROLL_UP:   {"PgUp", "Alt+v"},
+		ACTION_SCROLL_DOWN: {"PgDn", "Ctrl+V"},
+	},
+}
+
+// keyNames are the keys which can be written by name, by lower case name
+var keyNames = func() map[string]tcell.Key {
+	names := map[string]tcell.Key{
+		"escape":   tcell.KeyEscape,
+		"return":   tcell.KeyEnter,
+		"pageup":   tcell.KeyPgUp,
+		"pagedown": tcell.KeyPgDn,
+		"del":      tcell.KeyDelete,
+	}
+
+	for key, name := range tcell.KeyNames {
+		// Control keys are written with the Ctrl modifier instead
+		if !strings.HasPrefix(name, "Ctrl-") {
+			names[strings.ToLower(name)] = key
+		}
+	}
+
+	return names
+}()
+
+// KeyBinding is a key along with the modifiers which must be held with it
+type KeyBinding struct {
+	key tcell.Key
+	ch  rune
+	mod tcell.ModMask
+}
+
+// ParseKeyBinding parses a key written as its name or character, optionally preceded by modifiers, for example "Esc", "Ctrl+K" or "Alt+v"
+func ParseKeyBinding(text string) (KeyBinding, error) {
+	text = strings.TrimSpace(text)
+
+	if text == "" {
+		return KeyBinding{}, fmt.Errorf("key must not be empty")
+	}
+
+	if utf8.RuneCountInString(text) == 1 {
+		ch, _ := utf8.DecodeRuneInString(text)
+		return KeyBinding{key: tcell.KeyRune, ch: ch}, nil
+	}
+
+	name := text
+	modifiers := make([]string, 0)
+
+	// The last plus sign may be the key itself, for example "Alt++"
+	if i := strings.LastIndex(text[:len(text)-1], "+"); i >= 0 {
+		modifiers = strings.Split(text[:i], "+")
+		name = text[i+1:]
+	}
+
+	var mod tcell.ModMask
+
+	for _, modifier := range modifiers {
+		switch strings.ToLower(strings.TrimSpace(modifier)) {
+		case "ctrl":
+			mod |= tcell.ModCtrl
+		case "alt":
+			mod |= tcell.ModAlt
+		case "shift":
+			mod |= tcell.ModShift
+		default:
+			return KeyBinding{}, fmt.Errorf("unknown modifier %q in key %q, use Ctrl, Alt or Shift", modifier, text)
+		}
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		ch, _ := utf8.DecodeRuneInString(name)
+		lower := []rune(strings.ToLower(name))[0]
+
+		switch {
+		case mod&tcell.ModShift != 0:
+			return KeyBinding{}, fmt.Errorf("key %q can not be held with Shift, write the shifted character instead", text)
+		case mod&tcell.ModCtrl != 0:
+			if lower < 'a' || lower > 'z' {
+				return KeyBinding{}, fmt.Errorf("key %q can not be held with Ctrl, only letters can", text)
+			}
+
+			return newKeyBinding(tcell.KeyCtrlA+tcell.Key(lower-'a'), 0, mod), nil
+		default:
+			return newKeyBinding(tcell.KeyRune, ch, mod), nil
+		}
+	}
+
+	key, ok := keyNames[strings.ToLower(strings.TrimSpace(name))]
+
+	if !ok {
+		return KeyBinding{}, fmt.Errorf("unknown key %q", text)
+	}
+
+	if key == tcell.KeyTab && mod&tcell.ModShift != 0 {
+		key = tcell.KeyBacktab
+	}
+
+	return newKeyBinding(key, 0, mod), nil
+}
+
+// newKeyBinding creates a key binding which only keeps the modifiers terminals report reliably for the key
+func newKeyBinding(key tcell.Key, ch rune, mod tcell.ModMask) KeyBinding {
+	return KeyBinding{key: key, ch: ch, mod: mod & relevantModifiers(key)}
+}
+
+// relevantModifiers returns the modifiers which tell presses of the key apart.
+// Characters and control keys carry Ctrl and Shift in the key itself.
+func relevantModifiers(key tcell.Key) tcell.ModMask {
+	switch {
+	case key == tcell.KeyEnter:
+		// Some terminals, like the Windows console, report Shift+Enter
+		return tcell.ModAlt | tcell.ModShift
+	case key == tcell.KeyRune || key <= tcell.KeyDEL:
+		return tcell.ModAlt
+	case key == tcell.KeyBacktab:
+		return tcell.ModAlt | tcell.ModCtrl
+	default:
+		return tcell.ModAlt | tcell.ModCtrl | tcell.ModShift
+	}
+}
+
+// Matches reports whether the key event is a press of the key
+func (binding KeyBinding) Matches(event *tcell.EventKey) bool {
+	if event.Key() != binding.key || (binding.key == tcell.KeyRune && event.Rune() != binding.ch) {
+		return false
+	}
+
+	return event.Modifiers()&relevantModifiers(binding.key) == binding.mod
+}
+
+// String returns the key as it is written in the config file
+func (binding KeyBinding) String() string {
+	var modifiers string
+
+	if binding.mod&tcell.ModCtrl != 0 {
+		modifiers += "Ctrl+"
+	}
+
+	if binding.mod&tcell.ModAlt != 0 {
+		modifiers += "Alt+"
+	}
+
+	if binding.mod&tcell.ModShift != 0 {
+		modifiers += "Shift+"
+	}
+
+	switch {
+	case binding.key == tcell.KeyRune:
+		return modifiers + string(binding.ch)
+	case binding.key == tcell.KeyBacktab:
+		return modifiers + "Shift+Tab"
+	case binding.key >= tcell.KeyCtrlA && binding.key <= tcell.KeyCtrlZ && binding.key != tcell.KeyTab && binding.key != tcell.KeyEnter && binding.key != tcell.KeyBackspace:
+		return "Ctrl+" + modifiers + string(rune('A'+binding.key-tcell.KeyCtrlA))
+	default:
+		return modifiers + tcell.KeyNames[binding.key]
+	}
+}
+
+// label returns the key as it is shown in instructions, in lower case apart from the character of a character key
+func (binding KeyBinding) label() string {
+	if binding.key == tcell.KeyRune {
+		return strings.ToLower(strings.TrimSuffix(binding.String(), string(binding.ch))) + string(binding.ch)
+	}
+
+	return strings.ToLower(binding.String())
+}
+
+// Keymap holds the keys of every action
+type Keymap struct {
+	bindings map[Action][]KeyBinding
+}
+
+// NewKeymap builds the keymap of the key binding settings, the keys of the preset replaced by the overrides.
+// Returns an error for each override which names an unknown action or key, those are left out of the keymap.
+func NewKeymap(settings config.KeyBindingSettings) (*Keymap, []error) {
+	keys := make(map[Action][]string, len(DEFAULT_KEYS))
+
+	for action, actionKeys := range DEFAULT_KEYS {
+		keys[action] = actionKeys
+	}
+
+	for action, actionKeys := range PRESET_KEYS[settings.Preset] {
+		keys[action] = actionKeys
+	}
+
+	errs := make([]error, 0)
+	names := make([]string, 0, len(settings.Overrides))
+
+	for name := range settings.Overrides {
+		names = append(names, name)
+	}
+
+	// Sorted so the errors are reported in the same order every time
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := DEFAULT_KEYS[Action(name)]; !ok {
+			errs = append(errs, fmt.Errorf("keybindings.overrides: unknown action %q", name))
+			continue
+		}
+
+		keys[Action(name)] = settings.Overrides[name]
+	}
+
+	keymap := &Keymap{
+		bindings: make(map[Action][]KeyBinding, len(keys)),
+	}
+
+	for action, actionKeys := range keys {
+		bindings := make([]KeyBinding, 0, len(actionKeys))
+
+		for _, text := range actionKeys {
+			binding, err := ParseKeyBinding(text)
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("keybindings.overrides.%s: %w", action, err))
+				continue
+			}
+
+			bindings = append(bindings, binding)
+		}
+
+		keymap.bindings[action] = bindings
+	}
+
+	return keymap, errs
+}
+
+// Matches reports whether the key event is one of the keys of the action
+func (keymap *Keymap) Matches(action Action, event *tcell.EventKey) bool {
+	for _, binding := range keymap.bindings[action] {
+		if binding.Matches(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchesInText reports whether the key event is one of the keys of the action, ignoring character keys
+// so that they can still be typed while a text field has focus
+func (keymap *Keymap) MatchesInText(action Action, event *tcell.EventKey) bool {
+	for _, binding := range keymap.bindings[action] {
+		if binding.key == tcell.KeyRune && binding.mod == tcell.ModNone {
+			continue
+		}
+
+		if binding.Matches(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bindings returns the keys of the action, the primary key first
+func (keymap *Keymap) Bindings(action Action) []KeyBinding {
+	return keymap.bindings[action]
+}
+
+// Hint describes the primary keys of the actions for an instruction bar, for example "(pgup/pgdn) Scroll".
+// Returns an empty string if none of the actions have a key.
+func (keymap *Keymap) Hint(description string, actions ...Action) string {
+	return keymap.hint(description, false, actions)
+}
+
+// TextHint describes the primary keys of the actions like Hint, leaving out the character keys which MatchesInText ignores
+func (keymap *Keymap) TextHint(description string, actions ...Action) string {
+	return keymap.hint(description, true, actions)
+}
+
+// hint describes the first key of each action, skipping character keys when in text
+func (keymap *Keymap) hint(description string, inText bool, actions []Action) string {
+	labels := make([]string, 0, len(actions))
+
+	for _, action := range actions {
+		for _, binding := range keymap.bindings[action] {
+			if inText && binding.key == tcell.KeyRune && binding.mod == tcell.ModNone {
+				continue
+			}
+
+			labels = append(labels, binding.label())
+			break
+		}
+	}
+
+	if len(labels) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("(%s) %s", strings.Join(labels, "/"), description)
+}
+
+// instructions joins the hints of an instruction bar, leaving out empty ones
+func instructions(hints ...string) string {
+	parts := make([]string, 0, len(hints))
+
+	for _, hint := range hints {
+		if hint != "" {
+			parts = append(parts, hint)
+		}
+	}
+
+	return strings.Join(parts, " - ")
+}
+
+// handleTableKeys moves the selection of a table with a header row on the next and previous actions, wrapping around at either end,
+// and selects the row on the select action. Returns the event the table should handle, nil if it was handled.
+func handleTableKeys(keymap *Keymap, table *tview.Table, event *tcell.EventKey) *tcell.EventKey {
+	switch {
+	case keymap.Matches(ACTION_NEXT, event):
+		row, _ := table.GetSelection()
+
+		if row+1 >= table.GetRowCount() {
+			row = 1
+		} else {
+			row++
+		}
+
+		table.Select(row, 0)
+
+		return nil
+	case keymap.Matches(ACTION_PREVIOUS, event):
+		row, _ := table.GetSelection()
+
+		if row-1 < 1 {
+			row = table.GetRowCount() - 1
+		} else {
+			row--
+		}
+
+		table.Select(row, 0)
+
+		return nil
+	case keymap.Matches(ACTION_SELECT, event) && event.Key() != tcell.KeyEnter:
+		// The table selects rows on enter
+		return tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)
+	}
+
+	return event
+}
@@ -0,0 +1,157 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseKeyBinding(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    KeyBinding
+		wantErr bool
+	}{
+		{"Esc", KeyBinding{key: tcell.KeyEscape}, false},
+		{" escape ", KeyBinding{key: tcell.KeyEscape}, false},
+		{"PageUp", KeyBinding{key: tcell.KeyPgUp}, false},
+		{"F1", KeyBinding{key: tcell.KeyF1}, false},
+		{"?", KeyBinding{key: tcell.KeyRune, ch: '?'}, false},
+		{"+", KeyBinding{key: tcell.KeyRune, ch: '+'}, false},
+		{"Alt+v", KeyBinding{key: tcell.KeyRune, ch: 'v', mod: tcell.ModAlt}, false},
+		{"alt++", KeyBinding{key: tcell.KeyRune, ch: '+', mod: tcell.ModAlt}, false},
+		// Control keys carry Ctrl in the key itself
+		{"Ctrl+K", KeyBinding{key: tcell.KeyCtrlK}, false},
+		{"ctrl+k", KeyBinding{key: tcell.KeyCtrlK}, false},
+		{"Shift+Tab", KeyBinding{key: tcell.KeyBacktab}, false},
+		{"Shift+Enter", KeyBinding{key: tcell.KeyEnter, mod: tcell.ModShift}, false},
+		{"Ctrl+Alt+Up", KeyBinding{key: tcell.KeyUp, mod: tcell.ModCtrl | tcell.ModAlt}, false},
+		{"", KeyBinding{}, true},
+		{"Shift+a", KeyBinding{}, true},
+		{"Ctrl+1", KeyBinding{}, true},
+		{"Super+K", KeyBinding{}, true},
+		{"Nope", KeyBinding{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseKeyBinding(tt.text)
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKeyBinding(%q) error = %v, want error %v", tt.text, err, tt.wantErr)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseKeyBinding(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestKeyBindingString(t *testing.T) {
+	for _, text := range []string{"Esc", "PgUp", "?", "Alt+v", "Ctrl+K", "Shift+Tab", "Shift+Enter", "Ctrl+Alt+Up"} {
+		binding, err := ParseKeyBinding(text)
+
+		if err != nil {
+			t.Fatalf("ParseKeyBinding(%q) error = %v", text, err)
+		}
+
+		if got := binding.String(); got != text {
+			t.Errorf("ParseKeyBinding(%q).String() = %q", text, got)
+		}
+	}
+}
+
+func TestKeyBindingMatches(t *testing.T) {
+	tests := []struct {
+		binding string
+		event   *tcell.EventKey
+		want    bool
+	}{
+		{"Esc", tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone), true},
+		{"Ctrl+K", tcell.NewEventKey(tcell.KeyCtrlK, 0, tcell.ModCtrl), true},
+		{"Ctrl+K", tcell.NewEventKey(tcell.KeyRune, 'k', tcell.ModNone), false},
+		{"Alt+v", tcell.NewEventKey(tcell.KeyRune, 'v', tcell.ModAlt), true},
+		{"Alt+v", tcell.NewEventKey(tcell.KeyRune, 'v', tcell.ModNone), false},
+		{"Alt+v", tcell.NewEventKey(tcell.KeyRune, 'V', tcell.ModAlt), false},
+		{"v", tcell.NewEventKey(tcell.KeyRune, 'v', tcell.ModAlt), false},
+		// Shift is part of the character
+		{"V", tcell.NewEventKey(tcell.KeyRune, 'V', tcell.ModShift), true},
+		{"Enter", tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), true},
+		{"Enter", tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModShift), false},
+		{"Shift+Enter", tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModShift), true},
+		{"Shift+Tab", tcell.NewEventKey(tcell.KeyBacktab, 0, tcell.ModShift), true},
+		{"Up", tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModShift), false},
+	}
+
+	for _, tt := range tests {
+		binding, err := ParseKeyBinding(tt.binding)
+
+		if err != nil {
+			t.Fatalf("ParseKeyBinding(%q) error = %v", tt.binding, err)
+		}
+
+		if got := binding.Matches(tt.event); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.binding, tt.event.Name(), got, tt.want)
+		}
+	}
+}
+
+func TestKeymapMatches(t *testing.T) {
+	settings := config.NewKeyBindingSettings()
+	settings.Preset = config.KEYBINDINGS_PRESET_VIM
+	settings.Overrides = map[string][]string{"help": {"?", "F2"}}
+
+	keymap, errs := NewKeymap(settings)
+
+	if len(errs) != 0 {
+		t.Fatalf("NewKeymap() errors = %v", errs)
+	}
+
+	question := tcell.NewEventKey(tcell.KeyRune, '?', tcell.ModNone)
+	j := tcell.NewEventKey(tcell.KeyRune, 'j', tcell.ModNone)
+	altR := tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModAlt)
+
+	tests := []struct {
+		action     Action
+		event      *tcell.EventKey
+		want       bool
+		wantInText bool
+	}{
+		// Character keys can still be typed in text fields
+		{ACTION_SHOW_HELP, question, true, false},
+		{ACTION_SHOW_HELP, tcell.NewEventKey(tcell.KeyF2, 0, tcell.ModNone), true, true},
+		{ACTION_SHOW_HELP, tcell.NewEventKey(tcell.KeyF1, 0, tcell.ModNone), false, false},
+		{ACTION_NEXT, j, true, false},
+		{ACTION_NEXT, tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone), true, true},
+		// Character keys held with a modifier are not typed so they match in text fields
+		{ACTION_TOGGLE_RAW, altR, true, true},
+		{ACTION_BACK, j, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := keymap.Matches(tt.action, tt.event); got != tt.want {
+			t.Errorf("Matches(%s, %s) = %v, want %v", tt.action, tt.event.Name(), got, tt.want)
+		}
+
+		if got := keymap.MatchesInText(tt.action, tt.event); got != tt.wantInText {
+			t.Errorf("MatchesInText(%s, %s) = %v, want %v", tt.action, tt.event.Name(), got, tt.wantInText)
+		}
+	}
+}
+
+func TestNewKeymapReportsInvalidOverrides(t *testing.T) {
+	settings := config.NewKeyBindingSettings()
+	settings.Overrides = map[string][]string{"bogus": {"x"}, "back": {"Nope", "Esc"}}
+
+	keymap, errs := NewKeymap(settings)
+
+	if len(errs) != 2 {
+		t.Errorf("NewKeymap() errors = %v, want one for the unknown action and one for the unknown key", errs)
+	}
+
+	// The valid keys of an override are kept
+	if !keymap.Matches(ACTION_BACK, tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone)) {
+		t.Error("Esc does not match back")
+	}
+}
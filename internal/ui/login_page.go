@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"sync"
 	"time"
 
 	"github.com/dmars8047/brolib/chat"
@@ -13,23 +14,27 @@ import (
 
 const LOGIN_PAGE PageSlug = "login"
 
+// CREDENTIAL_RETENTION_PERIOD is how long after logging in the password is kept to refresh the session with.
+// Once it has passed the user has to log in again when the access token expires.
+const CREDENTIAL_RETENTION_PERIOD = 12 * time.Hour
+
 // LoginPage is the login page
 type LoginPage struct {
-	userAuthClient   *idam.UserAuthClient
-	brochatClient    *chat.BroChatClient
-	feedClient       *state.FeedClient
-	loginForm        *tview.Form
-	currentThemeCode string
+	feedClient     *state.FeedClient
+	serverClients  *state.ServerClients
+	sessionStore   *state.SessionStore
+	profileManager *state.ProfileManager
+	loginForm      *tview.Form
 }
 
 // NewLoginPage creates a new instance of the login page
-func NewLoginPage(userAuthClient *idam.UserAuthClient, brochatClient *chat.BroChatClient, feedClient *state.FeedClient) *LoginPage {
+func NewLoginPage(feedClient *state.FeedClient, serverClients *state.ServerClients, sessionStore *state.SessionStore, profileManager *state.ProfileManager) *LoginPage {
 	return &LoginPage{
-		userAuthClient:   userAuthClient,
-		brochatClient:    brochatClient,
-		feedClient:       feedClient,
-		loginForm:        tview.NewForm(),
-		currentThemeCode: "NOT_SET",
+		feedClient:     feedClient,
+		serverClients:  serverClients,
+		sessionStore:   sessionStore,
+		profileManager: profileManager,
+		loginForm:      tview.NewForm(),
 	}
 }
 
@@ -44,13 +49,15 @@ func (page *LoginPage) Setup(app *tview.Application, appContext *state.Applicati
 	page.loginForm.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignCenter)
 	page.loginForm.AddInputField("Email", "", 0, nil, nil)
 	page.loginForm.AddPasswordField("Password", "", 0, '*', nil)
+	page.loginForm.AddCheckbox("Remember Me", false, nil)
 
 	page.loginForm.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(WELCOME_PAGE, nil)
+		if nav.Keymap().MatchesInText(ACTION_BACK, event) {
+			nav.BackOr(WELCOME_PAGE)
 			return nil
-		} else if event.Key() == tcell.KeyCtrlF {
+		} else if nav.Keymap().MatchesInText(ACTION_FORGOT_PASSWORD, event) {
 			nav.NavigateTo(FORGOT_PW_PAGE, nil)
+			return nil
 		}
 
 		return event
@@ -99,12 +106,20 @@ func (page *LoginPage) Setup(app *tview.Application, appContext *state.Applicati
 			return
 		}
 
+		rememberCheckbox, ok := page.loginForm.GetFormItemByLabel("Remember Me").(*tview.Checkbox)
+
+		if !ok {
+			panic("remember me checkbox form access failure")
+		}
+
+		remember := rememberCheckbox.IsChecked()
+
 		request := &idam.UserLoginRequest{
 			Email:    email,
 			Password: password,
 		}
 
-		loginResponse, err := page.userAuthClient.Login("brochat", request)
+		loginResponse, err := page.serverClients.UserAuthClient().Login("brochat", request)
 
 		if err != nil {
 			errMessage := err.Error()
@@ -137,18 +152,52 @@ func (page *LoginPage) Setup(app *tview.Application, appContext *state.Applicati
 			TokenExpiration: time.Now().Add(time.Duration(loginResponse.ExpiresIn * int64(time.Second))),
 		}
 
-		appContext.SetUserSession(userAuth, func() {
-			app.QueueUpdateDraw(
-				func() {
-					nav.NavigateTo(WELCOME_PAGE, WelcomePageParams{isRedirect: true, redirectMessage: "Your session has expired. Please login again."})
-				},
-			)
-		})
+		// The auth service has no refresh endpoint so the session is kept alive by silently logging in again
+		credentials := newCredentialRefresher(email, password, CREDENTIAL_RETENTION_PERIOD)
+		request.Password = ""
+
+		refresh := func() (state.UserAuth, error) {
+			refreshResponse, err := credentials.login(page.serverClients.UserAuthClient())
+
+			if err != nil {
+				return state.UserAuth{}, err
+			}
+
+			refreshedAuth := state.UserAuth{
+				AccessToken:     refreshResponse.Token,
+				TokenExpiration: time.Now().Add(time.Duration(refreshResponse.ExpiresIn * int64(time.Second))),
+			}
+
+			if remember {
+				page.rememberSession(refreshedAuth, refreshResponse.UserId)
+			}
+
+			return refreshedAuth, nil
+		}
+
+		appContext.SetUserSession(userAuth, refresh, sessionExpiredRedirect(app, nav))
+
+		// The password is overwritten as soon as the session ends
+		sessionDone := appContext.UserSessionDone()
+
+		go func() {
+			<-sessionDone
+			credentials.forget()
+		}()
+
+		if remember {
+			page.rememberSession(userAuth, loginResponse.UserId)
+		} else {
+			page.forgetSession()
+		}
+
+		page.profileManager.RememberEmail(email)
 
 		passwordInput.SetText("")
 		emailInput.SetText("")
+		rememberCheckbox.SetChecked(false)
 
-		getUserResult := page.brochatClient.GetUser(loginResponse.Token, loginResponse.UserId)
+		getUserResult := page.serverClients.BrochatClient().GetUser(loginResponse.Token, loginResponse.UserId)
 
 		err = getUserResult.Err()
 
@@ -179,14 +228,15 @@ func (page *LoginPage) Setup(app *tview.Application, appContext *state.Applicati
 		}
 
 		nav.NavigateTo(HOME_PAGE, nil)
+		nav.ClearHistory()
 	})
 
 	page.loginForm.AddButton("Back", func() {
-		nav.NavigateTo(WELCOME_PAGE, nil)
+		nav.BackOr(WELCOME_PAGE)
 	})
 
 	tvInstructions := tview.NewTextView().SetTextAlign(tview.AlignCenter)
-	tvInstructions.SetText("(CTRL + F) Forgot Password?")
+	tvInstructions.SetText(nav.Keymap().TextHint("Forgot Password?", ACTION_FORGOT_PASSWORD))
 
 	grid.AddItem(page.loginForm, 1, 1, 1, 1, 0, 0, true)
 	grid.AddItem(tvInstructions, 3, 1, 1, 1, 0, 0, false)
@@ -194,36 +244,209 @@ func (page *LoginPage) Setup(app *tview.Application, appContext *state.Applicati
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.loginForm.SetBackgroundColor(theme.AccentColor)
-			page.loginForm.SetFieldBackgroundColor(theme.AccentColorTwo)
-			page.loginForm.SetFieldTextColor(theme.ForgroundColor)
-			page.loginForm.SetLabelColor(theme.HighlightColor)
-			page.loginForm.SetButtonStyle(theme.ButtonStyle)
-			page.loginForm.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
-			page.loginForm.SetBorderColor(theme.BorderColor)
-			page.loginForm.SetTitleColor(theme.TitleColor)
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
-
-		}
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.loginForm.SetBackgroundColor(theme.AccentColor)
+		page.loginForm.SetFieldBackgroundColor(theme.AccentColorTwo)
+		page.loginForm.SetFieldTextColor(theme.ForgroundColor)
+		page.loginForm.SetLabelColor(theme.HighlightColor)
+		page.loginForm.SetButtonStyle(theme.ButtonStyle)
+		page.loginForm.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
+		page.loginForm.SetBorderColor(theme.BorderColor)
+		page.loginForm.SetTitleColor(theme.TitleColor)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.InfoColor)
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(LOGIN_PAGE, applyTheme)
+
+	nav.ExcludeFromHistory(LOGIN_PAGE)
+
+	nav.DescribeKeys(LOGIN_PAGE,
+		KeyHelp{Action: ACTION_FORGOT_PASSWORD},
+		KeyHelp{Action: ACTION_BACK, Description: "Back to the welcome page"},
+	)
 
 	nav.Register(LOGIN_PAGE, grid, true, false, func(param interface{}) {
-		applyTheme()
 		page.onPageLoad(appContext)
 	}, func() {
 		page.onPageClose()
 	})
 }
 
+// RestoreSession restores the remembered user session if there is one which is still valid.
+// The user is fetched, the feed is connected and the home page is navigated to.
+// Returns false if there was no session to restore or it could not be restored.
+func (page *LoginPage) RestoreSession(app *tview.Application, appContext *state.ApplicationContext, nav *PageNavigator) bool {
+	storedSession, ok, err := page.sessionStore.Load()
+
+	if err != nil {
+		pageLogger(LOGIN_PAGE).Error("Remembered session could not be loaded", "error", err)
+		page.forgetSession()
+		return false
+	}
+
+	if !ok {
+		return false
+	}
+
+	// The session is kept in case the user switches back to the server it was started on
+	if !storedSession.BelongsTo(page.serverClients.GetSettings()) {
+		pageLogger(LOGIN_PAGE).Info("Remembered session belongs to a different server and was not restored", "server", storedSession.Server)
+		return false
+	}
+
+	userAuth := state.UserAuth{
+		AccessToken:     storedSession.AccessToken,
+		TokenExpiration: storedSession.TokenExpiration,
+	}
+
+	// The credentials needed to refresh the token are never stored so a restored session ends shortly before its token expires,
+	// sending the user to the login page rather than leaving requests to fail
+	appContext.SetUserSession(userAuth, nil, sessionExpiredRedirect(app, nav))
+
+	getUserResult := page.serverClients.BrochatClient().GetUser(storedSession.AccessToken, storedSession.UserId)
+
+	err = getUserResult.Err()
+
+	if err != nil {
+		pageLogger(LOGIN_PAGE).Warn("Remembered session could not be restored", "error", err)
+
+		if getUserResult.ResponseCode == chat.BROCHAT_RESPONSE_CODE_FORBIDDEN_ERROR {
+			page.forgetSession()
+		}
+
+		appContext.CancelUserSession()
+		return false
+	}
+
+	appContext.SetBrochatUser(getUserResult.Content)
+
+	err = page.feedClient.Connect()
+
+	if err != nil {
+		pageLogger(LOGIN_PAGE).Warn("Feed connection failed while restoring remembered session", "error", err)
+		appContext.CancelUserSession()
+		return false
+	}
+
+	nav.NavigateTo(HOME_PAGE, nil)
+	nav.ClearHistory()
+
+	return true
+}
+
+// rememberSession stores the user session so it can be restored on the next launch.
+func (page *LoginPage) rememberSession(userAuth state.UserAuth, userId string) {
+	err := page.sessionStore.Save(state.StoredSession{
+		AccessToken:     userAuth.AccessToken,
+		TokenExpiration: userAuth.TokenExpiration,
+		UserId:          userId,
+		Server:          page.serverClients.GetSettings().BaseUrl(),
+	})
+
+	if err != nil {
+		pageLogger(LOGIN_PAGE).Error("Session could not be remembered", "error", err)
+	}
+}
+
+// forgetSession removes any remembered user session.
+func (page *LoginPage) forgetSession() {
+	err := page.sessionStore.Clear()
+
+	if err != nil {
+		pageLogger(LOGIN_PAGE).Error("Remembered session could not be removed", "error", err)
+	}
+}
+
+// credentialRefresher logs in again with the user's credentials to refresh the session.
+// Holding on to the password is the price of not sending the user back to the login page every time the access token expires,
+// so it is kept for no longer than needed: it is held as bytes which are overwritten when the session ends or the retention period
+// has passed, whichever comes first. The strings built from it for each login request cannot be overwritten and stay in memory
+// until they are garbage collected, as do the strings the login form held.
+type credentialRefresher struct {
+	email     string
+	password  []byte
+	expiresAt time.Time
+	mu        sync.Mutex
+}
+
+// newCredentialRefresher creates a credential refresher which keeps the password for the retention period
+func newCredentialRefresher(email string, password string, retention time.Duration) *credentialRefresher {
+	return &credentialRefresher{
+		email:     email,
+		password:  []byte(password),
+		expiresAt: time.Now().Add(retention),
+	}
+}
+
+// login logs in with the credentials. Returns state.ErrRefreshUnavailable once they have been forgotten.
+func (refresher *credentialRefresher) login(client *idam.UserAuthClient) (*idam.UserLoginResponse, error) {
+	refresher.mu.Lock()
+
+	if time.Now().After(refresher.expiresAt) {
+		refresher.forgetLocked()
+	}
+
+	if refresher.password == nil {
+		refresher.mu.Unlock()
+		return nil, state.ErrRefreshUnavailable
+	}
+
+	request := &idam.UserLoginRequest{
+		Email:    refresher.email,
+		Password: string(refresher.password),
+	}
+
+	refresher.mu.Unlock()
+
+	return client.Login("brochat", request)
+}
+
+// forget overwrites the password so it can no longer be used
+func (refresher *credentialRefresher) forget() {
+	refresher.mu.Lock()
+	defer refresher.mu.Unlock()
+
+	refresher.forgetLocked()
+}
+
+// forgetLocked overwrites the password. Must be called with the lock held.
+func (refresher *credentialRefresher) forgetLocked() {
+	for i := range refresher.password {
+		refresher.password[i] = 0
+	}
+
+	refresher.password = nil
+}
+
+// sessionExpiredRedirect returns the function called when the user session expires which sends the user back to the welcome page.
+func sessionExpiredRedirect(app *tview.Application, nav *PageNavigator) func() {
+	return func() {
+		app.QueueUpdateDraw(
+			func() {
+				nav.NavigateTo(WELCOME_PAGE, WelcomePageParams{isRedirect: true, redirectMessage: "Your session has expired. Please login again."})
+				nav.ClearHistory()
+			},
+		)
+	}
+}
+
 func (page *LoginPage) onPageLoad(appContext *state.ApplicationContext) {
 	appContext.CancelUserSession()
 	page.loginForm.SetFocus(0)
+
+	// Pre-fill the email last used with the active profile
+	if profile, ok := page.profileManager.GetActiveProfile(); ok && profile.Email != "" {
+		emailInput, ok := page.loginForm.GetFormItemByLabel("Email").(*tview.InputField)
+
+		if !ok {
+			panic("email input form access failure")
+		}
+
+		emailInput.SetText(profile.Email)
+		page.loginForm.SetFocus(1)
+	}
 }
 
 func (page *LoginPage) onPageClose() {
@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dmars8047/broterm/internal/state"
+)
+
+func TestCredentialRefresherForgetsPassword(t *testing.T) {
+	refresher := newCredentialRefresher("alice@example.com", "secret", CREDENTIAL_RETENTION_PERIOD)
+	password := refresher.password
+
+	refresher.forget()
+
+	if string(password) != "\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("password = %q, want it overwritten", password)
+	}
+
+	if _, err := refresher.login(nil); !errors.Is(err, state.ErrRefreshUnavailable) {
+		t.Errorf("login() after forget() error = %v, want state.ErrRefreshUnavailable", err)
+	}
+}
+
+func TestCredentialRefresherRetentionPeriod(t *testing.T) {
+	refresher := newCredentialRefresher("alice@example.com", "secret", 0)
+
+	if _, err := refresher.login(nil); !errors.Is(err, state.ErrRefreshUnavailable) {
+		t.Errorf("login() after the retention period error = %v, want state.ErrRefreshUnavailable", err)
+	}
+
+	if refresher.password != nil {
+		t.Errorf("password = %q, want it forgotten", refresher.password)
+	}
+}
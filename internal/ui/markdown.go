@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The kinds of block a message rendered as Markdown is made of
+const (
+	MARKDOWN_BLOCK_TEXT markdownBlockKind = iota
+	MARKDOWN_BLOCK_CODE
+	MARKDOWN_BLOCK_LIST_ITEM
+	MARKDOWN_BLOCK_QUOTE
+)
+
+var (
+	listItemPattern = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	quotePattern    = regexp.MustCompile(`^\s*>\s?(.*)$`)
+)
+
+type markdownBlockKind int
+
+// markdownBlock is a line of a message, or the lines of a code block
+type markdownBlock struct {
+	kind markdownBlockKind
+	// The lines of a code block, the text of the other blocks without its marker
+	lines []string
+	// The language of a code block or the marker of a list item
+	info string
+	// How deeply a list item is nested
+	level int
+}
+
+// parseMarkdown splits the content of a message into blocks.
+// A code block which is not closed runs to the end of the message.
+func parseMarkdown(content string) []markdownBlock {
+	blocks := make([]markdownBlock, 0)
+	lines := strings.Split(content, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if fence, info, ok := codeFence(line); ok {
+			block := markdownBlock{kind: MARKDOWN_BLOCK_CODE, lines: make([]string, 0), info: info}
+
+			for i++; i < len(lines); i++ {
+				if closing, closingInfo, ok := codeFence(lines[i]); ok && closingInfo == "" && strings.HasPrefix(closing, fence) {
+					break
+				}
+
+				block.lines = append(block.lines, strings.ReplaceAll(lines[i], "\t", "    "))
+			}
+
+			blocks = append(blocks, block)
+			continue
+		}
+
+		if match := listItemPattern.FindStringSubmatch(line); match != nil {
+			blocks = append(blocks, markdownBlock{
+				kind:  MARKDOWN_BLOCK_LIST_ITEM,
+				lines: []string{match[3]},
+				info:  match[2],
+				level: len(strings.ReplaceAll(match[1], "\t", "  ")) / 2,
+			})
+			continue
+		}
+
+		if match := quotePattern.FindStringSubmatch(line); match != nil {
+			blocks = append(blocks, markdownBlock{kind: MARKDOWN_BLOCK_QUOTE, lines: []string{match[1]}})
+			continue
+		}
+
+		blocks = append(blocks, markdownBlock{kind: MARKDOWN_BLOCK_TEXT, lines: []string{line}})
+	}
+
+	return blocks
+}
+
+// codeFence returns the fence and the language named after it if the line opens or closes a code block
+func codeFence(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+
+	for _, marker := range []string{"```", "~~~"} {
+		if !strings.HasPrefix(trimmed, marker) {
+			continue
+		}
+
+		fenceLength := len(trimmed) - len(strings.TrimLeft(trimmed, marker[:1]))
+		fence := trimmed[:fenceLength]
+		info := strings.TrimSpace(trimmed[fenceLength:])
+
+		// A backtick fence must not be followed by backticks, or it is inline code
+		if marker == "```" && strings.Contains(info, "`") {
+			return "", "", false
+		}
+
+		if fields := strings.Fields(info); len(fields) > 0 {
+			info = strings.ToLower(fields[0])
+		}
+
+		return fence, info, true
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,398 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/theme"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Messages sent by the same user within this long of each other are grouped under one label
+const MESSAGE_GROUP_WINDOW = 5 * time.Minute
+
+// UNKNOWN_SENDER_USERNAME labels messages from users who are not found in the channel
+const UNKNOWN_SENDER_USERNAME = "Unknown User"
+
+// MIN_MESSAGE_WRAP_WIDTH is the narrowest messages are wrapped at, however little room the label leaves
+const MIN_MESSAGE_WRAP_WIDTH = 20
+
+// messageRenderer turns chat messages into the styled lines of a transcript.
+// Messages must be rendered oldest first. A day separator is written before the first message of each day
+// and consecutive messages from the same sender are grouped under the label of the first one.
+type messageRenderer struct {
+	users         []chat.UserInfo
+	colorManifest map[string]string
+	theme         theme.Theme
+	display       config.DisplaySettings
+	// The username of the logged in user whose mentions are highlighted
+	mentionUsername string
+	// The width lines are wrapped at, 0 to leave wrapping to the text view
+	width int
+	// Whether messages are shown exactly as written, so they can be copied
+	raw bool
+	// The time relative timestamps are measured from
+	now time.Time
+	// The sender and local time of the last rendered message
+	lastSenderId string
+	lastSentAt   time.Time
+	// The width of the label of the last rendered message, which grouped messages are indented by
+	labelWidth int
+}
+
+// newMessageRenderer creates a renderer which looks senders up in the users and labels them with the colors of the manifest.
+// The display settings decide how timestamps are shown and whether Markdown is rendered.
+// Mentions of the logged in user's username are highlighted with the theme's mention style.
+// Raw messages are shown as written, without Markdown, wrapping or indentation.
+func newMessageRenderer(users []chat.UserInfo, colorManifest map[string]string, thm theme.Theme, display config.DisplaySettings, mentionUsername string, width int, raw bool, now time.Time) *messageRenderer {
+	return &messageRenderer{
+		users:           users,
+		colorManifest:   colorManifest,
+		theme:           thm,
+		display:         display,
+		mentionUsername: mentionUsername,
+		width:           width,
+		raw:             raw,
+		now:             now.Local(),
+	}
+}
+
+// Render returns the lines of a message received from the server
+func (renderer *messageRenderer) Render(msg chat.ChatMessage) []string {
+	color := renderer.colorManifest[msg.SenderUserId]
+
+	// If the color is not found then just make it red
+	if color == "" {
+		color = "#FF0000"
+	}
+
+	return renderer.render(msg.SenderUserId, renderer.username(msg.SenderUserId), color, msg.RecievedAtUtc, msg.Content, "")
+}
+
+// RenderPending returns the lines of a message which has not been delivered yet, followed by the marker
+func (renderer *messageRenderer) RenderPending(senderId string, username string, queuedAt time.Time, content string, marker string) []string {
+	return renderer.render(senderId, username, renderer.theme.InfoColorTwo.CSS(), queuedAt, content, marker)
+}
+
+func (renderer *messageRenderer) render(senderId string, username string, labelStyle string, sentAt time.Time, content string, marker string) []string {
+	sentAt = sentAt.Local()
+	lines := make([]string, 0, 2)
+
+	newDay := renderer.lastSentAt.IsZero() || !sameDay(renderer.lastSentAt, sentAt)
+
+	if newDay {
+		lines = append(lines, renderer.daySeparator(sentAt))
+	}
+
+	grouped := !newDay && senderId == renderer.lastSenderId && sentAt.Sub(renderer.lastSentAt) < MESSAGE_GROUP_WINDOW
+
+	var prefix string
+
+	if grouped {
+		prefix = strings.Repeat(" ", renderer.labelWidth)
+	} else {
+		label := tview.Escape(fmt.Sprintf("%s [%s]: ", username, renderer.timestamp(sentAt)))
+		renderer.labelWidth = tview.TaggedStringWidth(label)
+
+		// The label attributes are reset so they do not carry over to the message
+		prefix = fmt.Sprintf("[%s]%s[-::-]", labelStyle, label)
+	}
+
+	indent := strings.Repeat(" ", renderer.labelWidth)
+
+	// Raw messages are not indented so they can be copied as they were written
+	if renderer.raw {
+		indent = ""
+	}
+
+	for i, line := range renderer.body(content) {
+		if i > 0 {
+			prefix = indent
+		}
+
+		lines = append(lines, prefix+line)
+	}
+
+	if marker != "" {
+		lines[len(lines)-1] += " " + marker
+	}
+
+	renderer.lastSenderId = senderId
+	renderer.lastSentAt = sentAt
+
+	return lines
+}
+
+// body returns the lines of the content of a message, without the label or indentation
+func (renderer *messageRenderer) body(content string) []string {
+	textColor := renderer.theme.ChatTextColor.CSS()
+
+	// The content comes from other users so it is always escaped to keep it from restyling the transcript
+	if renderer.raw {
+		lines := strings.Split(content, "\n")
+
+		for i, line := range lines {
+			lines[i] = fmt.Sprintf("[%s]%s", textColor, renderer.highlightMentions(line))
+		}
+
+		return lines
+	}
+
+	width := 0
+
+	if renderer.width > 0 {
+		width = max(renderer.width-renderer.labelWidth, MIN_MESSAGE_WRAP_WIDTH)
+	}
+
+	if !renderer.display.Markdown {
+		lines := make([]string, 0)
+
+		for _, line := range strings.Split(content, "\n") {
+			lines = append(lines, wrapLine(fmt.Sprintf("[%s]%s", textColor, renderer.highlightMentions(line)), width)...)
+		}
+
+		return lines
+	}
+
+	return renderer.markdown(content, width)
+}
+
+// markdown returns the lines of content rendered as Markdown, wrapped at the width if it is not 0
+func (renderer *messageRenderer) markdown(content string, width int) []string {
+	lines := make([]string, 0)
+	textColor := renderer.theme.ChatTextColor.CSS()
+
+	for _, block := range parseMarkdown(content) {
+		switch block.kind {
+		case MARKDOWN_BLOCK_CODE:
+			lines = append(lines, renderer.codeBlock(block, width)...)
+		case MARKDOWN_BLOCK_LIST_ITEM:
+			bullet := block.info
+
+			if bullet == "-" || bullet == "*" || bullet == "+" {
+				bullet = "•"
+			}
+
+			lead := strings.Repeat("  ", block.level) + bullet + " "
+			leadWidth := tview.TaggedStringWidth(lead)
+
+			for i, line := range wrapLine(renderer.inline(block.lines[0]), width-leadWidth) {
+				if i == 0 {
+					line = fmt.Sprintf("[%s]%s[%s]%s", renderer.theme.HighlightColor.CSS(), lead, textColor, line)
+				} else {
+					line = strings.Repeat(" ", leadWidth) + line
+				}
+
+				lines = append(lines, line)
+			}
+		case MARKDOWN_BLOCK_QUOTE:
+			gutter := fmt.Sprintf("[%s]│ [%s]", renderer.theme.InfoColorTwo.CSS(), textColor)
+
+			for _, line := range wrapLine(renderer.inline(block.lines[0]), width-2) {
+				lines = append(lines, gutter+line)
+			}
+		default:
+			lines = append(lines, wrapLine(fmt.Sprintf("[%s]%s", textColor, renderer.inline(block.lines[0])), width)...)
+		}
+	}
+
+	return lines
+}
+
+// inline returns the line with its bold, italic, code and mentions formatted
+func (renderer *messageRenderer) inline(line string) string {
+	return formatInline(line, inlineStyle{
+		textColor:           renderer.theme.ChatTextColor.CSS(),
+		codeColor:           renderer.theme.CodeTextColor.CSS(),
+		codeBackgroundColor: renderer.theme.CodeBackgroundColor.CSS(),
+		mentionUsername:     renderer.mentionUsername,
+		mentionTag:          styleTag(renderer.theme.MentionStyle),
+	})
+}
+
+// highlightMentions returns the escaped line with the mentions of the logged in user highlighted
+func (renderer *messageRenderer) highlightMentions(line string) string {
+	textColor := renderer.theme.ChatTextColor.CSS()
+
+	return highlightMentions(line, renderer.mentionUsername, styleTag(renderer.theme.MentionStyle), fmt.Sprintf("[%s:-:-]", textColor))
+}
+
+// codeBlock returns the lines of a code block on the code background.
+// Code is never wrapped, the lines are padded to the same width so the block stands out as a whole.
+func (renderer *messageRenderer) codeBlock(block markdownBlock, width int) []string {
+	var language *syntaxLanguage
+
+	if renderer.display.SyntaxHighlighting {
+		language = syntaxLanguages[block.info]
+	}
+
+	colors := syntaxColors{
+		text:    renderer.theme.CodeTextColor.CSS(),
+		keyword: renderer.theme.CodeKeywordColor.CSS(),
+		literal: renderer.theme.CodeStringColor.CSS(),
+		comment: renderer.theme.CodeCommentColor.CSS(),
+	}
+
+	codeLines := block.lines
+
+	if len(codeLines) == 0 {
+		codeLines = []string{""}
+	}
+
+	// A space of margin is kept on either side of the code
+	blockWidth := width - 2
+
+	for _, line := range codeLines {
+		blockWidth = max(blockWidth, tview.TaggedStringWidth(tview.Escape(line)))
+	}
+
+	lines := make([]string, 0, len(codeLines))
+
+	for _, line := range codeLines {
+		padding := strings.Repeat(" ", blockWidth-tview.TaggedStringWidth(tview.Escape(line)))
+
+		var highlighted string
+
+		if language != nil {
+			highlighted = highlightCode(line, language, colors)
+		} else {
+			highlighted = tview.Escape(line)
+		}
+
+		// The style is reset at the end so the background does not carry over to the next line
+		lines = append(lines, fmt.Sprintf("[%s:%s:-] %s%s [-:-:-]", colors.text, renderer.theme.CodeBackgroundColor.CSS(), highlighted, padding))
+	}
+
+	return lines
+}
+
+// username returns the username of the channel user or UNKNOWN_SENDER_USERNAME if they are not found
+func (renderer *messageRenderer) username(userId string) string {
+	for _, u := range renderer.users {
+		if u.Id == userId {
+			return u.Username
+		}
+	}
+
+	return UNKNOWN_SENDER_USERNAME
+}
+
+// daySeparator returns the line shown above the first message of a day, the year is only included if it is not the current one
+func (renderer *messageRenderer) daySeparator(day time.Time) string {
+	layout := "Monday, Jan 2"
+
+	if day.Year() != renderer.now.Year() {
+		layout = "Monday, Jan 2, 2006"
+	}
+
+	separator := fmt.Sprintf("— %s —", day.Format(layout))
+
+	// Center the separator when the width is known
+	if renderer.width > 0 && !renderer.raw {
+		separator = strings.Repeat(" ", max((renderer.width-tview.TaggedStringWidth(separator))/2, 0)) + separator
+	}
+
+	return fmt.Sprintf("[%s]%s[-]", renderer.theme.InfoColorTwo.CSS(), separator)
+}
+
+// timestamp formats the time a message was sent in the configured timestamp format
+func (renderer *messageRenderer) timestamp(sentAt time.Time) string {
+	switch renderer.display.TimestampFormat {
+	case config.TIMESTAMP_FORMAT_24H:
+		return sentAt.Format("15:04")
+	case config.TIMESTAMP_FORMAT_RELATIVE:
+		return relativeTime(sentAt, renderer.now)
+	}
+
+	return sentAt.Format(time.Kitchen)
+}
+
+// styleTag returns the tview style tag which draws text in the style
+func styleTag(style tcell.Style) string {
+	foreground, background, attributes := style.Decompose()
+
+	tagColor := func(color tcell.Color) string {
+		if !color.Valid() {
+			return "-"
+		}
+
+		return color.CSS()
+	}
+
+	flags := ""
+
+	for _, attribute := range []struct {
+		mask tcell.AttrMask
+		flag string
+	}{
+		{tcell.AttrBold, "b"},
+		{tcell.AttrItalic, "i"},
+		{tcell.AttrUnderline, "u"},
+		{tcell.AttrReverse, "r"},
+		{tcell.AttrBlink, "l"},
+		{tcell.AttrDim, "d"},
+		{tcell.AttrStrikeThrough, "s"},
+	} {
+		if attributes&attribute.mask != 0 {
+			flags += attribute.flag
+		}
+	}
+
+	if flags == "" {
+		flags = "-"
+	}
+
+	return fmt.Sprintf("[%s:%s:%s]", tagColor(foreground), tagColor(background), flags)
+}
+
+// wrapLine splits a styled line into lines no wider than the width, or returns it as it is if the width is 0
+func wrapLine(line string, width int) []string {
+	if width <= 0 {
+		return []string{line}
+	}
+
+	lines := tview.WordWrap(line, width)
+
+	// An escaped tag at the end of the line is followed by an empty line
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return []string{line}
+	}
+
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+
+	return lines
+}
+
+// relativeTime describes how long before now the time is, for example 5m ago
+func relativeTime(t time.Time, now time.Time) string {
+	elapsed := now.Sub(t)
+
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed/time.Minute))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed/time.Hour))
+	}
+
+	return fmt.Sprintf("%dd ago", int(elapsed/(24*time.Hour)))
+}
+
+// sameDay returns true if both times fall on the same calendar day
+func sameDay(a time.Time, b time.Time) bool {
+	aYear, aMonth, aDay := a.Date()
+	bYear, bMonth, bDay := b.Date()
+
+	return aYear == bYear && aMonth == bMonth && aDay == bDay
+}
@@ -0,0 +1,158 @@
+package ui
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmars8047/brolib/chat"
+	"github.com/dmars8047/broterm/internal/config"
+	"github.com/dmars8047/broterm/internal/theme"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// The time the transcripts are rendered at
+var renderNow = time.Date(2024, time.March, 15, 12, 0, 0, 0, time.Local)
+
+var renderUsers = []chat.UserInfo{
+	{Id: "alice-id", Username: "alice"},
+	{Id: "bob-id", Username: "bob"},
+}
+
+// renderMessage returns a message sent by the user the given time before renderNow
+func renderMessage(senderId string, before time.Duration, content string) chat.ChatMessage {
+	return chat.ChatMessage{SenderUserId: senderId, RecievedAtUtc: renderNow.Add(-before), Content: content}
+}
+
+// renderTranscript renders the messages, oldest first, in the timestamp format without Markdown
+func renderTranscript(timestampFormat string, messages []chat.ChatMessage) string {
+	display := config.NewDisplaySettings()
+	display.TimestampFormat = timestampFormat
+	display.Markdown = false
+
+	return renderTranscriptWith(display, messages)
+}
+
+// renderTranscriptWith renders the messages, oldest first, with the display settings
+func renderTranscriptWith(display config.DisplaySettings, messages []chat.ChatMessage) string {
+	thm := *theme.NewTheme("default")
+
+	renderer := newMessageRenderer(renderUsers, getColorManifest(renderUsers, thm), thm, display, "", 60, false, renderNow)
+
+	var builder strings.Builder
+
+	for _, msg := range messages {
+		for _, line := range renderer.Render(msg) {
+			builder.WriteString(line)
+			builder.WriteString("\n")
+		}
+	}
+
+	return builder.String()
+}
+
+// assertGolden compares the output with testdata/<name>.golden, or rewrites the file when run with -update
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("golden file could not be read, run the tests with -update to create it - %v", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("output does not match %s\n--- got ---\n%s--- want ---\n%s", path, got, want)
+	}
+}
+
+func TestMessageRendererDaySeparators(t *testing.T) {
+	messages := []chat.ChatMessage{
+		// Last year, so the separator includes the year
+		renderMessage("alice-id", 400*24*time.Hour, "last year"),
+		// Just before midnight two days ago
+		renderMessage("alice-id", 36*time.Hour+2*time.Minute, "almost midnight"),
+		// Same sender within the group window but on the next day, so the label is repeated
+		renderMessage("alice-id", 35*time.Hour+59*time.Minute, "past midnight"),
+		renderMessage("bob-id", time.Hour, "today"),
+	}
+
+	assertGolden(t, "day_separators", renderTranscript(config.TIMESTAMP_FORMAT_12H, messages))
+}
+
+func TestMessageRendererGrouping(t *testing.T) {
+	messages := []chat.ChatMessage{
+		renderMessage("alice-id", 30*time.Minute, "first"),
+		// Within the group window of the previous message
+		renderMessage("alice-id", 28*time.Minute, "second"),
+		renderMessage("alice-id", 24*time.Minute, "third\nwith a second line"),
+		// Past the group window
+		renderMessage("alice-id", 10*time.Minute, "after a pause"),
+		renderMessage("bob-id", 9*time.Minute, "another sender"),
+		renderMessage("alice-id", 8*time.Minute, "back again"),
+		renderMessage("unknown-id", 7*time.Minute, "who am I"),
+	}
+
+	assertGolden(t, "grouping", renderTranscript(config.TIMESTAMP_FORMAT_12H, messages))
+}
+
+func TestMessageRendererTimestampFormats(t *testing.T) {
+	messages := []chat.ChatMessage{
+		renderMessage("alice-id", 11*time.Hour+45*time.Minute, "just after midnight"),
+		renderMessage("bob-id", 3*time.Hour+30*time.Minute, "early morning"),
+		renderMessage("alice-id", 20*time.Minute, "minutes ago"),
+		renderMessage("bob-id", 10*time.Second, "just now"),
+	}
+
+	for _, format := range config.TimestampFormats() {
+		t.Run(format, func(t *testing.T) {
+			assertGolden(t, "timestamps_"+format, renderTranscript(format, messages))
+		})
+	}
+}
+
+func TestMessageRendererMarkdown(t *testing.T) {
+	messages := []chat.ChatMessage{
+		renderMessage("alice-id", 10*time.Minute, "Try **this** with `go run`:\n"+
+			"```go\n"+
+			"// main prints a greeting\n"+
+			"func main() {\n"+
+			"\tfmt.Println(\"hi [red]\", 42)\n"+
+			"}\n"+
+			"```\n"+
+			"- first\n"+
+			"  - nested *item*\n"+
+			"2. numbered\n"+
+			"> quoted _text_\n"+
+			"> on two lines"),
+		// Fenced without a language and never closed
+		renderMessage("bob-id", 5*time.Minute, "```\nplain [::b]code\nto the end"),
+	}
+
+	display := config.NewDisplaySettings()
+	display.Markdown = true
+	display.SyntaxHighlighting = true
+
+	assertGolden(t, "markdown", renderTranscriptWith(display, messages))
+
+	// Without highlighting code blocks keep their style but not the colors of the language
+	display.SyntaxHighlighting = false
+
+	assertGolden(t, "markdown_no_highlighting", renderTranscriptWith(display, messages))
+}
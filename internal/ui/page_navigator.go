@@ -2,34 +2,142 @@ package ui
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
 
+	"github.com/dmars8047/broterm/internal/logging"
 	"github.com/dmars8047/broterm/internal/state"
+	"github.com/dmars8047/broterm/internal/theme"
+	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
 type PageSlug string
 
+// MAX_HISTORY_LENGTH is the number of pages kept in the navigation history
+const MAX_HISTORY_LENGTH = 50
+
+// historyEntry is a page in the navigation history along with the param it was opened with
+type historyEntry struct {
+	page  PageSlug
+	param interface{}
+}
+
 // PageNavigator is a page navigator
 type PageNavigator struct {
 	current    PageSlug
 	Pages      *tview.Pages
+	Layout     *tview.Flex
+	statusBar  *StatusBar
 	appContext *state.ApplicationContext
 	openFuncs  map[PageSlug]func(interface{})
 	closeFuncs map[PageSlug]func()
+	themeFuncs map[PageSlug]func()
+	// The restyle funcs of the open modals by page id
+	modalThemeFuncs map[string]func(theme.Theme)
+	// The visited pages, oldest first, and the index of the current one
+	history         []historyEntry
+	historyPosition int
+	// Pages which are never recorded in the history
+	historyExcluded map[PageSlug]bool
+	keymap          *Keymap
+	// The handlers of the actions which work on every page, in the order they were bound
+	globalActions  []Action
+	globalHandlers map[Action]func()
+	// The keys described in the help of each page
+	pageKeys map[PageSlug][]KeyHelp
 }
 
-// NewNavigator creates a new page navigator
-func NewNavigator(appContext *state.ApplicationContext) *PageNavigator {
+// NewNavigator creates a new page navigator which handles keys with the keymap
+func NewNavigator(appContext *state.ApplicationContext, keymap *Keymap) *PageNavigator {
 	pages := tview.NewPages()
+	statusBar := NewStatusBar(appContext)
 
-	return &PageNavigator{
+	// The status bar is rendered beneath every page
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(pages, 0, 1, true).
+		AddItem(statusBar.textView, 1, 0, false)
+
+	nav := &PageNavigator{
 		appContext: appContext,
 		current:    WELCOME_PAGE,
 		Pages:      pages,
+		Layout:     layout,
+		statusBar:  statusBar,
 		openFuncs:  make(map[PageSlug]func(interface{})),
 		closeFuncs: make(map[PageSlug]func()),
+		themeFuncs: make(map[PageSlug]func()),
+
+		modalThemeFuncs: make(map[string]func(theme.Theme)),
+		history:         []historyEntry{{page: WELCOME_PAGE}},
+		historyExcluded: make(map[PageSlug]bool),
+		keymap:          keymap,
+		globalHandlers:  make(map[Action]func()),
+		pageKeys:        make(map[PageSlug][]KeyHelp),
+	}
+
+	nav.BindGlobalAction(ACTION_NAVIGATE_BACK, func() {
+		if !nav.isModalOpen() {
+			nav.Back()
+		}
+	})
+
+	nav.BindGlobalAction(ACTION_NAVIGATE_FORWARD, func() {
+		if !nav.isModalOpen() {
+			nav.Forward()
+		}
+	})
+
+	nav.BindGlobalAction(ACTION_SHOW_HELP, nav.toggleHelp)
+
+	return nav
+}
+
+// HandleGlobalKeys handles the keys of the global actions before the focused page or modal sees them.
+// Character keys are left to text fields while one has focus so they can still be typed.
+func (nav *PageNavigator) HandleGlobalKeys(app *tview.Application) {
+	nav.Layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		inText := isTextField(app.GetFocus())
+
+		for _, action := range nav.globalActions {
+			if (inText && nav.keymap.MatchesInText(action, event)) || (!inText && nav.keymap.Matches(action, event)) {
+				nav.globalHandlers[action]()
+				return nil
+			}
+		}
+
+		return event
+	})
+}
+
+// isTextField reports whether the primitive is one that text is typed into
+func isTextField(primitive tview.Primitive) bool {
+	switch primitive.(type) {
+	case *tview.InputField, *tview.TextArea:
+		return true
+	default:
+		return false
+	}
+}
+
+// Keymap returns the keys of every action
+func (nav *PageNavigator) Keymap() *Keymap {
+	return nav.keymap
+}
+
+// BindGlobalAction calls the handler whenever a key of the action is pressed, whichever page or modal has focus
+func (nav *PageNavigator) BindGlobalAction(action Action, handler func()) {
+	if _, ok := nav.globalHandlers[action]; !ok {
+		nav.globalActions = append(nav.globalActions, action)
 	}
+
+	nav.globalHandlers[action] = handler
+}
+
+// isModalOpen reports whether a modal is shown over the current page
+func (nav *PageNavigator) isModalOpen() bool {
+	front, _ := nav.Pages.GetFrontPage()
+	return front != string(nav.current)
 }
 
 // Register registers a page with the page navigator
@@ -50,39 +158,230 @@ func (nav *PageNavigator) Register(page PageSlug,
 	}
 }
 
-// NavigateTo navigates to a page
+// ExcludeFromHistory keeps the pages out of the navigation history so they can not be revisited with Back or Forward
+func (nav *PageNavigator) ExcludeFromHistory(pages ...PageSlug) {
+	for _, page := range pages {
+		nav.historyExcluded[page] = true
+	}
+}
+
+// NavigateTo navigates to a page and records it in the history, dropping any pages which could be gone forward to
 func (nav *PageNavigator) NavigateTo(pageName PageSlug, param interface{}) {
+	nav.record(pageName, param)
+	nav.show(pageName, param)
+}
+
+// Replace navigates to a page and records it in the history in place of the current page
+func (nav *PageNavigator) Replace(pageName PageSlug, param interface{}) {
+	if nav.isCurrentRecorded() {
+		nav.history = nav.history[:nav.historyPosition]
+		nav.historyPosition--
+	}
+
+	nav.record(pageName, param)
+	nav.show(pageName, param)
+}
+
+// Back navigates to the previous page in the history, reopening it with the param it was opened with.
+// Returns false if there is no page to go back to.
+func (nav *PageNavigator) Back() bool {
+	target := nav.historyPosition
+
+	// A page which is not recorded is left for the last recorded page
+	if nav.isCurrentRecorded() {
+		target--
+	}
+
+	if target < 0 {
+		return false
+	}
+
+	nav.historyPosition = target
+	entry := nav.history[target]
+	nav.show(entry.page, entry.param)
+
+	return true
+}
+
+// BackOr navigates to the previous page in the history or to the fallback page if there is none
+func (nav *PageNavigator) BackOr(fallback PageSlug) {
+	if !nav.Back() {
+		nav.NavigateTo(fallback, nil)
+	}
+}
+
+// Forward navigates to the page which was gone back from, reopening it with the param it was opened with.
+// Returns false if there is no page to go forward to.
+func (nav *PageNavigator) Forward() bool {
+	if nav.historyPosition+1 >= len(nav.history) {
+		return false
+	}
+
+	nav.historyPosition++
+	entry := nav.history[nav.historyPosition]
+	nav.show(entry.page, entry.param)
+
+	return true
+}
+
+// ClearHistory forgets every page but the current one, for example once the user session the pages belonged to has ended
+func (nav *PageNavigator) ClearHistory() {
+	nav.history = nav.history[:0]
+	nav.historyPosition = -1
+
+	if !nav.historyExcluded[nav.current] {
+		nav.history = append(nav.history, nav.currentEntry())
+		nav.historyPosition = 0
+	}
+}
+
+// currentEntry returns the history entry of the current page
+func (nav *PageNavigator) currentEntry() historyEntry {
+	if nav.historyPosition >= 0 && nav.history[nav.historyPosition].page == nav.current {
+		return nav.history[nav.historyPosition]
+	}
+
+	return historyEntry{page: nav.current}
+}
+
+// isCurrentRecorded reports whether the current page is the current history entry
+func (nav *PageNavigator) isCurrentRecorded() bool {
+	return !nav.historyExcluded[nav.current] && nav.historyPosition >= 0
+}
+
+// record adds the page after the current history entry, dropping the entries which followed it
+func (nav *PageNavigator) record(pageName PageSlug, param interface{}) {
+	if nav.historyExcluded[pageName] {
+		return
+	}
+
+	nav.history = append(nav.history[:nav.historyPosition+1], historyEntry{page: pageName, param: param})
+
+	if len(nav.history) > MAX_HISTORY_LENGTH {
+		nav.history = nav.history[len(nav.history)-MAX_HISTORY_LENGTH:]
+	}
+
+	nav.historyPosition = len(nav.history) - 1
+}
+
+// forget removes the latest history entry of the page
+func (nav *PageNavigator) forget(pageName PageSlug) {
+	for i := nav.historyPosition; i >= 0; i-- {
+		if nav.history[i].page != pageName {
+			continue
+		}
+
+		nav.history = append(nav.history[:i], nav.history[i+1:]...)
+		nav.historyPosition--
+
+		return
+	}
+}
+
+// show closes the current page and opens the given one
+func (nav *PageNavigator) show(pageName PageSlug, param interface{}) {
 	close, ok := nav.closeFuncs[nav.current]
 
 	if ok {
 		close()
 	}
 
+	nav.current = pageName
+
 	open, ok := nav.openFuncs[pageName]
 
 	if ok {
 		open(param)
 	}
 
+	// The page redirected to another page while it was opening so it can not be returned to
+	if nav.current != pageName {
+		nav.forget(pageName)
+		return
+	}
+
 	nav.Pages.SwitchToPage(string(pageName))
+}
 
-	nav.current = pageName
+// MonitorConnection displays the feed client's connection state in the status bar until the application context is done.
+func (nav *PageNavigator) MonitorConnection(app *tview.Application, feedClient *state.FeedClient) {
+	nav.statusBar.monitor(app, feedClient)
 }
 
-// Confirm creates a confirmation modal
-func (nav *PageNavigator) Confirm(id string, massage string, yesFunc func()) *tview.Pages {
-	theme := nav.appContext.GetTheme()
+// SubscribeToThemeChanges registers the func which restyles a page. It is called on the UI goroutine whenever the active theme changes.
+func (nav *PageNavigator) SubscribeToThemeChanges(page PageSlug, applyFunc func()) {
+	nav.themeFuncs[page] = applyFunc
+}
 
-	modal := tview.NewModal().
-		SetText(massage).
-		AddButtons([]string{"Yes", "No"}).
-		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-			if buttonLabel == "Yes" {
-				yesFunc()
+// MonitorTheme restyles the whole UI, including every registered page and any open modal,
+// whenever the active theme changes until the application context is done.
+func (nav *PageNavigator) MonitorTheme(app *tview.Application) {
+	registry := nav.appContext.GetThemeRegistry()
+	subscriptionId, themeChannel := registry.Subscribe()
+
+	go func() {
+		defer registry.Unsubscribe(subscriptionId)
+
+		for {
+			select {
+			case <-nav.appContext.Context.Done():
+				return
+			case _, ok := <-themeChannel:
+				if !ok {
+					return
+				}
+
+				app.QueueUpdateDraw(nav.applyTheme)
 			}
-			nav.Pages.HidePage(id).RemovePage(id)
-		})
+		}
+	}()
+}
+
+// applyTheme restyles the UI with the active theme. Must be called on the UI goroutine.
+func (nav *PageNavigator) applyTheme() {
+	activeTheme := nav.appContext.GetTheme()
+
+	activeTheme.ApplyGlobals()
+	nav.Pages.SetBackgroundColor(activeTheme.BackgroundColor)
+	nav.statusBar.render()
+
+	// The current page is restyled last so a page previewing another theme has the final say
+	for page, applyFunc := range nav.themeFuncs {
+		if page != nav.current {
+			applyFunc()
+		}
+	}
+
+	if applyFunc, ok := nav.themeFuncs[nav.current]; ok {
+		applyFunc()
+	}
+
+	for id, applyFunc := range nav.modalThemeFuncs {
+		// Modals closed by their own done funcs are only forgotten here
+		if !nav.Pages.HasPage(id) {
+			delete(nav.modalThemeFuncs, id)
+			continue
+		}
+
+		applyFunc(activeTheme)
+	}
+}
 
+// addModal adds a modal page styled with the active theme which is restyled whenever the theme changes
+func (nav *PageNavigator) addModal(id string, primitive tview.Primitive, resize bool, applyFunc func(theme.Theme)) *tview.Pages {
+	applyFunc(nav.appContext.GetTheme())
+	nav.modalThemeFuncs[id] = applyFunc
+
+	return nav.Pages.AddPage(
+		id,
+		primitive,
+		resize,
+		true,
+	)
+}
+
+// styleModal styles a modal with the theme
+func styleModal(modal *tview.Modal, theme theme.Theme) {
 	modal.SetBackgroundColor(theme.BackgroundColor)
 	modal.SetTextColor(theme.ForgroundColor)
 	modal.SetButtonStyle(theme.ButtonStyle)
@@ -90,92 +389,99 @@ func (nav *PageNavigator) Confirm(id string, massage string, yesFunc func()) *tv
 	modal.SetBorderColor(theme.BorderColor)
 	modal.SetBorderStyle(theme.TextAreaTextStyle)
 	modal.SetTitleColor(theme.TitleColor)
+}
 
-	return nav.Pages.AddPage(
-		id,
-		modal,
-		false,
-		true,
-	)
+// Confirm creates a confirmation modal. The message is shown as plain text.
+func (nav *PageNavigator) Confirm(id string, massage string, yesFunc func()) *tview.Pages {
+	modal := tview.NewModal().
+		SetText(tview.Escape(massage)).
+		AddButtons([]string{"Yes", "No"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			if buttonLabel == "Yes" {
+				yesFunc()
+			}
+			nav.Pages.HidePage(id).RemovePage(id)
+		})
+
+	return nav.addModal(id, modal, false, func(theme theme.Theme) {
+		styleModal(modal, theme)
+	})
 }
 
-// Alert creates an alert modal
+// Alert creates an alert modal. The message is shown as plain text.
 func (nav *PageNavigator) Alert(id string, message string) *tview.Pages {
-	theme := nav.appContext.GetTheme()
-
 	modal := tview.NewModal().
-		SetText(message).
+		SetText(tview.Escape(message)).
 		AddButtons([]string{"Close"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			nav.Pages.HidePage(id).RemovePage(id)
 		})
 
-	modal.SetBackgroundColor(theme.BackgroundColor)
-	modal.SetTextColor(theme.ForgroundColor)
-	modal.SetButtonStyle(theme.ButtonStyle)
-	modal.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
-	modal.SetBorderColor(theme.BorderColor)
-	modal.SetBorderStyle(theme.TextAreaTextStyle)
-	modal.SetTitleColor(theme.TitleColor)
-
-	return nav.Pages.AddPage(
-		id,
-		modal,
-		false,
-		true,
-	)
+	return nav.addModal(id, modal, false, func(theme theme.Theme) {
+		styleModal(modal, theme)
+	})
 }
 
-// AlertWithDoneFunc creates an alert modal with a done function
+// AlertWithDoneFunc creates an alert modal with a done function. The message is shown as plain text.
 func (nav *PageNavigator) AlertWithDoneFunc(id string, message string, doneFunc func(buttonIndex int, buttonLabel string)) *tview.Pages {
-	theme := nav.appContext.GetTheme()
-
 	modal := tview.NewModal().
-		SetText(message).
+		SetText(tview.Escape(message)).
 		AddButtons([]string{"Close"}).
 		SetDoneFunc(doneFunc)
 
-	modal.SetBackgroundColor(theme.BackgroundColor)
-	modal.SetTextColor(theme.ForgroundColor)
-	modal.SetButtonStyle(theme.ButtonStyle)
-	modal.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
-	modal.SetBorderColor(theme.BorderColor)
-	modal.SetBorderStyle(theme.TextAreaTextStyle)
-	modal.SetTitleColor(theme.TitleColor)
-
-	return nav.Pages.AddPage(
-		id,
-		modal,
-		false,
-		true,
-	)
+	return nav.addModal(id, modal, false, func(theme theme.Theme) {
+		styleModal(modal, theme)
+	})
 }
 
-// AlertFatal creates a fatal alert modal
+// AlertFatal creates a fatal alert modal. The message is shown as plain text.
 func (nav *PageNavigator) AlertFatal(app *tview.Application, id string, message string) *tview.Pages {
-	theme := nav.appContext.GetTheme()
-
 	modal := tview.NewModal().
-		SetText("Fatal Error: " + message).
+		SetText("Fatal Error: " + tview.Escape(message)).
 		AddButtons([]string{"Exit"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			app.Stop()
 		})
 
-	modal.SetBackgroundColor(theme.BackgroundColor)
-	modal.SetTextColor(theme.ForgroundColor)
-	modal.SetButtonStyle(theme.ButtonStyle)
-	modal.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
-	modal.SetBorderColor(theme.BorderColor)
-	modal.SetBorderStyle(theme.TextAreaTextStyle)
-	modal.SetTitleColor(theme.TitleColor)
+	return nav.addModal(id, modal, false, func(theme theme.Theme) {
+		styleModal(modal, theme)
+	})
+}
 
-	return nav.Pages.AddPage(
-		id,
-		modal,
-		false,
-		true,
-	)
+// Select creates a modal list of options. The selected func is called with the chosen option after the modal is closed.
+// Pressing escape closes the modal without choosing an option.
+func (nav *PageNavigator) Select(id, title string, options []string, selectedFunc func(index int, option string)) *tview.Pages {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignCenter)
+
+	for i, option := range options {
+		index := i
+		chosen := option
+
+		list.AddItem(option, "", 0, func() {
+			nav.Pages.HidePage(id).RemovePage(id)
+			selectedFunc(index, chosen)
+		})
+	}
+
+	list.SetDoneFunc(func() {
+		nav.Pages.HidePage(id).RemovePage(id)
+	})
+
+	// Center the list on the screen
+	grid := tview.NewGrid().
+		SetRows(0, len(options)+2, 0).
+		SetColumns(0, 40, 0).
+		AddItem(list, 1, 1, 1, 1, 0, 0, true)
+
+	return nav.addModal(id, grid, true, func(theme theme.Theme) {
+		list.SetBackgroundColor(theme.AccentColor)
+		list.SetMainTextColor(theme.ForgroundColor)
+		list.SetSelectedBackgroundColor(theme.HighlightColor)
+		list.SetSelectedTextColor(theme.BackgroundColor)
+		list.SetBorderColor(theme.BorderColor)
+		list.SetTitleColor(theme.TitleColor)
+	})
 }
 
 // AlertErrors creates an alert modal with a list of errors
@@ -195,3 +501,8 @@ func (nav *PageNavigator) AlertErrors(id, errMessage string, messages []string)
 
 	nav.Alert(id, errMessage)
 }
+
+// pageLogger returns a logger whose records carry the page slug
+func pageLogger(slug PageSlug) *slog.Logger {
+	return logging.Component("ui").With("page", string(slug))
+}
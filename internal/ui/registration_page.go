@@ -17,15 +17,15 @@ const (
 )
 
 type RegistrationPage struct {
-	userAuthClient   *idam.UserAuthClient
+	serverClients    *state.ServerClients
 	registrationForm *tview.Form
 	currentThemCode  string
 }
 
 // NewRegistrationPage creates a new instance of the registration page
-func NewRegistrationPage(userAuthClient *idam.UserAuthClient) *RegistrationPage {
+func NewRegistrationPage(serverClients *state.ServerClients) *RegistrationPage {
 	return &RegistrationPage{
-		userAuthClient:   userAuthClient,
+		serverClients:    serverClients,
 		registrationForm: tview.NewForm(),
 		currentThemCode:  "NOT_SET",
 	}
@@ -41,8 +41,8 @@ func (page *RegistrationPage) Setup(app *tview.Application, appContext *state.Ap
 
 	// If the user presses the escape key, navigate back to the welcome page
 	page.registrationForm.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(WELCOME_PAGE, nil)
+		if nav.Keymap().MatchesInText(ACTION_BACK, event) {
+			nav.BackOr(WELCOME_PAGE)
 			return nil
 		}
 
@@ -144,7 +144,7 @@ func (page *RegistrationPage) Setup(app *tview.Application, appContext *state.Ap
 				Username: username,
 			}
 
-			_, err := page.userAuthClient.Register("brochat", request)
+			_, err := page.serverClients.UserAuthClient().Register("brochat", request)
 
 			if err != nil {
 				errMessage := err.Error()
@@ -170,10 +170,10 @@ func (page *RegistrationPage) Setup(app *tview.Application, appContext *state.Ap
 
 			nav.AlertWithDoneFunc(REGISTRATION_MODAL_INFO, REGISTRATION_SUCCESS_MESSAGE, func(buttonIndex int, buttonLabel string) {
 				nav.Pages.HidePage(REGISTRATION_MODAL_INFO).RemovePage(REGISTRATION_MODAL_INFO)
-				nav.NavigateTo(WELCOME_PAGE, nil)
+				nav.BackOr(WELCOME_PAGE)
 			})
 		}).
-		AddButton("Back", func() { nav.NavigateTo(WELCOME_PAGE, nil) })
+		AddButton("Back", func() { nav.BackOr(WELCOME_PAGE) })
 
 	grid.AddItem(page.registrationForm, 1, 1, 1, 1, 0, 0, true)
 
@@ -195,10 +195,14 @@ func (page *RegistrationPage) Setup(app *tview.Application, appContext *state.Ap
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(REGISTER_PAGE, applyTheme)
+
+	nav.DescribeKeys(REGISTER_PAGE,
+		KeyHelp{Action: ACTION_BACK, Description: "Back to the welcome page"},
+	)
 
 	nav.Register(REGISTER_PAGE, grid, true, false,
 		func(param interface{}) {
-			applyTheme()
 			page.onPageLoad()
 		},
 		func() {
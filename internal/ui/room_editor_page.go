@@ -2,7 +2,6 @@ package ui
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/dmars8047/brolib/chat"
 	"github.com/dmars8047/broterm/internal/state"
@@ -21,17 +20,15 @@ const (
 
 // RoomEditorPage is the room editor page
 type RoomEditorPage struct {
-	brochatClient    *chat.BroChatClient
-	form             *tview.Form
-	currentThemeCode string
+	serverClients *state.ServerClients
+	form          *tview.Form
 }
 
 // NewRoomEditorPage creates a new room editor page
-func NewRoomEditorPage(brochatClient *chat.BroChatClient) *RoomEditorPage {
+func NewRoomEditorPage(serverClients *state.ServerClients) *RoomEditorPage {
 	return &RoomEditorPage{
-		brochatClient:    brochatClient,
-		form:             tview.NewForm(),
-		currentThemeCode: "NOT_SET",
+		serverClients: serverClients,
+		form:          tview.NewForm(),
 	}
 }
 
@@ -53,7 +50,7 @@ func (page *RoomEditorPage) Setup(app *tview.Application, appContext *state.Appl
 		accessToken, ok := appContext.GetAccessToken()
 
 		if !ok {
-			log.Printf("Valid user authentication information not found. Redirecting to login page.")
+			pageLogger(ROOM_EDITOR_PAGE).Info("Valid user authentication information not found, redirecting to login page")
 			nav.NavigateTo(LOGIN_PAGE, nil)
 			return
 		}
@@ -95,7 +92,7 @@ func (page *RoomEditorPage) Setup(app *tview.Application, appContext *state.Appl
 			MembershipModel: optstr,
 		}
 
-		createRoomResult := page.brochatClient.CreateRoom(accessToken, request)
+		createRoomResult := page.serverClients.BrochatClient().CreateRoom(accessToken, request)
 
 		createRoomErr := createRoomResult.Err()
 
@@ -115,17 +112,17 @@ func (page *RoomEditorPage) Setup(app *tview.Application, appContext *state.Appl
 		}
 
 		nav.AlertWithDoneFunc(ROOM_EDITOR_PAGE_ALERT_INFO, "Room creation successful!", func(buttonIndex int, buttonLabel string) {
-			nav.NavigateTo(ROOM_LIST_PAGE, nil)
+			nav.BackOr(ROOM_LIST_PAGE)
 		})
 	})
 
 	page.form.AddButton("Back", func() {
-		nav.NavigateTo(ROOM_LIST_PAGE, nil)
+		nav.BackOr(ROOM_LIST_PAGE)
 	})
 
 	page.form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(ROOM_LIST_PAGE, nil)
+		if nav.Keymap().MatchesInText(ACTION_BACK, event) {
+			nav.BackOr(ROOM_LIST_PAGE)
 		}
 
 		return event
@@ -140,25 +137,26 @@ func (page *RoomEditorPage) Setup(app *tview.Application, appContext *state.Appl
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.form.SetBackgroundColor(theme.AccentColor)
-			page.form.SetFieldBackgroundColor(theme.AccentColorTwo)
-			page.form.SetLabelColor(theme.HighlightColor)
-			page.form.SetButtonStyle(theme.ButtonStyle)
-			page.form.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
-			page.form.SetBorderColor(theme.BorderColor)
-			page.form.SetTitleColor(theme.TitleColor)
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
-		}
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.form.SetBackgroundColor(theme.AccentColor)
+		page.form.SetFieldBackgroundColor(theme.AccentColorTwo)
+		page.form.SetLabelColor(theme.HighlightColor)
+		page.form.SetButtonStyle(theme.ButtonStyle)
+		page.form.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
+		page.form.SetBorderColor(theme.BorderColor)
+		page.form.SetTitleColor(theme.TitleColor)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.InfoColor)
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(ROOM_EDITOR_PAGE, applyTheme)
+
+	nav.DescribeKeys(ROOM_EDITOR_PAGE,
+		KeyHelp{Action: ACTION_BACK, Description: "Leave without creating the room"},
+	)
 
 	nav.Register(ROOM_EDITOR_PAGE, grid, true, false, func(_ interface{}) {
-		applyTheme()
 		page.onPageLoad()
 	}, func() {
 		page.onPageClose()
@@ -2,7 +2,6 @@ package ui
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/dmars8047/brolib/chat"
 	"github.com/dmars8047/broterm/internal/state"
@@ -20,19 +19,17 @@ const (
 
 // RoomFinderPage is the room finder page
 type RoomFinderPage struct {
-	brochatClient    *chat.BroChatClient
-	table            *tview.Table
-	publicRooms      map[int]chat.Room
-	currentThemeCode string
+	serverClients *state.ServerClients
+	table         *tview.Table
+	publicRooms   map[int]chat.Room
 }
 
 // NewRoomFinderPage creates a new room finder page
-func NewRoomFinderPage(brochatClient *chat.BroChatClient) *RoomFinderPage {
+func NewRoomFinderPage(serverClients *state.ServerClients) *RoomFinderPage {
 	return &RoomFinderPage{
-		brochatClient:    brochatClient,
-		table:            tview.NewTable(),
-		publicRooms:      make(map[int]chat.Room, 0),
-		currentThemeCode: "NOT_SET",
+		serverClients: serverClients,
+		table:         tview.NewTable(),
+		publicRooms:   make(map[int]chat.Room, 0),
 	}
 }
 
@@ -55,13 +52,13 @@ func (page *RoomFinderPage) Setup(app *tview.Application, appContext *state.Appl
 		accessToken, ok := appContext.GetAccessToken()
 
 		if !ok {
-			log.Printf("Valid user authentication information not found. Redirecting to login page.")
+			pageLogger(ROOM_FINDER_PAGE).Info("Valid user authentication information not found, redirecting to login page")
 			nav.NavigateTo(LOGIN_PAGE, nil)
 			return
 		}
 
 		nav.Confirm(ROOM_FINDER_PAGE_CONFIRM, fmt.Sprintf("Join %s?", room.Name), func() {
-			joinRoomResult := page.brochatClient.JoinRoom(accessToken, room.Id)
+			joinRoomResult := page.serverClients.BrochatClient().JoinRoom(accessToken, room.Id)
 
 			joinRoomErr := joinRoomResult.Err()
 
@@ -82,48 +79,33 @@ func (page *RoomFinderPage) Setup(app *tview.Application, appContext *state.Appl
 
 			nav.AlertWithDoneFunc(ROOM_FINDER_PAGE_ALERT_INFO, fmt.Sprintf("You have successfuly joined the room '%s'.", room.Name), func(buttonIndex int, buttonLabel string) {
 				nav.Pages.HidePage(ROOM_FINDER_PAGE_ALERT_INFO).RemovePage(ROOM_FINDER_PAGE_ALERT_INFO)
-				nav.NavigateTo(CHAT_PAGE, ChatPageParameters{
+				// The finder is done with once the room is joined so leaving the chat returns to the room list
+				nav.Replace(CHAT_PAGE, ChatPageParameters{
 					channel_id: room.ChannelId,
 					title:      room.Name,
-					returnPage: ROOM_LIST_PAGE,
 				})
 			})
 		})
 	})
 
+	keymap := nav.Keymap()
+
 	page.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(ROOM_LIST_PAGE, nil)
+		if keymap.Matches(ACTION_BACK, event) {
+			nav.BackOr(ROOM_LIST_PAGE)
 			page.publicRooms = make(map[int]chat.Room, 0)
 			page.table.Clear()
-		} else if event.Key() == tcell.KeyTab {
-			// Change the selected row to the next row
-			row, _ := page.table.GetSelection()
-			if row+1 >= page.table.GetRowCount() {
-				row = 1
-			} else {
-				row++
-			}
-
-			page.table.Select(row, 0)
-		} else if event.Key() == tcell.KeyBacktab {
-			// Change the selected row to the previous row
-			row, _ := page.table.GetSelection()
-
-			if row-1 < 1 {
-				row = page.table.GetRowCount() - 1
-			} else {
-				row--
-			}
-
-			page.table.Select(row, 0)
+			return nil
 		}
 
-		return event
+		return handleTableKeys(keymap, page.table, event)
 	})
 
 	tvInstructions := tview.NewTextView().SetTextAlign(tview.AlignCenter)
-	tvInstructions.SetText("(enter) Join room - (esc) Quit")
+	tvInstructions.SetText(instructions(
+		keymap.Hint("Join room", ACTION_SELECT),
+		keymap.Hint("Quit", ACTION_BACK),
+	))
 
 	grid := tview.NewGrid()
 
@@ -137,26 +119,37 @@ func (page *RoomFinderPage) Setup(app *tview.Application, appContext *state.Appl
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetBordersColor(theme.BorderColor)
-			page.table.SetBorderColor(theme.BorderColor)
-			page.table.SetTitleColor(theme.TitleColor)
-			page.table.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
-			tvHeader.SetBackgroundColor(theme.BackgroundColor)
-			tvHeader.SetTextColor(theme.TitleColor)
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetBordersColor(theme.BorderColor)
+		page.table.SetBorderColor(theme.BorderColor)
+		page.table.SetTitleColor(theme.TitleColor)
+		page.table.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
+		tvHeader.SetBackgroundColor(theme.BackgroundColor)
+		tvHeader.SetTextColor(theme.TitleColor)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.InfoColor)
+
+		// Table cells keep the colors they were created with so the headings are recolored
+		for column := 0; column < page.table.GetColumnCount(); column++ {
+			if cell := page.table.GetCell(0, column); cell != nil {
+				cell.SetTextColor(theme.ForgroundColor)
+			}
 		}
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(ROOM_FINDER_PAGE, applyTheme)
+
+	nav.DescribeKeys(ROOM_FINDER_PAGE,
+		KeyHelp{Action: ACTION_SELECT, Description: "Join the selected room"},
+		KeyHelp{Action: ACTION_NEXT, Description: "Next room"},
+		KeyHelp{Action: ACTION_PREVIOUS, Description: "Previous room"},
+		KeyHelp{Action: ACTION_BACK, Description: "Back to the room list"},
+	)
 
 	nav.Register(ROOM_FINDER_PAGE, grid, true, false,
 		func(_ interface{}) {
-			applyTheme()
 			page.onPageLoad(appContext, nav)
 		},
 		func() {
@@ -169,7 +162,7 @@ func (page *RoomFinderPage) onPageLoad(appContext *state.ApplicationContext, nav
 	accessToken, ok := appContext.GetAccessToken()
 
 	if !ok {
-		log.Printf("Valid user authentication information not found. Redirecting to login page.")
+		pageLogger(ROOM_FINDER_PAGE).Info("Valid user authentication information not found, redirecting to login page")
 		nav.NavigateTo(LOGIN_PAGE, nil)
 		return
 	}
@@ -189,7 +182,7 @@ func (page *RoomFinderPage) onPageLoad(appContext *state.ApplicationContext, nav
 		SetSelectable(false).
 		SetAttributes(tcell.AttrBold|tcell.AttrUnderline))
 
-	getRoomsResult := page.brochatClient.GetRooms(accessToken)
+	getRoomsResult := page.serverClients.BrochatClient().GetRooms(accessToken)
 
 	err := getRoomsResult.Err()
 
@@ -203,8 +196,8 @@ func (page *RoomFinderPage) onPageLoad(appContext *state.ApplicationContext, nav
 	for i, rel := range rooms {
 		row := i + 1
 
-		page.table.SetCell(row, 0, tview.NewTableCell(rel.Name).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignCenter))
-		page.table.SetCell(row, 1, tview.NewTableCell(rel.Owner.Username).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignCenter))
+		page.table.SetCell(row, 0, tview.NewTableCell(tview.Escape(rel.Name)).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignCenter))
+		page.table.SetCell(row, 1, tview.NewTableCell(tview.Escape(rel.Owner.Username)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignCenter))
 
 		page.publicRooms[row] = rel
 	}
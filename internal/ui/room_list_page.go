@@ -2,6 +2,7 @@ package ui
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/dmars8047/brolib/chat"
 	"github.com/dmars8047/broterm/internal/state"
@@ -17,21 +18,28 @@ const (
 	ROOM_LIST_PAGE_ALERT_ERR  = "home:roomlist:alert:err"
 )
 
+// MENTION_COUNT_MESSAGE_LIMIT is how many of the latest messages of a room are looked through for mentions of the user
+const MENTION_COUNT_MESSAGE_LIMIT = 100
+
+// RoomListPage lists the rooms of the user along with the number of unread mentions of the user in each.
+// The server does not record what the user has read, so mentions are only counted from when the application was launched
+// or the room was last opened, which the column heading points out.
 type RoomListPage struct {
-	brochatClient    *chat.BroChatClient
-	feedClient       *state.FeedClient
-	table            *tview.Table
-	userRooms        map[int]chat.Room
-	currentThemeCode string
+	serverClients *state.ServerClients
+	feedClient    *state.FeedClient
+	mentions      *state.MentionTracker
+	table         *tview.Table
+	userRooms     map[int]chat.Room
 }
 
-func NewRoomListPage(brochatClient *chat.BroChatClient, feedClient *state.FeedClient) *RoomListPage {
+// NewRoomListPage creates the room list page. The number of unread mentions of the user in each room is counted with the mention tracker.
+func NewRoomListPage(serverClients *state.ServerClients, feedClient *state.FeedClient, mentions *state.MentionTracker) *RoomListPage {
 	return &RoomListPage{
-		brochatClient:    brochatClient,
-		feedClient:       feedClient,
-		table:            tview.NewTable(),
-		userRooms:        make(map[int]chat.Room, 0),
-		currentThemeCode: "NOT_SET",
+		serverClients: serverClients,
+		feedClient:    feedClient,
+		mentions:      mentions,
+		table:         tview.NewTable(),
+		userRooms:     make(map[int]chat.Room, 0),
 	}
 }
 
@@ -53,54 +61,38 @@ func (page *RoomListPage) Setup(app *tview.Application, appContext *state.Applic
 		nav.NavigateTo(CHAT_PAGE, ChatPageParameters{
 			channel_id: room.ChannelId,
 			title:      room.Name,
-			returnPage: ROOM_LIST_PAGE,
 		})
 	})
 
+	keymap := nav.Keymap()
+
 	page.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyRune {
-			switch event.Rune() {
-			case 'f':
-				nav.NavigateTo(ROOM_FINDER_PAGE, nil)
-				page.userRooms = make(map[int]chat.Room, 0)
-				page.table.Clear()
-			case 'n':
-				nav.NavigateTo(ROOM_EDITOR_PAGE, nil)
-				page.userRooms = make(map[int]chat.Room, 0)
-				page.table.Clear()
-			}
-		} else if event.Key() == tcell.KeyEscape {
-			nav.NavigateTo(HOME_PAGE, nil)
+		if keymap.Matches(ACTION_FIND_ROOM, event) {
+			nav.NavigateTo(ROOM_FINDER_PAGE, nil)
 			page.userRooms = make(map[int]chat.Room, 0)
 			page.table.Clear()
-		} else if event.Key() == tcell.KeyTab {
-			// Change the selected row to the next row
-			row, _ := page.table.GetSelection()
-			if row+1 >= page.table.GetRowCount() {
-				row = 1
-			} else {
-				row++
-			}
-
-			page.table.Select(row, 0)
-		} else if event.Key() == tcell.KeyBacktab {
-			// Change the selected row to the previous row
-			row, _ := page.table.GetSelection()
-
-			if row-1 < 1 {
-				row = page.table.GetRowCount() - 1
-			} else {
-				row--
-			}
-
-			page.table.Select(row, 0)
+			return nil
+		} else if keymap.Matches(ACTION_CREATE_ROOM, event) {
+			nav.NavigateTo(ROOM_EDITOR_PAGE, nil)
+			page.userRooms = make(map[int]chat.Room, 0)
+			page.table.Clear()
+			return nil
+		} else if keymap.Matches(ACTION_BACK, event) {
+			nav.BackOr(HOME_PAGE)
+			page.userRooms = make(map[int]chat.Room, 0)
+			page.table.Clear()
+			return nil
 		}
 
-		return event
+		return handleTableKeys(keymap, page.table, event)
 	})
 
 	tvInstructions := tview.NewTextView().SetTextAlign(tview.AlignCenter)
-	tvInstructions.SetText("(n) Create a Room - (f) Find a Room - (esc) Quit")
+	tvInstructions.SetText(instructions(
+		keymap.Hint("Create a Room", ACTION_CREATE_ROOM),
+		keymap.Hint("Find a Room", ACTION_FIND_ROOM),
+		keymap.Hint("Quit", ACTION_BACK),
+	))
 
 	grid := tview.NewGrid()
 
@@ -117,26 +109,37 @@ func (page *RoomListPage) Setup(app *tview.Application, appContext *state.Applic
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetBordersColor(theme.BorderColor)
-			page.table.SetBorderColor(theme.BorderColor)
-			page.table.SetTitleColor(theme.TitleColor)
-			page.table.SetBackgroundColor(theme.BackgroundColor)
-			page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
-			tvHeader.SetBackgroundColor(theme.BackgroundColor)
-			tvHeader.SetTextColor(theme.TitleColor)
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvInstructions.SetTextColor(theme.InfoColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetBordersColor(theme.BorderColor)
+		page.table.SetBorderColor(theme.BorderColor)
+		page.table.SetTitleColor(theme.TitleColor)
+		page.table.SetBackgroundColor(theme.BackgroundColor)
+		page.table.SetSelectedStyle(theme.DropdownListSelectedStyle)
+		tvHeader.SetBackgroundColor(theme.BackgroundColor)
+		tvHeader.SetTextColor(theme.TitleColor)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetTextColor(theme.InfoColor)
+
+		// Table cells keep the colors they were created with so an open table is filled again
+		if pageContext != nil && pageContext.Err() == nil {
+			page.populateTable(appContext.GetBrochatUser(), theme)
 		}
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(ROOM_LIST_PAGE, applyTheme)
+
+	nav.DescribeKeys(ROOM_LIST_PAGE,
+		KeyHelp{Action: ACTION_SELECT, Description: "Open the selected room"},
+		KeyHelp{Action: ACTION_NEXT, Description: "Next room"},
+		KeyHelp{Action: ACTION_PREVIOUS, Description: "Previous room"},
+		KeyHelp{Action: ACTION_FIND_ROOM},
+		KeyHelp{Action: ACTION_CREATE_ROOM},
+		KeyHelp{Action: ACTION_BACK, Description: "Back to the home page"},
+	)
 
 	nav.Register(ROOM_LIST_PAGE, grid, true, false,
 		func(_ interface{}) {
-			applyTheme()
 			pageContext, cancel = appContext.GenerateUserSessionBoundContextWithCancel()
 			page.onPageLoad(app, appContext, pageContext)
 		},
@@ -149,6 +152,8 @@ func (page *RoomListPage) Setup(app *tview.Application, appContext *state.Applic
 func (page *RoomListPage) onPageLoad(app *tview.Application, appContext *state.ApplicationContext, pageContext context.Context) {
 	page.populateTable(appContext.GetBrochatUser(), appContext.GetTheme())
 
+	go page.countMentions(app, appContext, pageContext)
+
 	// Create a go routine to monitor for changes to the user's rooms via a user profile update event
 	go func() {
 		subId, userUpdatedChannel := page.feedClient.SubscribeToUserProfileUpdates()
@@ -158,11 +163,17 @@ func (page *RoomListPage) onPageLoad(app *tview.Application, appContext *state.A
 			select {
 			case <-pageContext.Done():
 				return
-			case eventCode := <-userUpdatedChannel:
+			case eventCode, ok := <-userUpdatedChannel:
+				if !ok {
+					return
+				}
+
 				if eventCode == chat.USER_PROFILE_UPDATE_CODE_ROOM_UPDATE {
 					app.QueueUpdateDraw(func() {
 						page.populateTable(appContext.GetBrochatUser(), appContext.GetTheme())
 					})
+
+					go page.countMentions(app, appContext, pageContext)
 				}
 			}
 		}
@@ -188,12 +199,72 @@ func (page *RoomListPage) populateTable(brochatUser chat.User, thm theme.Theme)
 		SetSelectable(false).
 		SetAttributes(tcell.AttrBold|tcell.AttrUnderline))
 
+	page.table.SetCell(0, 2, tview.NewTableCell("Mentions Since Launch").
+		SetTextColor(thm.ForgroundColor).
+		SetAlign(tview.AlignCenter).
+		SetSelectable(false).
+		SetAttributes(tcell.AttrBold|tcell.AttrUnderline))
+
 	for i, rel := range brochatUser.Rooms {
 		row := i + 1
 
-		page.table.SetCell(row, 0, tview.NewTableCell(rel.Name).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
-		page.table.SetCell(row, 1, tview.NewTableCell(rel.Owner.Username).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
+		page.table.SetCell(row, 0, tview.NewTableCell(tview.Escape(rel.Name)).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
+		page.table.SetCell(row, 1, tview.NewTableCell(tview.Escape(rel.Owner.Username)).SetTextColor(thm.ForgroundColor).SetAlign(tview.AlignCenter))
+		page.table.SetCell(row, 2, mentionCountCell(page.mentions.Count(brochatUser.Id, rel.ChannelId), thm))
 
 		page.userRooms[row] = rel
 	}
 }
+
+// countMentions counts the unread mentions of the user in the latest messages of each of their rooms and shows the counts in the table.
+// The server only sends the messages of the open chat over the feed so the messages of each room are fetched.
+func (page *RoomListPage) countMentions(app *tview.Application, appContext *state.ApplicationContext, pageContext context.Context) {
+	logger := pageLogger(ROOM_LIST_PAGE)
+	brochatUser := appContext.GetBrochatUser()
+
+	for _, room := range brochatUser.Rooms {
+		if pageContext.Err() != nil {
+			return
+		}
+
+		accessToken, ok := appContext.GetAccessToken()
+
+		if !ok {
+			logger.Warn("No valid authentication information available for counting mentions")
+			return
+		}
+
+		result := page.serverClients.BrochatClient().GetChannelMessages(accessToken, room.ChannelId,
+			chat.GetChannelMessages_Page(1),
+			chat.GetChannelMessages_PageSize(MENTION_COUNT_MESSAGE_LIMIT))
+
+		if err := result.Err(); err != nil {
+			logger.Warn("Error getting room messages while counting mentions", "channel_id", room.ChannelId, "error", err)
+			continue
+		}
+
+		count := page.mentions.Update(brochatUser, room.ChannelId, result.Content)
+		channelId := room.ChannelId
+
+		app.QueueUpdateDraw(func() {
+			if pageContext.Err() != nil {
+				return
+			}
+
+			for row, userRoom := range page.userRooms {
+				if userRoom.ChannelId == channelId {
+					page.table.SetCell(row, 2, mentionCountCell(count, appContext.GetTheme()))
+				}
+			}
+		})
+	}
+}
+
+// mentionCountCell returns the table cell showing the number of unread mentions of a room, empty if there are none
+func mentionCountCell(count int, thm theme.Theme) *tview.TableCell {
+	if count == 0 {
+		return tview.NewTableCell("").SetAlign(tview.AlignCenter)
+	}
+
+	return tview.NewTableCell(fmt.Sprintf(" @%d ", count)).SetStyle(thm.MentionStyle).SetAlign(tview.AlignCenter)
+}
@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dmars8047/broterm/internal/state"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// The connection indicator's symbols. They differ in shape as well as style so the state can be told without color.
+const (
+	CONNECTED_SYMBOL  = "●"
+	CONNECTING_SYMBOL = "◐"
+	OFFLINE_SYMBOL    = "○"
+)
+
+// StatusBar is a single line rendered beneath every page which reports the health of the feed connection
+type StatusBar struct {
+	appContext *state.ApplicationContext
+	textView   *tview.TextView
+	connState  state.ConnectionState
+	mu         sync.Mutex
+}
+
+// NewStatusBar creates a new status bar
+func NewStatusBar(appContext *state.ApplicationContext) *StatusBar {
+	statusBar := &StatusBar{
+		appContext: appContext,
+		textView:   tview.NewTextView(),
+	}
+
+	statusBar.textView.SetDynamicColors(true)
+	statusBar.textView.SetTextAlign(tview.AlignRight)
+	statusBar.render()
+
+	return statusBar
+}
+
+// monitor subscribes to the feed client's connection state and redraws the status bar on every change
+func (statusBar *StatusBar) monitor(app *tview.Application, feedClient *state.FeedClient) {
+	subscriptionId, connStateChannel := feedClient.SubscribeToConnectionState()
+
+	go func() {
+		defer feedClient.UnsubscribeFromConnectionState(subscriptionId)
+
+		for {
+			select {
+			case <-statusBar.appContext.Context.Done():
+				return
+			case connState, ok := <-connStateChannel:
+				if !ok {
+					return
+				}
+
+				statusBar.mu.Lock()
+				statusBar.connState = connState
+				statusBar.mu.Unlock()
+
+				app.QueueUpdateDraw(statusBar.render)
+			}
+		}
+	}()
+}
+
+// render writes the current connection state to the status bar using the active theme.
+// The indicator is drawn in the theme's connection styles, which are adapted to the color mode and colorblind safe colors.
+func (statusBar *StatusBar) render() {
+	statusBar.mu.Lock()
+	connState := statusBar.connState
+	statusBar.mu.Unlock()
+
+	theme := statusBar.appContext.GetTheme()
+
+	statusBar.textView.SetBackgroundColor(theme.BackgroundColor)
+	statusBar.textView.SetTextColor(theme.InfoColorTwo)
+
+	var indicatorStyle tcell.Style
+	var symbol, text string
+
+	switch connState.Status {
+	case state.CONNECTION_STATUS_CONNECTED:
+		indicatorStyle, symbol = theme.ConnectedStyle, CONNECTED_SYMBOL
+		text = "Connected"
+
+		if connState.Latency > 0 {
+			text += fmt.Sprintf(" - %dms", connState.Latency.Milliseconds())
+		}
+	case state.CONNECTION_STATUS_CONNECTING:
+		indicatorStyle, symbol = theme.ConnectingStyle, CONNECTING_SYMBOL
+		text = "Connecting..."
+	case state.CONNECTION_STATUS_RECONNECTING:
+		indicatorStyle, symbol = theme.ConnectingStyle, CONNECTING_SYMBOL
+		text = "Reconnecting"
+
+		if connState.Attempt > 0 {
+			text += fmt.Sprintf(" (attempt %d)", connState.Attempt)
+		}
+
+		if connState.Reason != "" {
+			text += " - " + connState.Reason
+		}
+	default:
+		indicatorStyle, symbol = theme.OfflineStyle, OFFLINE_SYMBOL
+		text = "Offline"
+
+		if connState.Reason != "" {
+			text += " - " + connState.Reason
+		}
+	}
+
+	statusBar.textView.SetText(fmt.Sprintf("%s%s[-:-:-] %s ", styleTag(indicatorStyle), symbol, tview.Escape(text)))
+}
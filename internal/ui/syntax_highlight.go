@@ -0,0 +1,193 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rivo/tview"
+)
+
+// syntaxLanguage is what code blocks of a language are highlighted by
+type syntaxLanguage struct {
+	keywords map[string]bool
+	// What starts a comment running to the end of the line
+	lineComments []string
+	// Whether /* */ comments are used
+	blockComments bool
+	// The characters strings are quoted with
+	quotes string
+	// Whether keywords may be written in any case, as in SQL
+	caseInsensitive bool
+}
+
+// syntaxLanguages are the languages code blocks can be highlighted in, by the names code blocks are fenced with
+var syntaxLanguages = func() map[string]*syntaxLanguage {
+	golang := newSyntaxLanguage("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota",
+		[]string{"//"}, true, "\"'`")
+	python := newSyntaxLanguage("and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return True try while with yield self",
+		[]string{"#"}, false, "\"'")
+	javascript := newSyntaxLanguage("async await break case catch class const continue debugger default delete do else export extends false finally for function if import in instanceof let new null of return static super switch this throw true try typeof undefined var void while yield interface type enum implements readonly",
+		[]string{"//"}, true, "\"'`")
+	java := newSyntaxLanguage("abstract boolean break byte case catch char class const continue default do double else enum extends false final finally float for if implements import instanceof int interface long new null package private protected public return short static super switch synchronized this throw throws true try void volatile while var",
+		[]string{"//"}, true, "\"'")
+	c := newSyntaxLanguage("auto bool break case char class const continue default delete do double else enum extern false float for goto if include define inline int long namespace new nullptr private protected public return short signed sizeof static struct switch template this throw true try typedef union unsigned using virtual void volatile while",
+		[]string{"//"}, true, "\"'")
+	csharp := newSyntaxLanguage("abstract as async await base bool break byte case catch char class const continue decimal default delegate do double else enum false finally float for foreach if in int interface internal is long namespace new null object out override private protected public readonly ref return static string struct switch this throw true try using var virtual void while",
+		[]string{"//"}, true, "\"'")
+	rust := newSyntaxLanguage("as async await break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while",
+		[]string{"//"}, true, "\"")
+	shell := newSyntaxLanguage("if then else elif fi case esac for while until do done in function return export local echo exit",
+		[]string{"#"}, false, "\"'")
+	sql := newSyntaxLanguage("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on as group by order having limit offset null is in like distinct union primary key foreign references",
+		[]string{"--"}, true, "'\"")
+	sql.caseInsensitive = true
+	json := newSyntaxLanguage("true false null", nil, false, "\"")
+
+	return map[string]*syntaxLanguage{
+		"go": golang, "golang": golang,
+		"python": python, "py": python,
+		"javascript": javascript, "js": javascript, "typescript": javascript, "ts": javascript, "jsx": javascript, "tsx": javascript,
+		"java": java, "kotlin": java,
+		"c": c, "cpp": c, "c++": c, "h": c,
+		"csharp": csharp, "cs": csharp, "c#": csharp,
+		"rust": rust, "rs": rust,
+		"bash": shell, "sh": shell, "shell": shell, "zsh": shell,
+		"sql":  sql,
+		"json": json,
+	}
+}()
+
+// newSyntaxLanguage creates a language from its space separated keywords
+func newSyntaxLanguage(keywords string, lineComments []string, blockComments bool, quotes string) *syntaxLanguage {
+	language := &syntaxLanguage{
+		keywords:      make(map[string]bool),
+		lineComments:  lineComments,
+		blockComments: blockComments,
+		quotes:        quotes,
+	}
+
+	for _, keyword := range strings.Fields(keywords) {
+		language.keywords[keyword] = true
+	}
+
+	return language
+}
+
+// syntaxColors are the tag colors of the parts of highlighted code
+type syntaxColors struct {
+	text    string
+	keyword string
+	literal string
+	comment string
+}
+
+// highlightCode escapes a line of code and colors its keywords, strings, numbers and comments.
+// Block comments are only recognised within the line.
+func highlightCode(line string, language *syntaxLanguage, colors syntaxColors) string {
+	var builder strings.Builder
+
+	runes := []rune(line)
+	// The text waiting to be written in the current color
+	var run []rune
+	currentColor := colors.text
+
+	write := func(color string, text []rune) {
+		if len(text) == 0 {
+			return
+		}
+
+		if color != currentColor {
+			builder.WriteString(tview.Escape(string(run)))
+			builder.WriteString("[" + color + "]")
+			run = nil
+			currentColor = color
+		}
+
+		run = append(run, text...)
+	}
+
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+
+		if comment := language.commentLength(rest); comment > 0 {
+			write(colors.comment, runes[i:i+comment])
+			i += comment
+			continue
+		}
+
+		r := runes[i]
+
+		switch {
+		case strings.ContainsRune(language.quotes, r):
+			end := i + 1
+
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			end = min(end+1, len(runes))
+			write(colors.literal, runes[i:end])
+			i = end
+		case unicode.IsDigit(r) && (i == 0 || !isIdentifierRune(runes[i-1])):
+			end := i + 1
+
+			for end < len(runes) && (isIdentifierRune(runes[end]) || runes[end] == '.') {
+				end++
+			}
+
+			write(colors.literal, runes[i:end])
+			i = end
+		case isIdentifierRune(r):
+			end := i + 1
+
+			for end < len(runes) && isIdentifierRune(runes[end]) {
+				end++
+			}
+
+			word := string(runes[i:end])
+
+			if language.keywords[word] || language.caseInsensitive && language.keywords[strings.ToLower(word)] {
+				write(colors.keyword, runes[i:end])
+			} else {
+				write(colors.text, runes[i:end])
+			}
+
+			i = end
+		default:
+			write(colors.text, runes[i:i+1])
+			i++
+		}
+	}
+
+	builder.WriteString(tview.Escape(string(run)))
+
+	return builder.String()
+}
+
+// commentLength returns the length in runes of the comment the text starts with, or 0 if it does not start with one
+func (language *syntaxLanguage) commentLength(text string) int {
+	for _, marker := range language.lineComments {
+		if strings.HasPrefix(text, marker) {
+			return len([]rune(text))
+		}
+	}
+
+	if language.blockComments && strings.HasPrefix(text, "/*") {
+		if end := strings.Index(text[2:], "*/"); end >= 0 {
+			return len([]rune(text[:end+4]))
+		}
+
+		return len([]rune(text))
+	}
+
+	return 0
+}
+
+// isIdentifierRune returns true if the rune can be part of a keyword or name
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
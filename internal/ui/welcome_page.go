@@ -10,14 +10,14 @@ const WELCOME_PAGE PageSlug = "welcome"
 
 // WelcomePage is the welcome page
 type WelcomePage struct {
-	currentThemeCode   string
+	profileManager     *state.ProfileManager
 	applicationVersion string
 }
 
 // NewWelcomePage creates a new instance of the welcome page
-func NewWelcomePage(applicationVersion string) *WelcomePage {
+func NewWelcomePage(applicationVersion string, profileManager *state.ProfileManager) *WelcomePage {
 	return &WelcomePage{
-		currentThemeCode:   "NOT_SET",
+		profileManager:     profileManager,
 		applicationVersion: applicationVersion,
 	}
 }
@@ -75,8 +75,9 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 	})
 
 	buttonGrid := tview.NewGrid()
+	keymap := nav.Keymap()
+
 	buttonGrid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		key := event.Key()
 
 		goRight := func() {
 			if loginButton.HasFocus() {
@@ -102,31 +103,38 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 			}
 		}
 
-		// vim movement keys
-		if key == tcell.KeyRune {
-			switch event.Rune() {
-			case 'l':
-				goRight()
-			case 'h':
-				goLeft()
-			}
-		}
-
-		if key == tcell.KeyTab || key == tcell.KeyRight {
+		if keymap.Matches(ACTION_SWITCH_PROFILE, event) {
+			page.selectProfile(nav)
+			return nil
+		} else if keymap.Matches(ACTION_NEXT, event) {
 			goRight()
-		} else if key == tcell.KeyBacktab || key == tcell.KeyLeft {
+		} else if keymap.Matches(ACTION_PREVIOUS, event) {
 			goLeft()
-		} else if key == tcell.KeyEscape {
+		} else if keymap.Matches(ACTION_BACK, event) {
 			app.Stop()
 		}
 		return event
 	})
 
 	tvInstructions := tview.NewTextView().SetTextAlign(tview.AlignCenter)
-	tvInstructions.SetText("Navigate with Tab and Shift+Tab")
+	tvInstructions.SetText(instructions(
+		keymap.Hint("Navigate", ACTION_NEXT, ACTION_PREVIOUS),
+		keymap.Hint("Switch Profile", ACTION_SWITCH_PROFILE),
+	))
 
 	tvVersionNumber := tview.NewTextView().SetTextAlign(tview.AlignCenter)
-	tvVersionNumber.SetText("Version - " + page.applicationVersion)
+
+	setVersionText := func() {
+		profileName := "Default"
+
+		if profile, ok := page.profileManager.GetActiveProfile(); ok {
+			profileName = profile.Name
+		}
+
+		tvVersionNumber.SetText("Version - " + page.applicationVersion + " - Profile - " + profileName)
+	}
+
+	setVersionText()
 
 	buttonGrid.SetRows(3, 1, 1).SetColumns(0, 2, 0, 2, 0, 2, 0)
 
@@ -141,47 +149,54 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 		AddItem(buttonGrid, 2, 1, 1, 2, 0, 0, true).
 		AddItem(tvVersionNumber, 4, 1, 1, 2, 0, 0, false)
 
+	// The redirect modal is shown within the page so it is styled along with it
+	var redirectModal *tview.Modal
+
 	applyTheme := func() {
 		theme := appContext.GetTheme()
 
-		if page.currentThemeCode != theme.Code {
-			page.currentThemeCode = theme.Code
-			grid.SetBackgroundColor(theme.BackgroundColor)
-			logoBro.SetBackgroundColor(theme.BackgroundColor)
-			logoBro.SetTextColor(tcell.ColorWhite)
-			logoChat.SetBackgroundColor(theme.BackgroundColor)
-			logoChat.SetTextColor(theme.HighlightColor)
+		grid.SetBackgroundColor(theme.BackgroundColor)
+		logoBro.SetBackgroundColor(theme.BackgroundColor)
+		logoBro.SetTextColor(tcell.ColorWhite)
+		logoChat.SetBackgroundColor(theme.BackgroundColor)
+		logoChat.SetTextColor(theme.HighlightColor)
 
-			loginButton.SetActivatedStyle(theme.ActivatedButtonStyle)
-			loginButton.SetStyle(theme.ButtonStyle)
+		loginButton.SetActivatedStyle(theme.ActivatedButtonStyle)
+		loginButton.SetStyle(theme.ButtonStyle)
 
-			registrationButton.SetActivatedStyle(theme.ActivatedButtonStyle)
-			registrationButton.SetStyle(theme.ButtonStyle)
+		registrationButton.SetActivatedStyle(theme.ActivatedButtonStyle)
+		registrationButton.SetStyle(theme.ButtonStyle)
 
-			configButton.SetActivatedStyle(theme.ActivatedButtonStyle)
-			configButton.SetStyle(theme.ButtonStyle)
+		configButton.SetActivatedStyle(theme.ActivatedButtonStyle)
+		configButton.SetStyle(theme.ButtonStyle)
 
-			exitButton.SetActivatedStyle(theme.ActivatedButtonStyle)
-			exitButton.SetStyle(theme.ButtonStyle)
+		exitButton.SetActivatedStyle(theme.ActivatedButtonStyle)
+		exitButton.SetStyle(theme.ButtonStyle)
 
-			tvInstructions.SetBackgroundColor(theme.BackgroundColor)
-			tvVersionNumber.SetBackgroundColor(theme.BackgroundColor)
+		tvInstructions.SetBackgroundColor(theme.BackgroundColor)
+		tvVersionNumber.SetBackgroundColor(theme.BackgroundColor)
 
-			tvInstructions.SetTextColor(theme.InfoColor)
-			tvVersionNumber.SetTextColor(theme.InfoColorTwo)
+		tvInstructions.SetTextColor(theme.InfoColor)
+		tvVersionNumber.SetTextColor(theme.InfoColorTwo)
 
-			theme.ApplyGlobals()
-			nav.Pages.SetBackgroundColor(theme.BackgroundColor)
+		if redirectModal != nil {
+			styleModal(redirectModal, theme)
 		}
 	}
 
 	applyTheme()
+	nav.SubscribeToThemeChanges(WELCOME_PAGE, applyTheme)
+
+	nav.DescribeKeys(WELCOME_PAGE,
+		KeyHelp{Action: ACTION_NEXT, Description: "Next button"},
+		KeyHelp{Action: ACTION_PREVIOUS, Description: "Previous button"},
+		KeyHelp{Action: ACTION_SWITCH_PROFILE},
+		KeyHelp{Action: ACTION_BACK, Description: "Exit BroChat"},
+	)
 
 	nav.Register(WELCOME_PAGE, grid, true, true, func(param interface{}) {
-		applyTheme()
+		setVersionText()
 		if param != nil {
-			theme := appContext.GetTheme()
-
 			welcomPageParameters := param.(WelcomePageParams)
 			if welcomPageParameters.isRedirect {
 				modal := tview.NewModal()
@@ -189,16 +204,12 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 					AddButtons([]string{"Close"}).
 					SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 						grid.RemoveItem(modal)
+						redirectModal = nil
 						app.SetFocus(loginButton)
 					})
 
-				modal.SetBackgroundColor(theme.BackgroundColor)
-				modal.SetTextColor(theme.ForgroundColor)
-				modal.SetButtonStyle(theme.ButtonStyle)
-				modal.SetButtonActivatedStyle(theme.ActivatedButtonStyle)
-				modal.SetBorderColor(theme.BorderColor)
-				modal.SetBorderStyle(theme.TextAreaTextStyle)
-				modal.SetTitleColor(theme.TitleColor)
+				styleModal(modal, appContext.GetTheme())
+				redirectModal = modal
 
 				grid.AddItem(modal, 3, 1, 1, 2, 0, 0, true)
 				app.SetFocus(modal)
@@ -206,3 +217,34 @@ CC |  CC\ HH |  HH |AA  __AA | TT |TT\
 		}
 	}, nil)
 }
+
+// selectProfile lets the user pick the profile to switch to
+func (page *WelcomePage) selectProfile(nav *PageNavigator) {
+	profileNames := page.profileManager.GetProfileNames()
+
+	if len(profileNames) == 0 {
+		nav.Alert("welcome:profile:alert:info", "No profiles are defined. Add them to the profiles section of the config file.")
+		return
+	}
+
+	options := append([]string{"Default"}, profileNames...)
+
+	nav.Select("welcome:profile:select", " Switch Profile ", options, func(index int, option string) {
+		profileName := option
+
+		// The first option switches back to the top level settings
+		if index == 0 {
+			profileName = ""
+		}
+
+		err := page.profileManager.Switch(profileName, true)
+
+		if err != nil {
+			nav.Alert("welcome:profile:alert:err", err.Error())
+			return
+		}
+
+		// Reload the page to pick up the profile's theme
+		nav.NavigateTo(WELCOME_PAGE, nil)
+	})
+}